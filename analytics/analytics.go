@@ -0,0 +1,195 @@
+// Package analytics 基于数据库中存储的报警统计恢复时长, 触发次数, 循环次数及 Firing 时长,
+// 并定期刷新为 Prometheus 指标.
+package analytics
+
+import (
+	"alert2pg/storage"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Analyzer 报警统计接口, 由 storage.Postgres 实现.
+type Analyzer interface {
+	ResolveStats(ctx context.Context, q storage.AnalyticsQuery) ([]storage.ResolveStats, error)
+	FiringCounts(ctx context.Context, q storage.AnalyticsQuery, period time.Duration) ([]storage.FiringCount, error)
+	Flapping(ctx context.Context, q storage.AnalyticsQuery, limit int) ([]storage.FlappingStats, error)
+	OpenStats(ctx context.Context, q storage.AnalyticsQuery) ([]storage.OpenStats, error)
+}
+
+// Exporter 定期从数据库中读取报警统计, 并导出为 Prometheus 指标.
+type Exporter struct {
+	analyzer Analyzer
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	options Options
+	logger  log.Logger
+
+	resolveDurationGauge *prometheus.GaugeVec
+	firedAlertsGauge     *prometheus.GaugeVec
+	flappingCyclesGauge  *prometheus.GaugeVec
+	openAlertsGauge      *prometheus.GaugeVec
+	openAgeGauge         *prometheus.GaugeVec
+	refreshFailedCounter prometheus.Counter
+}
+
+func New(analyzer Analyzer, logger log.Logger, opts ...Option) (*Exporter, error) {
+	if analyzer == nil {
+		return nil, fmt.Errorf("空指针: analyzer")
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+	if options.interval <= 0 || options.window <= 0 || options.top <= 0 || len(options.groupBy) == 0 {
+		return nil, fmt.Errorf("无效的统计参数: interval=%s, window=%s, top=%d, groupBy=%v", options.interval, options.window, options.top, options.groupBy)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Exporter{
+		analyzer: analyzer,
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		options:  options,
+		logger:   logger,
+		resolveDurationGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "analytics", Name: "resolve_duration_seconds", Help: "Time to resolve of alerts started within the window"},
+			[]string{"by", "group", "stat"},
+		),
+		firedAlertsGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "analytics", Name: "fired_alerts", Help: "Number of alerts started within the window"},
+			[]string{"by", "group"},
+		),
+		flappingCyclesGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "analytics", Name: "flapping_cycles", Help: "Number of firing/resolved cycles within the window of the most flapping alerts"},
+			[]string{"tenant", "fingerprint", "alertname"},
+		),
+		openAlertsGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "analytics", Name: "open_alerts", Help: "Number of currently firing alerts"},
+			[]string{"by", "group"},
+		),
+		openAgeGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "analytics", Name: "open_age_seconds", Help: "Age of currently firing alerts"},
+			[]string{"by", "group", "stat"},
+		),
+		refreshFailedCounter: prometheus.NewCounter(prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "analytics", Name: "refresh_failures_total", Help: "Total number of failed analytics refreshes"}),
+	}, nil
+}
+
+// Run 启动定期刷新任务, 启动时立即刷新一次.
+func (e *Exporter) Run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.options.interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(e.ctx, e.options.timeout)
+		if err := e.Refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			e.refreshFailedCounter.Inc()
+			level.Error(e.logger).Log("描述", "刷新报警统计指标失败", "err", err)
+		}
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-e.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop 停止刷新任务.
+func (e *Exporter) Stop() {
+	e.cancel()
+	<-e.done
+}
+
+// Refresh 从数据库中读取统计窗口内的报警统计并更新指标, 失败时保留上一次的指标.
+func (e *Exporter) Refresh(ctx context.Context) error {
+	now := time.Now()
+	type groupStats struct {
+		by      string
+		resolve []storage.ResolveStats
+		fired   []storage.FiringCount
+		open    []storage.OpenStats
+	}
+
+	stats := make([]groupStats, 0, len(e.options.groupBy))
+	for _, by := range e.options.groupBy {
+		q := storage.AnalyticsQuery{By: by, Since: now.Add(-e.options.window)}
+		s := groupStats{by: by}
+		var err error
+		if s.resolve, err = e.analyzer.ResolveStats(ctx, q); err != nil {
+			return err
+		}
+		// 周期与统计窗口相同时, 窗口最多跨越两个周期.
+		if s.fired, err = e.analyzer.FiringCounts(ctx, q, e.options.window); err != nil {
+			return err
+		}
+		if s.open, err = e.analyzer.OpenStats(ctx, q); err != nil {
+			return err
+		}
+		stats = append(stats, s)
+	}
+	flapping, err := e.analyzer.Flapping(ctx, storage.AnalyticsQuery{By: "alertname", Since: now.Add(-e.options.window)}, e.options.top)
+	if err != nil {
+		return err
+	}
+
+	// 全部查询成功后再更新指标, 避免指标部分更新; 重置指标以删除不再出现的分组.
+	e.resolveDurationGauge.Reset()
+	e.firedAlertsGauge.Reset()
+	e.openAlertsGauge.Reset()
+	e.openAgeGauge.Reset()
+	e.flappingCyclesGauge.Reset()
+	for _, s := range stats {
+		for _, r := range s.resolve {
+			e.resolveDurationGauge.WithLabelValues(s.by, r.Group, "mean").Set(r.Mean.Seconds())
+			e.resolveDurationGauge.WithLabelValues(s.by, r.Group, "p90").Set(r.P90.Seconds())
+		}
+		for _, f := range s.fired {
+			e.firedAlertsGauge.WithLabelValues(s.by, f.Group).Add(float64(f.Alerts))
+		}
+		for _, o := range s.open {
+			e.openAlertsGauge.WithLabelValues(s.by, o.Group).Set(float64(o.Alerts))
+			e.openAgeGauge.WithLabelValues(s.by, o.Group, "mean").Set(o.Mean.Seconds())
+			e.openAgeGauge.WithLabelValues(s.by, o.Group, "max").Set(o.Oldest.Seconds())
+		}
+	}
+	for _, f := range flapping {
+		e.flappingCyclesGauge.WithLabelValues(f.Tenant, f.Fingerprint, f.Group).Set(float64(f.Cycles))
+	}
+	return nil
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.resolveDurationGauge.Describe(ch)
+	e.firedAlertsGauge.Describe(ch)
+	e.flappingCyclesGauge.Describe(ch)
+	e.openAlertsGauge.Describe(ch)
+	e.openAgeGauge.Describe(ch)
+	e.refreshFailedCounter.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.resolveDurationGauge.Collect(ch)
+	e.firedAlertsGauge.Collect(ch)
+	e.flappingCyclesGauge.Collect(ch)
+	e.openAlertsGauge.Collect(ch)
+	e.openAgeGauge.Collect(ch)
+	e.refreshFailedCounter.Collect(ch)
+}
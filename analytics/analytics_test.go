@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"alert2pg/storage"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAnalyzer struct {
+	err     error
+	queries []storage.AnalyticsQuery
+}
+
+func (f *fakeAnalyzer) ResolveStats(_ context.Context, q storage.AnalyticsQuery) ([]storage.ResolveStats, error) {
+	f.queries = append(f.queries, q)
+	return []storage.ResolveStats{{Group: q.By + "-a", Alerts: 3, Mean: 90 * time.Second, P90: 5 * time.Minute}}, f.err
+}
+
+func (f *fakeAnalyzer) FiringCounts(_ context.Context, q storage.AnalyticsQuery, period time.Duration) ([]storage.FiringCount, error) {
+	return []storage.FiringCount{
+		{Group: q.By + "-a", Period: time.Unix(0, 0), Alerts: 2},
+		{Group: q.By + "-a", Period: time.Unix(0, 0).Add(period), Alerts: 3},
+	}, nil
+}
+
+func (f *fakeAnalyzer) Flapping(_ context.Context, q storage.AnalyticsQuery, limit int) ([]storage.FlappingStats, error) {
+	// 不同租户的报警可能具有相同的 fingerprint.
+	return []storage.FlappingStats{
+		{Tenant: "team-a", Fingerprint: "fp1", Group: "HighLoad", Cycles: 7},
+		{Tenant: "team-b", Fingerprint: "fp1", Group: "HighLoad", Cycles: 3},
+	}, nil
+}
+
+func (f *fakeAnalyzer) OpenStats(_ context.Context, q storage.AnalyticsQuery) ([]storage.OpenStats, error) {
+	return []storage.OpenStats{{Group: q.By + "-a", Alerts: 4, Mean: time.Minute, Oldest: time.Hour}}, nil
+}
+
+func TestExporter_Refresh(t *testing.T) {
+	f := &fakeAnalyzer{}
+	e, err := New(f, nil, WithGroupBy([]string{"alertname", "cluster"}), WithWindow(time.Hour))
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, e.Refresh(context.Background()))
+	require.Len(t, f.queries, 2)
+	require.Equal(t, "cluster", f.queries[1].By)
+	require.WithinDuration(t, start.Add(-time.Hour), f.queries[0].Since, time.Second)
+
+	expected := `
+# HELP alert2pg_analytics_fired_alerts Number of alerts started within the window
+# TYPE alert2pg_analytics_fired_alerts gauge
+alert2pg_analytics_fired_alerts{by="alertname",group="alertname-a"} 5
+alert2pg_analytics_fired_alerts{by="cluster",group="cluster-a"} 5
+# HELP alert2pg_analytics_flapping_cycles Number of firing/resolved cycles within the window of the most flapping alerts
+# TYPE alert2pg_analytics_flapping_cycles gauge
+alert2pg_analytics_flapping_cycles{alertname="HighLoad",fingerprint="fp1",tenant="team-a"} 7
+alert2pg_analytics_flapping_cycles{alertname="HighLoad",fingerprint="fp1",tenant="team-b"} 3
+# HELP alert2pg_analytics_open_age_seconds Age of currently firing alerts
+# TYPE alert2pg_analytics_open_age_seconds gauge
+alert2pg_analytics_open_age_seconds{by="alertname",group="alertname-a",stat="max"} 3600
+alert2pg_analytics_open_age_seconds{by="alertname",group="alertname-a",stat="mean"} 60
+alert2pg_analytics_open_age_seconds{by="cluster",group="cluster-a",stat="max"} 3600
+alert2pg_analytics_open_age_seconds{by="cluster",group="cluster-a",stat="mean"} 60
+# HELP alert2pg_analytics_resolve_duration_seconds Time to resolve of alerts started within the window
+# TYPE alert2pg_analytics_resolve_duration_seconds gauge
+alert2pg_analytics_resolve_duration_seconds{by="alertname",group="alertname-a",stat="mean"} 90
+alert2pg_analytics_resolve_duration_seconds{by="alertname",group="alertname-a",stat="p90"} 300
+alert2pg_analytics_resolve_duration_seconds{by="cluster",group="cluster-a",stat="mean"} 90
+alert2pg_analytics_resolve_duration_seconds{by="cluster",group="cluster-a",stat="p90"} 300
+`
+	names := []string{
+		"alert2pg_analytics_fired_alerts",
+		"alert2pg_analytics_flapping_cycles",
+		"alert2pg_analytics_open_age_seconds",
+		"alert2pg_analytics_resolve_duration_seconds",
+	}
+	require.NoError(t, testutil.CollectAndCompare(e, strings.NewReader(expected), names...))
+
+	// 查询失败时保留上一次的指标.
+	f.err = errors.New("connection refused")
+	require.Error(t, e.Refresh(context.Background()))
+	require.NoError(t, testutil.CollectAndCompare(e, strings.NewReader(expected), names...))
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	_, err := New(&fakeAnalyzer{}, nil, WithGroupBy(nil))
+	require.Error(t, err)
+	_, err = New(&fakeAnalyzer{}, nil, WithTop(0))
+	require.Error(t, err)
+}
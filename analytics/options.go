@@ -0,0 +1,59 @@
+package analytics
+
+import "time"
+
+var defaultOptions = Options{
+	interval: 5 * time.Minute,
+	window:   24 * time.Hour,
+	groupBy:  []string{"alertname", "cluster", "service"},
+	top:      10,
+	timeout:  30 * time.Second,
+}
+
+type Options struct {
+	interval time.Duration // 刷新统计指标的时间间隔
+	window   time.Duration // 统计窗口, 统计开始时间在窗口内的报警
+	groupBy  []string      // 分组统计的标签
+	top      int           // 循环次数最多的报警数量
+	timeout  time.Duration // 单次刷新的超时时间
+}
+
+type Option interface {
+	apply(*Options)
+}
+
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+func WithInterval(interval time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.interval = interval
+	})
+}
+
+func WithWindow(window time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.window = window
+	})
+}
+
+func WithGroupBy(labels []string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.groupBy = labels
+	})
+}
+
+func WithTop(top int) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.top = top
+	})
+}
+
+func WithTimeout(timeout time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.timeout = timeout
+	})
+}
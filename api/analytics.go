@@ -0,0 +1,181 @@
+package api
+
+import (
+	"alert2pg/pkg/matcher"
+	"alert2pg/storage"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultWindow = 24 * time.Hour
+	defaultPeriod = time.Hour
+	defaultTop    = 10
+	maxPeriods    = 10000
+)
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type resolveStats struct {
+	Group       string  `json:"group"`
+	Alerts      int64   `json:"alerts"`
+	MeanSeconds float64 `json:"meanSeconds"`
+	P90Seconds  float64 `json:"p90Seconds"`
+}
+
+type firingCount struct {
+	Group  string    `json:"group"`
+	Period time.Time `json:"period"`
+	Alerts int64     `json:"alerts"`
+}
+
+type flappingStats struct {
+	Tenant      string `json:"tenant,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+	Group       string `json:"group"`
+	Cycles      int64  `json:"cycles"`
+}
+
+type openStats struct {
+	Group         string  `json:"group"`
+	Alerts        int64   `json:"alerts"`
+	MeanSeconds   float64 `json:"meanSeconds"`
+	OldestSeconds float64 `json:"oldestSeconds"`
+}
+
+// mttr 按分组统计 Resolved 报警的平均及 P90 恢复时长.
+func (a *API) mttr(w http.ResponseWriter, r *http.Request) int {
+	q, err := parseAnalyticsQuery(r)
+	if err != nil {
+		return a.error(w, http.StatusBadRequest, err)
+	}
+	stats, err := a.analyzer.ResolveStats(r.Context(), q)
+	if err != nil {
+		return a.internalError(w, "无法统计报警恢复时长", err)
+	}
+	resp := make([]resolveStats, 0, len(stats))
+	for _, s := range stats {
+		resp = append(resp, resolveStats{Group: s.Group, Alerts: s.Alerts, MeanSeconds: s.Mean.Seconds(), P90Seconds: s.P90.Seconds()})
+	}
+	return a.respond(w, resp)
+}
+
+// firing 按分组及周期统计触发的报警数量, period 参数指定统计周期, 默认 1h.
+func (a *API) firing(w http.ResponseWriter, r *http.Request) int {
+	q, err := parseAnalyticsQuery(r)
+	if err != nil {
+		return a.error(w, http.StatusBadRequest, err)
+	}
+	period := defaultPeriod
+	if s := r.URL.Query().Get("period"); s != "" {
+		d, err := model.ParseDuration(s)
+		if err != nil || time.Duration(d) < time.Minute {
+			return a.error(w, http.StatusBadRequest, fmt.Errorf("无效的 period 参数, 最小为 1m: %s", s))
+		}
+		period = time.Duration(d)
+	}
+	until := q.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+	if until.Sub(q.Since)/period > maxPeriods {
+		return a.error(w, http.StatusBadRequest, fmt.Errorf("统计周期数量超过 %d, 请增大 period 或缩小时间范围", maxPeriods))
+	}
+
+	counts, err := a.analyzer.FiringCounts(r.Context(), q, period)
+	if err != nil {
+		return a.internalError(w, "无法统计报警数量", err)
+	}
+	resp := make([]firingCount, 0, len(counts))
+	for _, c := range counts {
+		resp = append(resp, firingCount{Group: c.Group, Period: c.Period.UTC(), Alerts: c.Alerts})
+	}
+	return a.respond(w, resp)
+}
+
+// flapping 返回统计窗口内 Firing/Resolved 循环次数最多的报警, limit 参数指定数量, 默认 10.
+func (a *API) flapping(w http.ResponseWriter, r *http.Request) int {
+	q, err := parseAnalyticsQuery(r)
+	if err != nil {
+		return a.error(w, http.StatusBadRequest, err)
+	}
+	limit := defaultTop
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > maxLimit {
+			return a.error(w, http.StatusBadRequest, fmt.Errorf("无效的 limit 参数, 取值范围为 1-%d: %s", maxLimit, s))
+		}
+	}
+	stats, err := a.analyzer.Flapping(r.Context(), q, limit)
+	if err != nil {
+		return a.internalError(w, "无法统计报警循环次数", err)
+	}
+	resp := make([]flappingStats, 0, len(stats))
+	for _, s := range stats {
+		resp = append(resp, flappingStats{Tenant: s.Tenant, Fingerprint: s.Fingerprint, Group: s.Group, Cycles: s.Cycles})
+	}
+	return a.respond(w, resp)
+}
+
+// open 按分组统计当前 Firing 报警的数量及持续时长.
+func (a *API) open(w http.ResponseWriter, r *http.Request) int {
+	q, err := parseAnalyticsQuery(r)
+	if err != nil {
+		return a.error(w, http.StatusBadRequest, err)
+	}
+	stats, err := a.analyzer.OpenStats(r.Context(), q)
+	if err != nil {
+		return a.internalError(w, "无法统计 Firing 报警", err)
+	}
+	resp := make([]openStats, 0, len(stats))
+	for _, s := range stats {
+		resp = append(resp, openStats{Group: s.Group, Alerts: s.Alerts, MeanSeconds: s.Mean.Seconds(), OldestSeconds: s.Oldest.Seconds()})
+	}
+	return a.respond(w, resp)
+}
+
+// parseAnalyticsQuery 解析统计参数: by 分组标签(默认 alertname), since, until 及 filter, since 默认为 24 小时前.
+func parseAnalyticsQuery(r *http.Request) (storage.AnalyticsQuery, error) {
+	values := r.URL.Query()
+	q := storage.AnalyticsQuery{By: values.Get("by")}
+	if q.By == "" {
+		q.By = "alertname"
+	}
+	if !labelNameRE.MatchString(q.By) {
+		return q, fmt.Errorf("无效的 by 参数: %s", q.By)
+	}
+
+	var err error
+	if q.Since, err = parseTime(values.Get("since")); err != nil {
+		return q, fmt.Errorf("无效的 since 参数: %w", err)
+	}
+	if q.Until, err = parseTime(values.Get("until")); err != nil {
+		return q, fmt.Errorf("无效的 until 参数: %w", err)
+	}
+	if q.Since.IsZero() {
+		q.Since = time.Now().Add(-defaultWindow)
+	}
+	if !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return q, errors.New("until 必须晚于 since")
+	}
+
+	for _, s := range values["filter"] {
+		ms, err := matcher.Parse(s)
+		if err != nil {
+			return q, err
+		}
+		q.Matchers = append(q.Matchers, ms...)
+	}
+	return q, nil
+}
+
+func (a *API) internalError(w http.ResponseWriter, msg string, err error) int {
+	level.Error(a.logger).Log("消息", msg, "错误详情", err)
+	return a.error(w, http.StatusInternalServerError, errors.New(msg))
+}
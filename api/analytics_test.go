@@ -0,0 +1,93 @@
+package api
+
+import (
+	"alert2pg/pkg/matcher"
+	"alert2pg/storage"
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAnalyzer 返回固定的统计结果, 并记录最后一次统计条件.
+type fakeAnalyzer struct {
+	fakeQuerier
+	last   storage.AnalyticsQuery
+	period time.Duration
+	limit  int
+}
+
+func (f *fakeAnalyzer) ResolveStats(_ context.Context, q storage.AnalyticsQuery) ([]storage.ResolveStats, error) {
+	f.last = q
+	return []storage.ResolveStats{{Group: "HighLoad", Alerts: 3, Mean: 90 * time.Second, P90: 5 * time.Minute}}, nil
+}
+
+func (f *fakeAnalyzer) FiringCounts(_ context.Context, q storage.AnalyticsQuery, period time.Duration) ([]storage.FiringCount, error) {
+	f.last, f.period = q, period
+	return []storage.FiringCount{{Group: "HighLoad", Period: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), Alerts: 2}}, nil
+}
+
+func (f *fakeAnalyzer) Flapping(_ context.Context, q storage.AnalyticsQuery, limit int) ([]storage.FlappingStats, error) {
+	f.last, f.limit = q, limit
+	return []storage.FlappingStats{{Tenant: "team-a", Fingerprint: "fp1", Group: "HighLoad", Cycles: 7}}, nil
+}
+
+func (f *fakeAnalyzer) OpenStats(_ context.Context, q storage.AnalyticsQuery) ([]storage.OpenStats, error) {
+	f.last = q
+	return []storage.OpenStats{{Group: "HighLoad", Alerts: 4, Mean: time.Minute, Oldest: time.Hour}}, nil
+}
+
+func TestAnalytics(t *testing.T) {
+	f := &fakeAnalyzer{}
+	a, err := New(f, nil)
+	require.NoError(t, err)
+
+	var mttr []resolveStats
+	values := url.Values{}
+	values.Set("by", "cluster")
+	values.Set("since", "2025-07-01T00:00:00Z")
+	values.Add("filter", `{severity=~"crit|warn"}`)
+	require.Equal(t, http.StatusOK, get(t, a, "/api/v1/analytics/mttr?"+values.Encode(), &mttr))
+	require.Equal(t, []resolveStats{{Group: "HighLoad", Alerts: 3, MeanSeconds: 90, P90Seconds: 300}}, mttr)
+	require.Equal(t, storage.AnalyticsQuery{
+		By:       "cluster",
+		Since:    time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+		Matchers: matcher.MustParse(`{severity=~"crit|warn"}`),
+	}, f.last)
+
+	var firing []firingCount
+	start := time.Now()
+	require.Equal(t, http.StatusOK, get(t, a, "/api/v1/analytics/firing?period=1d", &firing))
+	require.Equal(t, 24*time.Hour, f.period)
+	require.Equal(t, "alertname", f.last.By)
+	require.WithinDuration(t, start.Add(-defaultWindow), f.last.Since, time.Second)
+	require.Equal(t, int64(2), firing[0].Alerts)
+
+	var flapping []flappingStats
+	require.Equal(t, http.StatusOK, get(t, a, "/api/v1/analytics/flapping", &flapping))
+	require.Equal(t, defaultTop, f.limit)
+	require.Equal(t, []flappingStats{{Tenant: "team-a", Fingerprint: "fp1", Group: "HighLoad", Cycles: 7}}, flapping)
+
+	var open []openStats
+	require.Equal(t, http.StatusOK, get(t, a, "/api/v1/analytics/open", &open))
+	require.Equal(t, []openStats{{Group: "HighLoad", Alerts: 4, MeanSeconds: 60, OldestSeconds: 3600}}, open)
+
+	for _, path := range []string{
+		"/api/v1/analytics/mttr?by=" + url.QueryEscape("a-b"),
+		"/api/v1/analytics/mttr?since=2025-07-02T00:00:00Z&until=2025-07-01T00:00:00Z",
+		"/api/v1/analytics/firing?period=1s",
+		"/api/v1/analytics/firing?period=1m&since=2000-01-01T00:00:00Z",
+		"/api/v1/analytics/flapping?limit=0",
+		"/api/v1/analytics/open?filter=" + url.QueryEscape(`{a=~"("}`),
+	} {
+		require.Equal(t, http.StatusBadRequest, get(t, a, path, nil), path)
+	}
+}
+
+func TestAnalytics_Unsupported(t *testing.T) {
+	a, _ := newTestAPI(t)
+	require.Equal(t, http.StatusNotFound, get(t, a, "/api/v1/analytics/mttr", nil))
+}
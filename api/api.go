@@ -0,0 +1,317 @@
+// Package api 提供只读的 HTTP 查询接口, 用于查询数据库中存储的报警信息.
+package api
+
+import (
+	"alert2pg/analytics"
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"alert2pg/pkg/tenant"
+	"alert2pg/storage"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	historyLimit = 100
+)
+
+// Querier 报警查询接口, 由 storage.Postgres 实现.
+type Querier interface {
+	QueryAlerts(ctx context.Context, q storage.AlertQuery) ([]storage.StoredAlert, error)
+	GetAlert(ctx context.Context, id int) (storage.StoredAlert, error)
+}
+
+// API 报警查询接口的 HTTP 处理器.
+type API struct {
+	r        *mux.Router
+	querier  Querier
+	analyzer analytics.Analyzer
+	options  Options
+	logger   log.Logger
+
+	requestHistogram *prometheus.HistogramVec
+}
+
+func New(querier Querier, logger log.Logger, opts ...Option) (*API, error) {
+	if querier == nil {
+		return nil, fmt.Errorf("空指针: querier")
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	a := &API{
+		r:       mux.NewRouter(),
+		querier: querier,
+		logger:  logger,
+		requestHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "alert2pg",
+				Subsystem: "api",
+				Name:      "request_duration_seconds",
+				Help:      "Duration of query API requests in seconds",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"handler", "code"},
+		),
+	}
+	for _, opt := range opts {
+		opt.apply(&a.options)
+	}
+	a.r.HandleFunc("/api/v1/alerts", a.instrument("alerts", a.listAlerts)).Methods("GET")
+	a.r.HandleFunc("/api/v1/alerts/{id:[0-9]+}", a.instrument("alert", a.getAlert)).Methods("GET")
+
+	// 报警统计接口.
+	if analyzer, ok := querier.(analytics.Analyzer); ok {
+		a.analyzer = analyzer
+		a.r.HandleFunc("/api/v1/analytics/mttr", a.instrument("mttr", a.mttr)).Methods("GET")
+		a.r.HandleFunc("/api/v1/analytics/firing", a.instrument("firing", a.firing)).Methods("GET")
+		a.r.HandleFunc("/api/v1/analytics/flapping", a.instrument("flapping", a.flapping)).Methods("GET")
+		a.r.HandleFunc("/api/v1/analytics/open", a.instrument("open", a.open)).Methods("GET")
+	}
+	return a, nil
+}
+
+// ServeHTTP 实现 http.Handler 接口.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.r.ServeHTTP(w, r)
+}
+
+// storedAlert 报警信息的响应格式, 报警字段与 alert.Alert 的 JSON 格式一致.
+type storedAlert struct {
+	ID int `json:"id"`
+	alert.Alert
+}
+
+// MarshalJSON 合并 ID 与 alert.Alert 的 JSON 字段.
+func (s storedAlert) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(s.Alert)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fmt.Sprintf(`{"id":%d,`, s.ID)), data[1:]...), nil
+}
+
+type listResponse struct {
+	Alerts     []storedAlert `json:"alerts"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+type alertResponse struct {
+	storedAlert
+	History []storedAlert `json:"history"`
+}
+
+// MarshalJSON 在报警信息后追加 history 字段.
+func (r alertResponse) MarshalJSON() ([]byte, error) {
+	data, err := r.storedAlert.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	history, err := json.Marshal(r.History)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data[:len(data)-1], `,"history":`...)
+	data = append(data, history...)
+	return append(data, '}'), nil
+}
+
+// listAlerts 按条件分页查询报警, 结果按 ID 倒序排列.
+func (a *API) listAlerts(w http.ResponseWriter, r *http.Request) int {
+	q, err := parseQuery(r)
+	if err != nil {
+		return a.error(w, http.StatusBadRequest, err)
+	}
+
+	// 多查询一条用于判断是否存在下一页.
+	limit := q.Limit
+	q.Limit++
+	alerts, err := a.querier.QueryAlerts(r.Context(), q)
+	if err != nil {
+		level.Error(a.logger).Log("消息", "无法查询报警", "错误详情", err)
+		return a.error(w, http.StatusInternalServerError, errors.New("无法查询报警"))
+	}
+
+	resp := listResponse{Alerts: toResponse(alerts)}
+	if len(alerts) > limit {
+		resp.Alerts = resp.Alerts[:limit]
+		resp.NextCursor = encodeCursor(resp.Alerts[limit-1].ID)
+	}
+	return a.respond(w, resp)
+}
+
+// getAlert 返回指定 ID 的报警, history 为相同 fingerprint 的其他报警记录.
+func (a *API) getAlert(w http.ResponseWriter, r *http.Request) int {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return a.error(w, http.StatusBadRequest, fmt.Errorf("无效的报警 ID: %w", err))
+	}
+
+	stored, err := a.querier.GetAlert(r.Context(), id)
+	if errors.Is(err, storage.ErrAlertNotFound) {
+		return a.error(w, http.StatusNotFound, err)
+	}
+	if err != nil {
+		level.Error(a.logger).Log("消息", "无法查询报警", "id", id, "错误详情", err)
+		return a.error(w, http.StatusInternalServerError, errors.New("无法查询报警"))
+	}
+
+	history, err := a.querier.QueryAlerts(r.Context(), storage.AlertQuery{Fingerprint: stored.Alert.Fingerprint, Limit: historyLimit + 1})
+	if err != nil {
+		level.Error(a.logger).Log("消息", "无法查询报警历史", "id", id, "错误详情", err)
+		return a.error(w, http.StatusInternalServerError, errors.New("无法查询报警历史"))
+	}
+	resp := alertResponse{storedAlert: storedAlert{ID: stored.ID, Alert: stored.Alert}, History: make([]storedAlert, 0, len(history))}
+	for _, h := range toResponse(history) {
+		if h.ID != stored.ID && len(resp.History) < historyLimit {
+			resp.History = append(resp.History, h)
+		}
+	}
+	return a.respond(w, resp)
+}
+
+// parseQuery 解析查询参数.
+func parseQuery(r *http.Request) (storage.AlertQuery, error) {
+	values := r.URL.Query()
+	q := storage.AlertQuery{
+		Status:      values.Get("status"),
+		Fingerprint: values.Get("fingerprint"),
+		Receiver:    values.Get("receiver"),
+		Limit:       defaultLimit,
+	}
+
+	switch q.Status {
+	case "", alert.Firing, alert.Resolved:
+	default:
+		return q, fmt.Errorf("无效的报警状态: %s", q.Status)
+	}
+
+	var err error
+	if q.Since, err = parseTime(values.Get("since")); err != nil {
+		return q, fmt.Errorf("无效的 since 参数: %w", err)
+	}
+	if q.Until, err = parseTime(values.Get("until")); err != nil {
+		return q, fmt.Errorf("无效的 until 参数: %w", err)
+	}
+
+	if s := values.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 || q.Limit > maxLimit {
+			return q, fmt.Errorf("无效的 limit 参数, 取值范围为 1-%d: %s", maxLimit, s)
+		}
+	}
+	if s := values.Get("cursor"); s != "" {
+		if q.After, err = decodeCursor(s); err != nil {
+			return q, err
+		}
+	}
+
+	// 多个 filter 参数的匹配条件需全部满足.
+	for _, s := range values["filter"] {
+		ms, err := matcher.Parse(s)
+		if err != nil {
+			return q, err
+		}
+		q.Matchers = append(q.Matchers, ms...)
+	}
+	return q, nil
+}
+
+// parseTime 解析 RFC3339 格式或 Unix 时间戳(秒).
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(sec*float64(time.Second))).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// encodeCursor 将分页位置编码为不透明的游标.
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(s string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的游标: %s", s)
+	}
+	id, err := strconv.Atoi(string(data))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("无效的游标: %s", s)
+	}
+	return id, nil
+}
+
+func toResponse(alerts []storage.StoredAlert) []storedAlert {
+	rlt := make([]storedAlert, 0, len(alerts))
+	for _, a := range alerts {
+		rlt = append(rlt, storedAlert{ID: a.ID, Alert: a.Alert})
+	}
+	return rlt
+}
+
+func (a *API) respond(w http.ResponseWriter, v any) int {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		level.Error(a.logger).Log("消息", "无法写入响应", "错误详情", err)
+	}
+	return http.StatusOK
+}
+
+func (a *API) error(w http.ResponseWriter, code int, err error) int {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	return code
+}
+
+// instrument 记录请求耗时, 启用多租户时将请求所属租户写入请求的 context.
+func (a *API) instrument(handler string, f func(http.ResponseWriter, *http.Request) int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var code int
+		if id, err := a.tenant(r); err != nil {
+			code = a.error(w, http.StatusUnauthorized, err)
+		} else {
+			if id != "" {
+				r = r.WithContext(tenant.WithContext(r.Context(), id))
+			}
+			code = f(w, r)
+		}
+		a.requestHistogram.WithLabelValues(handler, strconv.Itoa(code)).Observe(time.Since(start).Seconds())
+	}
+}
+
+// tenant 返回查询请求所属租户, 未启用多租户时返回空字符串.
+func (a *API) tenant(r *http.Request) (string, error) {
+	if a.options.tenants == nil {
+		return "", nil
+	}
+	return a.options.tenants.Query(r)
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (a *API) Describe(ch chan<- *prometheus.Desc) {
+	a.requestHistogram.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (a *API) Collect(ch chan<- prometheus.Metric) {
+	a.requestHistogram.Collect(ch)
+}
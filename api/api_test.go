@@ -0,0 +1,184 @@
+package api
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"alert2pg/pkg/tenant"
+	"alert2pg/storage"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQuerier 按 ID 倒序返回报警, 仅实现分页及 fingerprint 过滤, 并记录最后一次查询条件及租户.
+type fakeQuerier struct {
+	alerts     []storage.StoredAlert
+	last       storage.AlertQuery
+	lastTenant string
+}
+
+func (f *fakeQuerier) QueryAlerts(ctx context.Context, q storage.AlertQuery) ([]storage.StoredAlert, error) {
+	f.last = q
+	f.lastTenant, _ = tenant.FromContext(ctx)
+	rlt := make([]storage.StoredAlert, 0)
+	for i := len(f.alerts) - 1; i >= 0; i-- {
+		a := f.alerts[i]
+		if (q.After > 0 && a.ID >= q.After) || (q.Fingerprint != "" && a.Alert.Fingerprint != q.Fingerprint) {
+			continue
+		}
+		if q.Limit > 0 && len(rlt) == q.Limit {
+			break
+		}
+		rlt = append(rlt, a)
+	}
+	return rlt, nil
+}
+
+func (f *fakeQuerier) GetAlert(_ context.Context, id int) (storage.StoredAlert, error) {
+	for _, a := range f.alerts {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return storage.StoredAlert{}, storage.ErrAlertNotFound
+}
+
+func newTestAPI(t *testing.T) (*API, *fakeQuerier) {
+	q := &fakeQuerier{}
+	start := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 5; i++ {
+		a := alert.DefaultAlert()
+		a.Fingerprint = "fp1"
+		if i%2 == 0 {
+			a.Fingerprint = "fp2"
+		}
+		a.Status = alert.Resolved
+		a.StartsAt = start.Add(time.Duration(i) * time.Hour)
+		a.Labels = map[string]string{"alertname": "Test", "severity": "critical"}
+		a.Annotations = map[string]string{"summary": "test"}
+		q.alerts = append(q.alerts, storage.StoredAlert{ID: i, Alert: a})
+	}
+	a, err := New(q, nil)
+	require.NoError(t, err)
+	return a, q
+}
+
+func get(t *testing.T, a *API, path string, v any) int {
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if v != nil && rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+	return rec.Code
+}
+
+func TestListAlerts_Pagination(t *testing.T) {
+	a, _ := newTestAPI(t)
+
+	ids := make([]int, 0)
+	path := "/api/v1/alerts?limit=2"
+	for range 3 {
+		var resp struct {
+			Alerts []struct {
+				ID     int               `json:"id"`
+				Status string            `json:"status"`
+				Labels map[string]string `json:"labels"`
+			} `json:"alerts"`
+			NextCursor string `json:"nextCursor"`
+		}
+		require.Equal(t, http.StatusOK, get(t, a, path, &resp))
+		for _, al := range resp.Alerts {
+			require.Equal(t, alert.Resolved, al.Status)
+			require.Equal(t, "critical", al.Labels["severity"])
+			ids = append(ids, al.ID)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		path = "/api/v1/alerts?limit=2&cursor=" + resp.NextCursor
+	}
+	require.Equal(t, []int{5, 4, 3, 2, 1}, ids)
+}
+
+func TestListAlerts_Query(t *testing.T) {
+	a, q := newTestAPI(t)
+
+	values := url.Values{}
+	values.Set("status", "firing")
+	values.Set("since", "2025-07-01T00:00:00Z")
+	values.Set("until", "1751414400")
+	values.Set("receiver", "default")
+	values.Add("filter", `alertname="Test"`)
+	values.Add("filter", `{severity=~"crit.*|warn", team!~"a\"b"}`)
+	require.Equal(t, http.StatusOK, get(t, a, "/api/v1/alerts?"+values.Encode(), nil))
+
+	require.Equal(t, storage.AlertQuery{
+		Status:   alert.Firing,
+		Since:    time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+		Until:    time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC),
+		Receiver: "default",
+		Matchers: matcher.MustParse(`{alertname="Test", severity=~"crit.*|warn", team!~"a\"b"}`),
+		Limit:    defaultLimit + 1,
+	}, q.last)
+}
+
+func TestListAlerts_BadRequest(t *testing.T) {
+	a, _ := newTestAPI(t)
+	for _, query := range []string{
+		"status=pending",
+		"since=yesterday",
+		"limit=0",
+		"limit=1001",
+		"cursor=%25%25",
+		"filter=" + url.QueryEscape(`{severity="critical"`),
+		"filter=" + url.QueryEscape(`severity=~"("`),
+	} {
+		require.Equal(t, http.StatusBadRequest, get(t, a, "/api/v1/alerts?"+query, nil), query)
+	}
+}
+
+func TestGetAlert(t *testing.T) {
+	a, _ := newTestAPI(t)
+
+	var resp struct {
+		ID          int               `json:"id"`
+		Fingerprint string            `json:"fingerprint"`
+		Annotations map[string]string `json:"annotations"`
+		History     []struct {
+			ID int `json:"id"`
+		} `json:"history"`
+	}
+	require.Equal(t, http.StatusOK, get(t, a, "/api/v1/alerts/3", &resp))
+	require.Equal(t, 3, resp.ID)
+	require.Equal(t, "fp1", resp.Fingerprint)
+	require.Equal(t, "test", resp.Annotations["summary"])
+	require.Len(t, resp.History, 2)
+	require.Equal(t, 5, resp.History[0].ID)
+	require.Equal(t, 1, resp.History[1].ID)
+
+	require.Equal(t, http.StatusNotFound, get(t, a, "/api/v1/alerts/42", nil))
+}
+
+func TestListAlerts_Tenant(t *testing.T) {
+	_, q := newTestAPI(t)
+	resolver, err := tenant.New()
+	require.NoError(t, err)
+	a, err := New(q, nil, WithTenantResolver(resolver))
+	require.NoError(t, err)
+
+	// 未携带租户且未配置默认租户时拒绝查询.
+	require.Equal(t, http.StatusUnauthorized, get(t, a, "/api/v1/alerts", nil))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil)
+	req.Header.Set(tenant.DefaultHeader, "team-a")
+	a.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "team-a", q.lastTenant)
+}
@@ -0,0 +1,25 @@
+package api
+
+import "alert2pg/pkg/tenant"
+
+type Options struct {
+	// 多租户解析器, 配置后仅返回请求所属租户的报警.
+	tenants *tenant.Resolver
+}
+
+type Option interface {
+	apply(*Options)
+}
+
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+// WithTenantResolver 启用多租户, 由 resolver 解析查询请求所属租户.
+func WithTenantResolver(resolver *tenant.Resolver) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.tenants = resolver
+	})
+}
@@ -6,36 +6,125 @@ package buffer
 import (
 	"alert2pg/pkg/alert"
 	"alert2pg/pkg/http"
+	"alert2pg/pkg/matcher"
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"golang.org/x/sync/semaphore"
 )
 
+// ErrQuotaExceeded 租户在 Buffer 中的报警数量超过配额.
+var ErrQuotaExceeded = errors.New("租户报警数量超过配额")
+
+// ErrBufferFull Buffer 中未持久化的报警数量超过上限, 通常是数据库长时间不可用.
+var ErrBufferFull = errors.New("Buffer 中未存储的报警数量超过上限")
+
+// Tenancy 确定从 Alertmanager 同步的报警所属租户, 由 tenant.Resolver 实现.
+type Tenancy interface {
+	// SyncTenant 返回同步的报警所属租户, 无法确定时返回 false, 该报警不参与同步.
+	SyncTenant(a alert.Alert) (string, bool)
+	// Synced 判断租户的报警是否与 Alertmanager 同步, 仅同步的租户的报警会在 Alertmanager 中消失时被标记为 Resolved.
+	Synced(tenant string) bool
+}
+
 type Buffer struct {
 	buffer map[string]*alert.Alert
 	sem    *semaphore.Weighted
 
+	// 各租户在 Buffer 中的报警数量, 用于配额检查.
+	tenants map[string]int
+
+	// 未持久化的报警, Storage 仅读取其中的报警, 不必遍历整个 Buffer.
+	// 报警加入 dirty 时向 unloaded 发送通知, 通道容量为 1, 多次变更合并为一次通知.
+	dirty    map[string]struct{}
+	unloaded chan struct{}
+
 	wg     sync.WaitGroup
 	done   chan struct{}
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	flaps *flapDetector
+
+	// 连续同步失败次数, 同步成功时清零.
+	syncFailures atomic.Int64
+
 	logger log.Logger
 
-	options Options
+	// options 可由 Reload 在运行时修改, reloaded 在修改后关闭并替换, 通知 Sync 及 Gc 任务按新的间隔执行.
+	optionsMu sync.RWMutex
+	options   Options
+	reloaded  chan struct{}
+
+	flappingAlertsGauge prometheus.Gauge
+	tenantAlertsGauge   *prometheus.GaugeVec
+	syncFailuresCounter prometheus.Counter
+}
+
+func New(logger log.Logger, opts ...Option) *Buffer {
+	ctx, cancel := context.WithCancel(context.Background())
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+
+	return &Buffer{
+		buffer:   make(map[string]*alert.Alert),
+		sem:      semaphore.NewWeighted(1),
+		tenants:  make(map[string]int),
+		dirty:    make(map[string]struct{}),
+		unloaded: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		flaps:    newFlapDetector(options.flapWindow, options.flapThreshold),
+		logger:   logger,
+		options:  options,
+		reloaded: make(chan struct{}),
+		flappingAlertsGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "alert2pg",
+			Subsystem: "buffer",
+			Name:      "flapping_alerts",
+			Help:      "Number of alert fingerprints currently flapping",
+		}),
+		tenantAlertsGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "alert2pg",
+			Subsystem: "buffer",
+			Name:      "tenant_alerts",
+			Help:      "Number of alerts in the buffer per tenant",
+		}, []string{"tenant"}),
+		syncFailuresCounter: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "alert2pg",
+			Subsystem: "buffer",
+			Name:      "sync_failures_total",
+			Help:      "Total number of failed synchronizations with Alertmanager",
+		}),
+	}
 }
 
 // Run 启动运行 Buffer Sync 与 Gc 任务.
 func (b *Buffer) Run() {
 	b.wg.Add(2)
-	go b.Sync()
-	go b.Gc()
+	go func() {
+		defer b.wg.Done()
+		b.Sync()
+	}()
+	go func() {
+		defer b.wg.Done()
+		b.Gc()
+	}()
 	b.wg.Wait()
 	close(b.done)
 }
@@ -47,9 +136,59 @@ func (b *Buffer) Stop() {
 	b.sync()
 }
 
+// Reload 在运行时修改 Buffer 配置, 仅 Alertmanager 地址, 同步过滤条件, 同步及回收间隔与报警最大生命周期生效,
+// 抖动检测及多租户配置需重启服务.
+func (b *Buffer) Reload(opts ...Option) {
+	b.optionsMu.Lock()
+	defer b.optionsMu.Unlock()
+
+	for _, opt := range opts {
+		opt.apply(&b.options)
+	}
+	close(b.reloaded)
+	b.reloaded = make(chan struct{})
+}
+
+// opts 返回当前配置及配置修改通知.
+func (b *Buffer) opts() (Options, <-chan struct{}) {
+	b.optionsMu.RLock()
+	defer b.optionsMu.RUnlock()
+	return b.options, b.reloaded
+}
+
 // GetUnloads 获取 Buffer 中所有为持久化到数据库中的报警信息.
 func (b *Buffer) GetUnloads() alert.Alerts {
+	b.Lock(context.Background())
+	defer b.Unlock()
+
+	alerts := make(alert.Alerts, 0, len(b.dirty))
+	for key := range b.dirty {
+		a, ok := b.buffer[key]
+		if !ok || a.Loaded {
+			delete(b.dirty, key)
+			continue
+		}
+		alerts = append(alerts, *a.Clone())
+	}
+	return alerts
+}
+
+// Unloaded 返回未持久化报警的通知通道, 有报警需要写入数据库时可读.
+func (b *Buffer) Unloaded() <-chan struct{} {
+	return b.unloaded
+}
+
+// Select 返回 Buffer 中标签满足匹配条件的报警信息副本.
+func (b *Buffer) Select(ms matcher.Matchers) alert.Alerts {
+	b.Lock(context.Background())
+	defer b.Unlock()
+
 	alerts := make(alert.Alerts, 0)
+	for _, a := range b.buffer {
+		if ms.Matches(a.Labels) {
+			alerts = append(alerts, *a.Clone())
+		}
+	}
 	return alerts
 }
 
@@ -71,14 +210,50 @@ func (b *Buffer) SetLoads(alerts alert.Alerts) {
 	defer b.Unlock()
 
 	for _, a := range alerts {
-		if source, ok := b.buffer[a.Key()]; ok && source.Equal(a) {
+		if source, ok := b.buffer[a.Key()]; ok && stored(*source, a) {
 			source.Loaded = true
 			source.LoadedAt = time.Now()
+			delete(b.dirty, a.Key())
 		}
 	}
 }
 
+// Load 将已持久化的报警信息加入 Buffer 并标记为已加载, 用于服务启动时恢复数据库中的 Firing 报警.
+// Buffer 中已存在的报警不会被覆盖.
+func (b *Buffer) Load(alerts alert.Alerts) {
+	b.Lock(context.Background())
+	defer b.Unlock()
+
+	now := time.Now()
+	for _, a := range alerts {
+		if _, ok := b.buffer[a.Key()]; ok {
+			continue
+		}
+		a.Loaded = true
+		a.LoadedAt = now
+		b.add(&a)
+	}
+}
+
+// Restore 将上次停止时未能持久化的报警加入 Buffer 并标记为未加载, 覆盖 Buffer 中已存在的报警.
+// 未持久化的报警比数据库中的报警更新, Load 不覆盖 Buffer 中已存在的报警, 因此可在 Load 之前调用.
+func (b *Buffer) Restore(alerts alert.Alerts) {
+	b.Lock(context.Background())
+	defer b.Unlock()
+
+	now := time.Now()
+	for _, a := range alerts {
+		if _, ok := b.buffer[a.Key()]; ok {
+			b.remove(a.Key())
+		}
+		a.Loaded = false
+		a.LoadedAt = now
+		b.add(&a)
+	}
+}
+
 // Update 更新 Buffer 中报警信息, 重复报警不会更新标志位.
+// 新报警及报警状态变化时记录一次状态变化, 用于抖动检测.
 func (b *Buffer) Update(ctx context.Context, alerts alert.Alerts) error {
 	if err := b.Lock(ctx); err != nil {
 		level.Error(b.logger).Log("描述", "获取 Buffer 锁失败", "err", err)
@@ -86,36 +261,71 @@ func (b *Buffer) Update(ctx context.Context, alerts alert.Alerts) error {
 	}
 	defer b.Unlock()
 
+	if err := b.checkQuota(alerts); err != nil {
+		return err
+	}
+	if err := b.checkCapacity(alerts); err != nil {
+		return err
+	}
+
+	now := time.Now()
 	for _, a := range alerts {
-		// TODO: 这里存在不安全性, 可能会存在 Map 中不存在的 key.
-		if a.Equal(*b.buffer[a.Key()]) {
+		source, ok := b.buffer[a.Key()]
+		if ok && a.Equal(*source) {
 			// 报警信息相同时
-			b.buffer[a.Key()].LoadedAt = a.LoadedAt
-		} else {
-			// 报警信息不一致时
+			source.LoadedAt = a.LoadedAt
+			continue
+		}
+		// 报警信息不一致时, webhook 推送的报警不包含 Alertmanager 中的状态信息, 沿用已同步的状态.
+		if ok && !a.HasState() {
+			a.SetState(*source)
+		}
+		if !ok || a.Status != source.Status {
+			b.flaps.record(&a, now)
+		}
+		b.flaps.apply(&a, now)
+		if ok {
 			b.buffer[a.Key()] = &a
+			b.markDirty(&a)
+		} else {
+			b.add(&a)
 		}
 	}
+	b.refreshFlapping(now)
 	return nil
 }
 
 func (b *Buffer) Sync() {
-	ticker := time.NewTicker(b.options.syncInterval)
+	options, reloaded := b.opts()
+	ticker := time.NewTicker(options.syncInterval)
 	defer ticker.Stop()
 	for {
 		select {
+		case <-reloaded:
+			options, reloaded = b.opts()
+			ticker.Reset(options.syncInterval)
 		case <-ticker.C:
 			if err := b.sync(); err != nil {
+				b.syncFailures.Add(1)
+				b.syncFailuresCounter.Inc()
 				level.Error(b.logger).Log("描述", "同步 Alertmanager 与 Buffer 中的报警信息失败", "err", err)
+				continue
 			}
+			b.syncFailures.Store(0)
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
+// SyncFailures 返回与 Alertmanager 连续同步失败的次数.
+func (b *Buffer) SyncFailures() int {
+	return int(b.syncFailures.Load())
+}
+
 func (b *Buffer) sync() error {
-	alerts, err := http.GetFiringAlertsFromAlertmanager(b.options.alertmanagerAddr, true, false, false, false)
+	options, _ := b.opts()
+	alerts, err := http.GetFiringAlertsFromAlertmanager(options.alertmanagerAddrs, options.active, options.silenced, options.inhibited, options.unprocessed)
 	if err != nil {
 		return fmt.Errorf("无法同步 Alertmanager 与 Buffer 中的报警信息: %w", err)
 	}
@@ -125,23 +335,46 @@ func (b *Buffer) sync() error {
 
 	set := make(map[string]struct{}, len(alerts))
 	for _, a := range alerts {
+		if a.Status != alert.Firing {
+			continue
+		}
+		if b.options.tenancy != nil {
+			tenant, ok := b.options.tenancy.SyncTenant(a)
+			if !ok {
+				continue
+			}
+			a.Tenant = tenant
+		}
 		set[a.Key()] = struct{}{}
+		// 刷新报警的静默, 抑制及接收者等状态信息.
+		if source, ok := b.buffer[a.Key()]; ok {
+			source.SetState(a)
+			b.markDirty(source)
+		}
 	}
 
+	now := time.Now()
 	for key, a := range b.buffer {
-		if _, ok := set[key]; !ok && a.Status == alert.Firing {
+		if _, ok := set[key]; !ok && a.Status == alert.Firing && b.synced(a) {
 			a.SetResolved()
+			b.flaps.record(a, now)
+			b.flaps.apply(a, now)
+			b.markDirty(a)
 		}
-
 	}
+	b.refreshFlapping(now)
 	return nil
 }
 
 func (b *Buffer) Gc() {
-	ticker := time.NewTicker(b.options.gcInterval)
+	options, reloaded := b.opts()
+	ticker := time.NewTicker(options.gcInterval)
 	defer ticker.Stop()
 	for {
 		select {
+		case <-reloaded:
+			options, reloaded = b.opts()
+			ticker.Reset(options.gcInterval)
 		case <-ticker.C:
 			b.gc()
 		case <-b.ctx.Done():
@@ -150,16 +383,155 @@ func (b *Buffer) Gc() {
 	}
 }
 
-// gc 回收超期报警信息.
+// gc 回收超期报警信息, 并清理抖动检测中统计窗口外的状态变化记录.
+// 状态变化次数低于阈值的报警取消抖动标记, 并重新写入数据库.
 func (b *Buffer) gc() {
+	options, _ := b.opts()
 	b.Lock(context.Background())
 	defer b.Unlock()
 
 	for key, a := range b.buffer {
-		if a.IsExpired(b.options.maxLifetime) {
-			delete(b.buffer, key)
+		if a.IsExpired(options.maxLifetime) {
+			b.remove(key)
 		}
 	}
+
+	if !b.flaps.enabled() {
+		return
+	}
+	now := time.Now()
+	b.refreshFlapping(now)
+	for _, a := range b.buffer {
+		if b.flaps.apply(a, now) {
+			a.Loaded = false
+			a.LoadedAt = now
+			b.markDirty(a)
+		}
+	}
+}
+
+// synced 判断报警是否与 Alertmanager 同步.
+func (b *Buffer) synced(a *alert.Alert) bool {
+	return b.options.tenancy == nil || b.options.tenancy.Synced(a.Tenant)
+}
+
+// add 将新报警加入 Buffer 并更新租户报警数量.
+func (b *Buffer) add(a *alert.Alert) {
+	b.buffer[a.Key()] = a
+	b.markDirty(a)
+	b.tenants[a.Tenant]++
+	b.tenantAlertsGauge.WithLabelValues(a.Tenant).Set(float64(b.tenants[a.Tenant]))
+}
+
+// markDirty 记录未持久化的报警并通知 Storage, 已持久化的报警不做处理.
+func (b *Buffer) markDirty(a *alert.Alert) {
+	if a.Loaded {
+		return
+	}
+	b.dirty[a.Key()] = struct{}{}
+	select {
+	case b.unloaded <- struct{}{}:
+	default:
+	}
+}
+
+// remove 从 Buffer 中删除报警并更新租户报警数量.
+func (b *Buffer) remove(key string) {
+	a, ok := b.buffer[key]
+	if !ok {
+		return
+	}
+	delete(b.buffer, key)
+	delete(b.dirty, key)
+	if b.tenants[a.Tenant]--; b.tenants[a.Tenant] <= 0 {
+		delete(b.tenants, a.Tenant)
+		b.tenantAlertsGauge.DeleteLabelValues(a.Tenant)
+		return
+	}
+	b.tenantAlertsGauge.WithLabelValues(a.Tenant).Set(float64(b.tenants[a.Tenant]))
+}
+
+// stored 判断已存储的报警副本是否与 Buffer 中的报警一致.
+// 获取副本后同步的状态信息或抖动标记发生变化时副本已过期, 报警需要再次存储.
+func stored(source, a alert.Alert) bool {
+	return source.Equal(a) && source.StateEqual(a) &&
+		source.Flapping == a.Flapping && source.Transitions == a.Transitions
+}
+
+// checkQuota 检查加入新报警后各租户的报警数量是否超过配额, 超过时整批报警均不写入.
+func (b *Buffer) checkQuota(alerts alert.Alerts) error {
+	if b.options.tenantQuota <= 0 {
+		return nil
+	}
+	added := make(map[string]int)
+	seen := make(map[string]struct{}, len(alerts))
+	for _, a := range alerts {
+		key := a.Key()
+		if _, ok := b.buffer[key]; ok {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		added[a.Tenant]++
+	}
+	for tenant, n := range added {
+		if b.tenants[tenant]+n > b.options.tenantQuota {
+			return fmt.Errorf("%w: 租户 %q 已有 %d 条报警, 新增 %d 条超过配额 %d", ErrQuotaExceeded, tenant, b.tenants[tenant], n, b.options.tenantQuota)
+		}
+	}
+	return nil
+}
+
+// checkCapacity 检查写入报警后未持久化的报警数量是否超过上限, 超过时整批报警均不写入.
+// 与已有报警相同或已在等待存储的报警不计入新增数量.
+func (b *Buffer) checkCapacity(alerts alert.Alerts) error {
+	options, _ := b.opts()
+	if options.maxUnloaded <= 0 {
+		return nil
+	}
+	n := 0
+	seen := make(map[string]struct{}, len(alerts))
+	for _, a := range alerts {
+		key := a.Key()
+		if _, ok := b.dirty[key]; ok {
+			continue
+		}
+		if source, ok := b.buffer[key]; ok && a.Equal(*source) {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		n++
+	}
+	if n > 0 && len(b.dirty)+n > options.maxUnloaded {
+		return fmt.Errorf("%w: 已有 %d 条未存储的报警, 新增 %d 条超过上限 %d", ErrBufferFull, len(b.dirty), n, options.maxUnloaded)
+	}
+	return nil
+}
+
+// refreshFlapping 清理统计窗口外的状态变化记录并更新抖动报警数量指标.
+func (b *Buffer) refreshFlapping(now time.Time) {
+	if b.flaps.enabled() {
+		b.flappingAlertsGauge.Set(float64(b.flaps.prune(now)))
+	}
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (b *Buffer) Describe(ch chan<- *prometheus.Desc) {
+	b.flappingAlertsGauge.Describe(ch)
+	b.tenantAlertsGauge.Describe(ch)
+	b.syncFailuresCounter.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (b *Buffer) Collect(ch chan<- prometheus.Metric) {
+	b.flappingAlertsGauge.Collect(ch)
+	b.tenantAlertsGauge.Collect(ch)
+	b.syncFailuresCounter.Collect(ch)
 }
 
 // Lock 获取 Buffer 锁, 支持通过 ctx 方式控制获取锁等待的时间.
@@ -0,0 +1,222 @@
+package buffer
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newAlert(fingerprint string, startsAt time.Time, status string) alert.Alert {
+	a := alert.DefaultAlert()
+	a.Fingerprint = fingerprint
+	a.StartsAt = startsAt
+	a.Status = status
+	a.Labels = map[string]string{"alertname": fingerprint}
+	if status == alert.Resolved {
+		a.EndsAt = startsAt.Add(time.Minute)
+	}
+	return a
+}
+
+func key(fingerprint string, startsAt time.Time) string {
+	a := alert.Alert{Fingerprint: fingerprint, StartsAt: startsAt}
+	return a.Key()
+}
+
+func TestBuffer_Flapping(t *testing.T) {
+	b := New(nil, WithFlapping(time.Hour, 4))
+	ctx := context.Background()
+	start := time.Now().Add(-10 * time.Minute)
+
+	// 第一次循环: Firing -> Resolved, 重复推送不计入状态变化.
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", start, alert.Firing)}))
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", start, alert.Firing)}))
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", start, alert.Resolved), newAlert("stable", start, alert.Firing)}))
+	a := b.buffer[key("fp", start)]
+	require.False(t, a.Flapping)
+	require.Equal(t, 2, a.Transitions)
+
+	// 第二次循环达到阈值.
+	second := start.Add(time.Minute)
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", second, alert.Firing)}))
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", second, alert.Resolved)}))
+	a = b.buffer[key("fp", second)]
+	require.True(t, a.Flapping)
+	require.Equal(t, 4, a.Transitions)
+	require.False(t, a.Loaded)
+	require.False(t, b.buffer[key("stable", start)].Flapping)
+	require.Equal(t, 1.0, testutil.ToFloat64(b.flappingAlertsGauge))
+
+	// 状态变化超出统计窗口后取消抖动标记, 报警需要重新写入数据库.
+	b.SetLoads(b.GetUnloads())
+	for fingerprint, times := range b.flaps.transitions {
+		for i := range times {
+			times[i] = times[i].Add(-2 * time.Hour)
+		}
+		b.flaps.transitions[fingerprint] = times
+	}
+	b.gc()
+	a = b.buffer[key("fp", second)]
+	require.False(t, a.Flapping)
+	require.Equal(t, 0, a.Transitions)
+	require.False(t, a.Loaded)
+	require.Equal(t, 0.0, testutil.ToFloat64(b.flappingAlertsGauge))
+	require.Empty(t, b.flaps.transitions)
+}
+
+func TestBuffer_FlappingDisabled(t *testing.T) {
+	b := New(nil, WithFlapping(time.Hour, 0))
+	ctx := context.Background()
+	start := time.Now()
+	for i := range 5 {
+		startsAt := start.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", startsAt, alert.Firing)}))
+		require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", startsAt, alert.Resolved)}))
+	}
+	for _, a := range b.buffer {
+		require.False(t, a.Flapping)
+		require.Zero(t, a.Transitions)
+	}
+	require.Empty(t, b.flaps.transitions)
+}
+
+func TestBuffer_SetLoadsStale(t *testing.T) {
+	b := New(nil)
+	ctx := context.Background()
+	start := time.Now()
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", start, alert.Firing)}))
+
+	// 存储期间同步到新的状态信息, 过期的副本存储成功后报警仍需再次存储.
+	snapshot := b.GetUnloads()
+	state := newAlert("fp", start, alert.Firing)
+	state.State = "suppressed"
+	state.SilencedBy = []string{"silence-1"}
+	b.buffer[key("fp", start)].SetState(state)
+	b.SetLoads(snapshot)
+	unloads := b.GetUnloads()
+	require.Len(t, unloads, 1)
+	require.Equal(t, "suppressed", unloads[0].State)
+
+	// 抖动标记变化同理.
+	snapshot = b.GetUnloads()
+	a := b.buffer[key("fp", start)]
+	a.Flapping, a.Transitions = true, 4
+	b.markDirty(a)
+	b.SetLoads(snapshot)
+	require.Len(t, b.GetUnloads(), 1)
+
+	// 副本与 Buffer 中的报警一致时标记为已存储.
+	b.SetLoads(b.GetUnloads())
+	require.Empty(t, b.GetUnloads())
+	require.Empty(t, b.dirty)
+}
+
+func TestBuffer_TenantQuota(t *testing.T) {
+	b := New(nil, WithTenantQuota(2))
+	ctx := context.Background()
+	start := time.Now()
+
+	tenantAlert := func(tenant, fingerprint string) alert.Alert {
+		a := newAlert(fingerprint, start, alert.Firing)
+		a.Tenant = tenant
+		return a
+	}
+
+	// 不同租户相同 fingerprint 的报警互不覆盖.
+	require.NoError(t, b.Update(ctx, alert.Alerts{tenantAlert("a", "fp1"), tenantAlert("b", "fp1")}))
+	require.Len(t, b.buffer, 2)
+	require.Contains(t, b.buffer, "a/"+key("fp1", start))
+
+	// 超过配额时整批报警均不写入, 其他租户不受影响.
+	err := b.Update(ctx, alert.Alerts{tenantAlert("a", "fp2"), tenantAlert("a", "fp3")})
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.Len(t, b.buffer, 2)
+	require.NoError(t, b.Update(ctx, alert.Alerts{tenantAlert("a", "fp2"), tenantAlert("b", "fp2")}))
+
+	// 已存在报警的状态更新不占用配额.
+	resolved := tenantAlert("a", "fp1")
+	resolved.Status = alert.Resolved
+	resolved.EndsAt = start.Add(time.Minute)
+	require.NoError(t, b.Update(ctx, alert.Alerts{resolved}))
+	require.Equal(t, 2.0, testutil.ToFloat64(b.tenantAlertsGauge.WithLabelValues("a")))
+
+	// 回收报警后释放配额.
+	b.remove(resolved.Key())
+	require.Equal(t, 1, b.tenants["a"])
+	require.NoError(t, b.Update(ctx, alert.Alerts{tenantAlert("a", "fp3")}))
+}
+
+func TestBuffer_MaxUnloaded(t *testing.T) {
+	b := New(nil, WithMaxUnloaded(2))
+	ctx := context.Background()
+	start := time.Now()
+	a := newAlert("fp1", start, alert.Firing)
+
+	// 超过上限时整批报警均不写入.
+	require.NoError(t, b.Update(ctx, alert.Alerts{a, newAlert("fp2", start, alert.Firing)}))
+	err := b.Update(ctx, alert.Alerts{newAlert("fp3", start, alert.Firing)})
+	require.ErrorIs(t, err, ErrBufferFull)
+	require.Len(t, b.buffer, 2)
+
+	// 等待存储的报警重复推送或状态变化不计入新增数量.
+	require.NoError(t, b.Update(ctx, alert.Alerts{a}))
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp1", start, alert.Resolved)}))
+
+	// 存储成功后释放容量, 已存储报警的重复推送不占用容量.
+	b.SetLoads(b.GetUnloads())
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp3", start, alert.Firing), newAlert("fp4", start, alert.Firing)}))
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp1", start, alert.Resolved)}))
+	require.ErrorIs(t, b.Update(ctx, alert.Alerts{newAlert("fp2", start, alert.Resolved)}), ErrBufferFull)
+
+	// 修改上限后立即生效.
+	b.Reload(WithMaxUnloaded(0))
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp2", start, alert.Resolved)}))
+}
+
+func TestBuffer_Reload(t *testing.T) {
+	b := New(nil, WithMaxLifetime(time.Hour), WithGcInterval(time.Hour))
+	start := time.Now()
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newAlert("fp", start, alert.Resolved)}))
+	b.SetLoads(b.GetUnloads())
+
+	b.gc()
+	require.Len(t, b.buffer, 1)
+
+	// 修改最大生命周期后立即生效, 回收任务按新的间隔执行.
+	b.Reload(WithMaxLifetime(0), WithGcInterval(10*time.Millisecond))
+	go b.Run()
+	defer b.Stop()
+	require.Eventually(t, func() bool {
+		return len(b.DeepCopy()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBuffer_Unloaded(t *testing.T) {
+	b := New(nil)
+	ctx := context.Background()
+	start := time.Now()
+	a := newAlert("fp", start, alert.Firing)
+
+	require.NoError(t, b.Update(ctx, alert.Alerts{a, newAlert("other", start, alert.Firing)}))
+	require.Len(t, b.Unloaded(), 1)
+	<-b.Unloaded()
+	require.Len(t, b.GetUnloads(), 2)
+
+	// 存储成功后不再读取, 重复推送不发送通知.
+	b.SetLoads(b.GetUnloads())
+	require.Empty(t, b.dirty)
+	require.NoError(t, b.Update(ctx, alert.Alerts{a}))
+	require.Empty(t, b.Unloaded())
+	require.Empty(t, b.GetUnloads())
+
+	// 报警恢复时重新通知.
+	require.NoError(t, b.Update(ctx, alert.Alerts{newAlert("fp", start, alert.Resolved)}))
+	require.Len(t, b.Unloaded(), 1)
+	unloads := b.GetUnloads()
+	require.Len(t, unloads, 1)
+	require.Equal(t, alert.Resolved, unloads[0].Status)
+}
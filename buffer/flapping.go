@@ -0,0 +1,85 @@
+package buffer
+
+import (
+	"alert2pg/pkg/alert"
+	"time"
+)
+
+// flapDetector 按 fingerprint 记录统计窗口内报警的 Firing/Resolved 状态变化时间, 变化次数达到阈值时报警被视为抖动.
+// 相同 fingerprint 的报警恢复后再次触发时 startsAt 不同, 因此按 fingerprint 而非 Key 统计, 启用多租户时以租户为前缀.
+// flapDetector 不是并发安全的, 由 Buffer 锁保护.
+type flapDetector struct {
+	window      time.Duration
+	threshold   int // 为 0 时不检测抖动
+	transitions map[string][]time.Time
+}
+
+func newFlapDetector(window time.Duration, threshold int) *flapDetector {
+	return &flapDetector{
+		window:      window,
+		threshold:   threshold,
+		transitions: make(map[string][]time.Time),
+	}
+}
+
+func (d *flapDetector) enabled() bool {
+	return d.threshold > 0
+}
+
+// series 返回报警在抖动检测中的统计标识.
+func series(a *alert.Alert) string {
+	if a.Tenant != "" {
+		return a.Tenant + "/" + a.Fingerprint
+	}
+	return a.Fingerprint
+}
+
+// record 记录报警的一次状态变化.
+func (d *flapDetector) record(a *alert.Alert, t time.Time) {
+	if !d.enabled() {
+		return
+	}
+	id := series(a)
+	d.transitions[id] = append(d.transitions[id], t)
+}
+
+// count 返回统计窗口内的状态变化次数, 同时清理窗口外的记录.
+func (d *flapDetector) count(fingerprint string, now time.Time) int {
+	times := d.transitions[fingerprint]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > d.window {
+		i++
+	}
+	if i == len(times) {
+		delete(d.transitions, fingerprint)
+		return 0
+	}
+	d.transitions[fingerprint] = times[i:]
+	return len(times) - i
+}
+
+// apply 更新报警的抖动标记及状态变化次数, 返回是否发生变化.
+func (d *flapDetector) apply(a *alert.Alert, now time.Time) bool {
+	if !d.enabled() {
+		return false
+	}
+	n := d.count(series(a), now)
+	flapping := n >= d.threshold
+	if a.Flapping == flapping && a.Transitions == n {
+		return false
+	}
+	a.Flapping = flapping
+	a.Transitions = n
+	return true
+}
+
+// prune 清理全部窗口外的记录, 返回处于抖动状态的 fingerprint 数量.
+func (d *flapDetector) prune(now time.Time) int {
+	flapping := 0
+	for fingerprint := range d.transitions {
+		if d.count(fingerprint, now) >= d.threshold {
+			flapping++
+		}
+	}
+	return flapping
+}
@@ -8,12 +8,110 @@ var (
 		maxLifetime:  10 * time.Minute,
 		syncInterval: 1 * time.Second,
 		gcInterval:   5 * time.Minute,
+		// 默认获取全部未恢复的报警, 否则被静默或抑制的报警会在同步时被误标记为 Resolved.
+		active:      true,
+		silenced:    true,
+		inhibited:   true,
+		unprocessed: true,
+		// 1 小时内状态变化 4 次(两次 Firing/Resolved 循环)视为抖动.
+		flapWindow:    1 * time.Hour,
+		flapThreshold: 4,
 	}
 )
 
 type Options struct {
-	alertmanagerAddr string
-	maxLifetime      time.Duration
-	syncInterval     time.Duration
-	gcInterval       time.Duration
+	alertmanagerAddrs []string // 同一集群中各 Alertmanager 的地址, 同步时依次请求直到成功
+	maxLifetime       time.Duration
+	syncInterval      time.Duration
+	gcInterval        time.Duration
+
+	// 同步时从 Alertmanager 获取报警的过滤条件.
+	active      bool
+	silenced    bool
+	inhibited   bool
+	unprocessed bool
+
+	// 抖动检测: 统计窗口内状态变化次数达到阈值时标记报警为抖动, 阈值为 0 时不检测.
+	flapWindow    time.Duration
+	flapThreshold int
+
+	// 多租户: 同步时确定报警所属租户, 以及每个租户在 Buffer 中的报警数量上限, 为 0 时不限制.
+	tenancy     Tenancy
+	tenantQuota int
+
+	// 未持久化的报警数量上限, 数据库不可用时超过上限后拒绝写入新报警, 为 0 时不限制.
+	maxUnloaded int
+}
+
+type Option interface {
+	apply(*Options)
+}
+
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+func WithAlertmanagerAddrs(addrs []string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.alertmanagerAddrs = addrs
+	})
+}
+
+func WithMaxLifetime(maxLifetime time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.maxLifetime = maxLifetime
+	})
+}
+
+func WithSyncInterval(interval time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.syncInterval = interval
+	})
+}
+
+func WithGcInterval(interval time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.gcInterval = interval
+	})
+}
+
+// WithFlapping 设置抖动检测的统计窗口及状态变化次数阈值, 阈值为 0 时不检测.
+func WithFlapping(window time.Duration, threshold int) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.flapWindow = window
+		o.flapThreshold = threshold
+	})
+}
+
+// WithTenancy 启用多租户, 同步时由 tenancy 确定 Alertmanager 中报警所属租户.
+func WithTenancy(tenancy Tenancy) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.tenancy = tenancy
+	})
+}
+
+// WithTenantQuota 设置每个租户在 Buffer 中的报警数量上限, 为 0 时不限制.
+func WithTenantQuota(max int) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.tenantQuota = max
+	})
+}
+
+// WithMaxUnloaded 设置 Buffer 中未持久化的报警数量上限, 超过上限时 Update 返回 ErrBufferFull, 为 0 时不限制.
+func WithMaxUnloaded(max int) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.maxUnloaded = max
+	})
+}
+
+// WithSyncFilter 设置同步时从 Alertmanager 获取报警的过滤条件.
+func WithSyncFilter(active, silenced, inhibited, unprocessed bool) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.active = active
+		o.silenced = silenced
+		o.inhibited = inhibited
+		o.unprocessed = unprocessed
+	})
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"alert2pg/config"
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"alert2pg/storage"
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// runAlerts 按 Prometheus 标签匹配表达式查询数据库中的报警, 如 alert2pg alerts '{alertname="X", severity=~"crit|warn"}'.
+func runAlerts(args []string) int {
+	fs, cf := newFlagSet("alert2pg alerts")
+	status := fs.String("status", "", "报警状态: firing 或 resolved, 为空时不过滤")
+	limit := fs.Int("limit", 100, "最多列出的报警数量, 0 表示全部")
+	fs.Parse(args)
+
+	if fs.NArg() > 1 || (*status != "" && *status != alert.Firing && *status != alert.Resolved) {
+		fmt.Fprintln(os.Stderr, "用法: alert2pg alerts [--status=firing|resolved] [--limit=N] ['{label=\"value\", ...}']")
+		return 2
+	}
+	ms, err := matcher.Parse(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	logger := newLogger(cf.logLevel)
+	cfg, err := config.Load(cf.configFile)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法加载配置文件", "文件", cf.configFile, "错误", err)
+		return 1
+	}
+
+	s, err := newPostgres(cfg, logger)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法连接数据库", "错误", err)
+		return 1
+	}
+	defer s.Close()
+
+	alerts, err := s.QueryAlerts(context.Background(), storage.AlertQuery{Status: *status, Matchers: ms, Limit: *limit})
+	if err != nil {
+		level.Error(logger).Log("消息", "无法查询报警", "错误", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFINGERPRINT\tALERTNAME\tSTATUS\tSTARTSAT\tENDSAT")
+	for _, a := range alerts {
+		endsAt := ""
+		if !a.Alert.EndsAt.IsZero() {
+			endsAt = a.Alert.EndsAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			a.ID, a.Alert.Fingerprint, a.Alert.Labels["alertname"], a.Alert.Status, a.Alert.StartsAt.Format(time.RFC3339), endsAt)
+	}
+	tw.Flush()
+	return 0
+}
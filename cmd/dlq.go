@@ -0,0 +1,242 @@
+package main
+
+import (
+	"alert2pg/config"
+	"alert2pg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const dlqUsage = `用法: alert2pg dlq <list|show|replay|purge> [参数]
+
+  list [--limit=N]        列出死信表中的报警
+  show <id>               查看报警内容, 最后一次错误及尝试次数
+  replay <id>... | --all  使用当前表结构重新存储报警, 成功后从死信表中删除, 数据库中已有更新状态的报警不再存储
+  purge <id>... | --all   从死信表中删除报警
+`
+
+var errDLQUsage = errors.New(strings.TrimSuffix(dlqUsage, "\n"))
+
+// deadLetterStore 死信表的查询及处理, 由 *storage.Postgres 实现.
+type deadLetterStore interface {
+	DeadLetters(ctx context.Context, limit int) ([]storage.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id int) (storage.DeadLetter, error)
+	ReplayDeadLetter(ctx context.Context, id int) error
+	PurgeDeadLetters(ctx context.Context, ids []int) (int64, error)
+}
+
+// dlqSubcommands dlq 的子命令.
+var dlqSubcommands = map[string]func(c *dlqCommand, ctx context.Context) int{
+	"list":   (*dlqCommand).list,
+	"show":   (*dlqCommand).show,
+	"replay": (*dlqCommand).replay,
+	"purge":  (*dlqCommand).purge,
+}
+
+// dlqCommand dlq 子命令的参数及输出.
+type dlqCommand struct {
+	name  string
+	limit int
+	all   bool
+	ids   []int
+
+	store  deadLetterStore
+	stdout io.Writer
+	logger log.Logger
+}
+
+// runDLQ 查看及处理存储失败并写入死信表的报警.
+func runDLQ(args []string) int {
+	c, cf, err := parseDLQArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	logger := newLogger(cf.logLevel)
+	cfg, err := config.Load(cf.configFile)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法加载配置文件", "文件", cf.configFile, "错误", err)
+		return 1
+	}
+
+	s, err := newPostgres(cfg, logger)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法连接数据库", "错误", err)
+		return 1
+	}
+	defer s.Close()
+
+	c.store, c.stdout, c.logger = s, os.Stdout, logger
+	return c.run(context.Background())
+}
+
+// parseDLQArgs 解析 dlq 子命令的命令行参数, 参数无效时返回包含用法的错误.
+func parseDLQArgs(args []string) (*dlqCommand, *commonFlags, error) {
+	if len(args) == 0 {
+		return nil, nil, errDLQUsage
+	}
+	if _, ok := dlqSubcommands[args[0]]; !ok {
+		return nil, nil, errDLQUsage
+	}
+
+	fs, cf := newFlagSet("alert2pg dlq " + args[0])
+	c := &dlqCommand{name: args[0]}
+	fs.IntVar(&c.limit, "limit", 100, "list: 最多列出的报警数量, 0 表示全部")
+	fs.BoolVar(&c.all, "all", false, "replay, purge: 处理死信表中的全部报警")
+	// flag 在第一个非参数处停止解析, 逐个取出 ID 后继续解析, 参数可以位于 ID 之后.
+	var positional []string
+	for rest := args[1:]; ; {
+		fs.Parse(rest)
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	ids, err := parseIDs(positional)
+	switch c.name {
+	case "list":
+		if len(positional) > 0 {
+			return nil, nil, errors.New("用法: alert2pg dlq list [--limit=N]")
+		}
+	case "show":
+		if err != nil || len(ids) != 1 {
+			return nil, nil, errors.New("用法: alert2pg dlq show <id>")
+		}
+	default:
+		if err != nil || (len(ids) == 0 && !c.all) {
+			return nil, nil, fmt.Errorf("用法: alert2pg dlq %s <id>... | --all", c.name)
+		}
+	}
+	c.ids = ids
+	return c, cf, nil
+}
+
+func (c *dlqCommand) run(ctx context.Context) int {
+	return dlqSubcommands[c.name](c, ctx)
+}
+
+func (c *dlqCommand) list(ctx context.Context) int {
+	letters, err := c.store.DeadLetters(ctx, c.limit)
+	if err != nil {
+		level.Error(c.logger).Log("消息", "无法查询死信表", "错误", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFINGERPRINT\tALERTNAME\tSTARTSAT\t尝试次数\t更新时间\t最后错误")
+	for _, letter := range letters {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			letter.ID, letter.Alert.Fingerprint, letter.Alert.Labels["alertname"], letter.Alert.StartsAt.Format(time.RFC3339),
+			letter.Attempts, letter.UpdatedAt.Format(time.RFC3339), truncate(letter.LastError, 80))
+	}
+	tw.Flush()
+	return 0
+}
+
+func (c *dlqCommand) show(ctx context.Context) int {
+	letter, err := c.store.GetDeadLetter(ctx, c.ids[0])
+	if err != nil {
+		level.Error(c.logger).Log("消息", "无法查询死信表", "id", c.ids[0], "错误", err)
+		return 1
+	}
+	payload, err := json.MarshalIndent(letter.Alert, "", "  ")
+	if err != nil {
+		level.Error(c.logger).Log("消息", "无法序列化报警信息", "错误", err)
+		return 1
+	}
+	fmt.Fprintf(c.stdout, "ID:       %d\n尝试次数: %d\n创建时间: %s\n更新时间: %s\n最后错误: %s\n报警内容:\n%s\n",
+		letter.ID, letter.Attempts, letter.CreatedAt.Format(time.RFC3339), letter.UpdatedAt.Format(time.RFC3339), letter.LastError, payload)
+	return 0
+}
+
+func (c *dlqCommand) replay(ctx context.Context) int {
+	ids, err := c.targetIDs(ctx)
+	if err != nil {
+		level.Error(c.logger).Log("消息", "无法查询死信表", "错误", err)
+		return 1
+	}
+
+	var failed int
+	for _, id := range ids {
+		if err := c.store.ReplayDeadLetter(ctx, id); err != nil {
+			level.Error(c.logger).Log("消息", "重新存储报警失败", "id", id, "错误", err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(c.stdout, "已重新存储报警 %d\n", id)
+	}
+	fmt.Fprintf(c.stdout, "成功 %d, 失败 %d\n", len(ids)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (c *dlqCommand) purge(ctx context.Context) int {
+	ids, err := c.targetIDs(ctx)
+	if err != nil {
+		level.Error(c.logger).Log("消息", "无法查询死信表", "错误", err)
+		return 1
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(c.stdout, "已删除 0 条报警")
+		return 0
+	}
+
+	n, err := c.store.PurgeDeadLetters(ctx, ids)
+	if err != nil {
+		level.Error(c.logger).Log("消息", "清理死信表失败", "错误", err)
+		return 1
+	}
+	fmt.Fprintf(c.stdout, "已删除 %d 条报警\n", n)
+	return 0
+}
+
+// targetIDs 返回 replay, purge 需要处理的报警 ID, 指定 --all 时返回死信表中的全部报警.
+func (c *dlqCommand) targetIDs(ctx context.Context) ([]int, error) {
+	if !c.all {
+		return c.ids, nil
+	}
+	letters, err := c.store.DeadLetters(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(letters))
+	for _, letter := range letters {
+		ids = append(ids, letter.ID)
+	}
+	return ids, nil
+}
+
+func parseIDs(args []string) ([]int, error) {
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 ID: %s", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "..."
+	}
+	return s
+}
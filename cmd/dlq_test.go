@@ -0,0 +1,206 @@
+package main
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/storage"
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeadLetters 内存中的死信表.
+type fakeDeadLetters struct {
+	letters   []storage.DeadLetter
+	replayErr map[int]error
+	listErr   error
+	limit     int
+}
+
+func (f *fakeDeadLetters) DeadLetters(_ context.Context, limit int) ([]storage.DeadLetter, error) {
+	f.limit = limit
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	return slices.Clone(f.letters), nil
+}
+
+func (f *fakeDeadLetters) GetDeadLetter(_ context.Context, id int) (storage.DeadLetter, error) {
+	for _, letter := range f.letters {
+		if letter.ID == id {
+			return letter, nil
+		}
+	}
+	return storage.DeadLetter{}, storage.ErrDeadLetterNotFound
+}
+
+func (f *fakeDeadLetters) ReplayDeadLetter(ctx context.Context, id int) error {
+	if _, err := f.GetDeadLetter(ctx, id); err != nil {
+		return err
+	}
+	if err := f.replayErr[id]; err != nil {
+		return err
+	}
+	f.remove(id)
+	return nil
+}
+
+func (f *fakeDeadLetters) PurgeDeadLetters(_ context.Context, ids []int) (int64, error) {
+	var n int64
+	for _, id := range ids {
+		if f.remove(id) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeDeadLetters) remove(id int) bool {
+	n := len(f.letters)
+	f.letters = slices.DeleteFunc(f.letters, func(letter storage.DeadLetter) bool { return letter.ID == id })
+	return len(f.letters) != n
+}
+
+func newFakeDeadLetters() *fakeDeadLetters {
+	updatedAt := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	letters := make([]storage.DeadLetter, 0, 3)
+	for i, name := range []string{"HostDown", "DiskFull", "HighLoad"} {
+		var a alert.Alert
+		a.Fingerprint = name
+		a.Status = alert.Firing
+		a.Labels = map[string]string{"alertname": name}
+		a.StartsAt = updatedAt.Add(-time.Hour)
+		letters = append(letters, storage.DeadLetter{
+			ID: i + 1, Alert: a, LastError: "ERROR: value too long for type character varying(64) while inserting the alert labels (SQLSTATE 22001)",
+			Attempts: 5, CreatedAt: updatedAt, UpdatedAt: updatedAt,
+		})
+	}
+	return &fakeDeadLetters{letters: letters, replayErr: map[int]error{}}
+}
+
+// runDLQCommand 解析参数并使用 store 执行 dlq 子命令, 返回退出码及标准输出.
+func runDLQCommand(t *testing.T, store deadLetterStore, args ...string) (int, string) {
+	t.Helper()
+	c, _, err := parseDLQArgs(args)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	c.store, c.stdout, c.logger = store, &out, log.NewNopLogger()
+	return c.run(context.Background()), out.String()
+}
+
+func TestParseDLQArgs(t *testing.T) {
+	tests := []struct {
+		args  []string
+		err   string
+		limit int
+		all   bool
+		ids   []int
+	}{
+		{args: nil, err: "用法: alert2pg dlq <list|show|replay|purge>"},
+		{args: []string{"drop"}, err: "用法: alert2pg dlq <list|show|replay|purge>"},
+		{args: []string{"list"}, limit: 100, ids: []int{}},
+		{args: []string{"list", "--limit=0"}, limit: 0, ids: []int{}},
+		{args: []string{"list", "1"}, err: "用法: alert2pg dlq list"},
+		{args: []string{"show", "3"}, limit: 100, ids: []int{3}},
+		{args: []string{"show"}, err: "用法: alert2pg dlq show <id>"},
+		{args: []string{"show", "1", "2"}, err: "用法: alert2pg dlq show <id>"},
+		{args: []string{"show", "abc"}, err: "用法: alert2pg dlq show <id>"},
+		{args: []string{"replay", "1", "2"}, limit: 100, ids: []int{1, 2}},
+		{args: []string{"replay", "--all"}, limit: 100, all: true, ids: []int{}},
+		{args: []string{"replay"}, err: "用法: alert2pg dlq replay <id>... | --all"},
+		{args: []string{"purge", "x"}, err: "用法: alert2pg dlq purge <id>... | --all"},
+		{args: []string{"purge", "--config.file=/etc/alert2pg.yml", "--all"}, limit: 100, all: true, ids: []int{}},
+		// 参数可以位于 ID 之后.
+		{args: []string{"replay", "3", "--all"}, limit: 100, all: true, ids: []int{3}},
+		{args: []string{"purge", "1", "--all", "2"}, limit: 100, all: true, ids: []int{1, 2}},
+		{args: []string{"show", "3", "--limit=5"}, limit: 5, ids: []int{3}},
+		{args: []string{"replay", "3", "--", "--all"}, err: "用法: alert2pg dlq replay <id>... | --all"},
+	}
+	for _, tt := range tests {
+		c, _, err := parseDLQArgs(tt.args)
+		if tt.err != "" {
+			require.ErrorContains(t, err, tt.err, "%v", tt.args)
+			continue
+		}
+		require.NoError(t, err, "%v", tt.args)
+		require.Equal(t, tt.args[0], c.name)
+		require.Equal(t, tt.limit, c.limit, "%v", tt.args)
+		require.Equal(t, tt.all, c.all, "%v", tt.args)
+		require.Equal(t, tt.ids, c.ids, "%v", tt.args)
+	}
+
+	_, cf, err := parseDLQArgs([]string{"list", "--config.file=/etc/alert2pg.yml"})
+	require.NoError(t, err)
+	require.Equal(t, "/etc/alert2pg.yml", cf.configFile)
+}
+
+func TestDLQ_List(t *testing.T) {
+	store := newFakeDeadLetters()
+	code, out := runDLQCommand(t, store, "list", "--limit=2")
+	require.Zero(t, code)
+	require.Equal(t, 2, store.limit)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 4)
+	require.Regexp(t, `^ID\s+FINGERPRINT\s+ALERTNAME\s+STARTSAT\s+尝试次数\s+更新时间\s+最后错误$`, lines[0])
+	require.Regexp(t, `^1\s+HostDown\s+HostDown\s+2025-07-01T07:00:00Z\s+5\s+2025-07-01T08:00:00Z\s+ERROR: value too long`, lines[1])
+	// 最后错误截断为 80 个字符.
+	require.True(t, strings.HasSuffix(lines[1], "..."))
+
+	store.listErr = errors.New("连接已关闭")
+	code, _ = runDLQCommand(t, store, "list")
+	require.Equal(t, 1, code)
+}
+
+func TestDLQ_Show(t *testing.T) {
+	store := newFakeDeadLetters()
+	code, out := runDLQCommand(t, store, "show", "2")
+	require.Zero(t, code)
+	require.Contains(t, out, "ID:       2\n尝试次数: 5\n创建时间: 2025-07-01T08:00:00Z\n")
+	require.Contains(t, out, "最后错误: ERROR: value too long")
+	require.Contains(t, out, `"fingerprint": "DiskFull"`)
+
+	code, out = runDLQCommand(t, store, "show", "9")
+	require.Equal(t, 1, code)
+	require.Empty(t, out)
+}
+
+func TestDLQ_Replay(t *testing.T) {
+	store := newFakeDeadLetters()
+	store.replayErr[2] = errors.New("value too long")
+	code, out := runDLQCommand(t, store, "replay", "1", "2")
+	require.Equal(t, 1, code)
+	require.Equal(t, "已重新存储报警 1\n成功 1, 失败 1\n", out)
+	require.Len(t, store.letters, 2)
+
+	delete(store.replayErr, 2)
+	code, out = runDLQCommand(t, store, "replay", "--all")
+	require.Zero(t, code)
+	require.Equal(t, "已重新存储报警 2\n已重新存储报警 3\n成功 2, 失败 0\n", out)
+	require.Empty(t, store.letters)
+}
+
+func TestDLQ_Purge(t *testing.T) {
+	store := newFakeDeadLetters()
+	code, out := runDLQCommand(t, store, "purge", "1", "9")
+	require.Zero(t, code)
+	require.Equal(t, "已删除 1 条报警\n", out)
+
+	code, out = runDLQCommand(t, store, "purge", "--all")
+	require.Zero(t, code)
+	require.Equal(t, "已删除 2 条报警\n", out)
+
+	code, out = runDLQCommand(t, store, "purge", "--all")
+	require.Zero(t, code)
+	require.Equal(t, "已删除 0 条报警\n", out)
+
+	store.listErr = errors.New("连接已关闭")
+	code, _ = runDLQCommand(t, store, "purge", "--all")
+	require.Equal(t, 1, code)
+}
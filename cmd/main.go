@@ -1,39 +1,451 @@
 package main
 
 import (
+	"alert2pg/analytics"
+	"alert2pg/api"
+	"alert2pg/buffer"
+	"alert2pg/config"
+	"alert2pg/filter"
+	"alert2pg/pkg/matcher"
+	"alert2pg/pkg/tenant"
+	"alert2pg/publisher"
+	"alert2pg/silence"
+	"alert2pg/storage"
+	"alert2pg/watchdog"
+	"alert2pg/webhook"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
 	Version = "unknown" // 默认值
 )
 
+// commands 子命令, 未指定子命令时启动 alert2pg 服务.
+var commands = map[string]func(args []string) int{
+	"retention":     runRetention,
+	"migrate-jsonb": runMigrateJSONB,
+	"dlq":           runDLQ,
+	"alerts":        runAlerts,
+}
+
 func main() {
-	var logger log.Logger
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	os.Exit(serve(os.Args[1:]))
+}
+
+// commonFlags 所有子命令共用的命令行参数.
+type commonFlags struct {
+	configFile string
+	logLevel   string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	cf := &commonFlags{}
+	fs.StringVar(&cf.configFile, "config.file", "alert2pg.yml", "配置文件路径")
+	fs.StringVar(&cf.logLevel, "log.level", "info", "日志级别: debug, info, warn, error")
+	return fs, cf
+}
+
+func newLogger(lvl string) log.Logger {
+	logger, _ := newLevelLogger(lvl)
+	return logger
+}
+
+// newLevelLogger 创建可在重新加载配置时修改日志级别的 Logger.
+func newLevelLogger(lvl string) (log.Logger, *levelLogger) {
+	l := &levelLogger{next: log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))}
+	l.SetLevel(lvl)
+	return log.With(l, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller), l
+}
+
+// levelLogger 按当前日志级别过滤日志.
+type levelLogger struct {
+	next   log.Logger
+	filter atomic.Pointer[log.Logger]
+}
+
+func (l *levelLogger) Log(keyvals ...interface{}) error {
+	return (*l.filter.Load()).Log(keyvals...)
+}
+
+// SetLevel 修改日志级别, 无效的级别视为 info.
+func (l *levelLogger) SetLevel(lvl string) {
+	f := level.NewFilter(l.next, level.Allow(level.ParseDefault(lvl, level.InfoValue())))
+	l.filter.Store(&f)
+}
+
+// newPostgres 根据配置创建 PostgreSQL 存储后端, 命令行工具仅支持 PostgreSQL.
+// extra 中的配置追加在配置文件之后, 如服务启动时的连接重试.
+func newPostgres(cfg *config.Config, logger log.Logger, extra ...storage.PostgresOption) (*storage.Postgres, error) {
+	if cfg.Storage.Driver != config.DriverPostgres {
+		return nil, fmt.Errorf("存储后端 %s 不支持该操作, 仅支持 %s", cfg.Storage.Driver, config.DriverPostgres)
+	}
+	opts := []storage.PostgresOption{
+		storage.WithDSN(cfg.Storage.DSN),
+		storage.WithMaxConns(cfg.Storage.MaxConns),
+		storage.WithHealthCheckPeriod(time.Duration(cfg.Storage.HealthCheckPeriod)),
+		storage.WithPasswordFile(cfg.Storage.PasswordFile),
+		storage.WithPartitioning(cfg.Storage.Partitioning.Enabled),
+		storage.WithLayout(cfg.Storage.Layout),
+		storage.WithNotifyChannel(cfg.Storage.NotifyChannel),
+		storage.WithOutbox(cfg.Outbox.Enabled),
+		storage.WithTenancy(cfg.Tenancy.Enabled),
+	}
+	if t := cfg.Storage.Timescale; t.Enabled {
+		opts = append(opts, storage.WithTimescale(time.Duration(t.ChunkInterval), time.Duration(t.CompressAfter), time.Duration(t.Retention)))
+	}
+	return storage.NewPostgres(logger, append(opts, extra...)...)
+}
+
+// newSink 根据配置的存储后端类型创建 Sink.
+// 启动时无法连接 PostgreSQL 时以降级模式运行并在后台重试连接, 命令行工具不重试.
+func newSink(cfg *config.Config, logger log.Logger) (storage.Sink, error) {
+	switch cfg.Storage.Driver {
+	case config.DriverPostgres:
+		r := cfg.Storage.ConnectRetry
+		return newPostgres(cfg, logger, storage.WithConnectRetry(time.Duration(r.InitialBackoff), time.Duration(r.MaxBackoff)))
+	case config.DriverSQLite:
+		return storage.NewSQLite(cfg.Storage.SQLite.Path, logger)
+	case config.DriverMemory:
+		return storage.NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.Storage.Driver)
+	}
+}
+
+// postgresSink 返回 PostgreSQL 存储后端, 存储后端不是 PostgreSQL 时记录错误日志并返回 false.
+// 配置加载时已校验仅支持 PostgreSQL 的服务, 此处避免配置校验遗漏时程序崩溃.
+func postgresSink(sink storage.Sink, service string, cfg *config.Config, logger log.Logger) (*storage.Postgres, bool) {
+	pg, ok := sink.(*storage.Postgres)
+	if !ok {
+		level.Error(logger).Log("消息", service+"仅支持 PostgreSQL 存储后端", "存储后端", cfg.Storage.Driver)
+	}
+	return pg, ok
+}
+
+// newPublishers 根据配置创建 Outbox 消息发布者.
+func newPublishers(cfg *config.Config) ([]publisher.Publisher, error) {
+	publishers := make([]publisher.Publisher, 0)
+	closeAll := func() {
+		for _, p := range publishers {
+			p.Close()
+		}
+	}
+	if o := cfg.Outbox.Kafka; len(o.Brokers) > 0 {
+		p, err := publisher.NewKafka(o.Brokers, o.Topic)
+		if err != nil {
+			return nil, err
+		}
+		publishers = append(publishers, p)
+	}
+	if o := cfg.Outbox.NATS; o.URL != "" {
+		p, err := publisher.NewNATS(o.URL, o.Subject)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		publishers = append(publishers, p)
+	}
+	if o := cfg.Outbox.HTTP; o.URL != "" {
+		p, err := publisher.NewHTTP(o.URL)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		publishers = append(publishers, p)
+	}
+	return publishers, nil
+}
+
+// newTenantResolver 根据配置创建多租户解析器, 未启用多租户时返回 nil.
+func newTenantResolver(cfg *config.Config) (*tenant.Resolver, error) {
+	t := cfg.Tenancy
+	if !t.Enabled {
+		return nil, nil
+	}
+	return tenant.New(
+		tenant.WithHeader(t.Header),
+		tenant.WithLabel(t.Label),
+		tenant.WithTokens(t.Tokens),
+		tenant.WithDefault(t.Default),
+	)
+}
 
-	// 保证退出顺序
-	webhookExitChan := make(chan struct{})
-	bufferExitChan := make(chan struct{})
+// newFilter 根据配置创建报警过滤器.
+func newFilter(cfg *config.Config) (*filter.Filter, error) {
+	rules, err := filterRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return filter.New(rules)
+}
+
+func filterRules(cfg *config.Config) ([]filter.Rule, error) {
+	rules := make([]filter.Rule, 0, len(cfg.Filter.Rules))
+	for _, r := range cfg.Filter.Rules {
+		rule, err := r.Rule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// bufferOptions 返回可在重新加载配置时修改的 Buffer 配置.
+func bufferOptions(cfg *config.Config) []buffer.Option {
+	return []buffer.Option{
+		buffer.WithAlertmanagerAddrs(cfg.Alertmanager.Addrs()),
+		buffer.WithSyncInterval(time.Duration(cfg.Buffer.SyncInterval)),
+		buffer.WithGcInterval(time.Duration(cfg.Buffer.GcInterval)),
+		buffer.WithMaxLifetime(time.Duration(cfg.Buffer.MaxLifetime)),
+		buffer.WithSyncFilter(cfg.Buffer.SyncFilter.Active, cfg.Buffer.SyncFilter.Silenced, cfg.Buffer.SyncFilter.Inhibited, cfg.Buffer.SyncFilter.Unprocessed),
+		buffer.WithMaxUnloaded(cfg.Buffer.MaxUnloaded),
+	}
+}
+
+// logLevel 返回配置文件中的日志级别, 未配置时使用命令行参数.
+func logLevel(cfg *config.Config, flagLevel string) string {
+	if cfg.Log.Level != "" {
+		return cfg.Log.Level
+	}
+	return flagLevel
+}
+
+// newWatchdog 根据配置创建心跳报警监控, 未启用时返回 nil.
+func newWatchdog(cfg *config.Config, b *buffer.Buffer, logger log.Logger) (*watchdog.Watchdog, error) {
+	w := cfg.Watchdog
+	if !w.Enabled {
+		return nil, nil
+	}
+	// 配置加载时已校验匹配表达式.
+	ms, _ := matcher.Parse(w.Match)
+	return watchdog.New(ms, b, logger,
+		watchdog.WithTimeout(time.Duration(w.Timeout)),
+		watchdog.WithCheckInterval(time.Duration(w.CheckInterval)),
+		watchdog.WithSyncFailures(w.SyncFailures),
+		watchdog.WithNotify(w.Notify.URL, time.Duration(w.Notify.Timeout)),
+	)
+}
+
+// checkConfig 校验配置文件中的全部规则, 并输出规则数量.
+func checkConfig(cfg *config.Config, filename string) int {
+	if _, err := newTenantResolver(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "配置文件 %s 无效: %s\n", filename, err)
+		return 1
+	}
+	if _, err := newFilter(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "配置文件 %s 无效: %s\n", filename, err)
+		return 1
+	}
+	fmt.Printf("配置文件 %s 有效: %d 条标签改写规则, %d 条注释改写规则, %d 条过滤规则, %d 条保留规则\n", filename,
+		len(cfg.Relabel.Labels), len(cfg.Relabel.Annotations), len(cfg.Filter.Rules), len(cfg.Retention.Rules))
+	return 0
+}
+
+func retentionOptions(cfg *config.Config) []storage.RetentionOption {
+	rules := make([]storage.RetentionRule, 0, len(cfg.Retention.Rules))
+	for _, rule := range cfg.Retention.Rules {
+		// 配置加载时已校验匹配表达式.
+		ms, _ := rule.Matchers()
+		rules = append(rules, storage.RetentionRule{Matchers: ms, MaxAge: time.Duration(rule.MaxAge)})
+	}
+	return []storage.RetentionOption{
+		storage.WithRetentionInterval(time.Duration(cfg.Retention.Interval)),
+		storage.WithRetentionMaxAge(time.Duration(cfg.Retention.MaxAge)),
+		storage.WithRetentionBatchSize(cfg.Retention.BatchSize),
+		storage.WithRetentionArchive(cfg.Retention.Archive),
+		storage.WithRetentionRules(rules),
+	}
+}
+
+func serve(args []string) int {
 	// 1. 解析命令行
+	fs, cf := newFlagSet("alert2pg")
+	listenAddress := fs.String("web.listen-address", ":9567", "webhook 服务监听地址")
+	enableAPI := fs.Bool("web.enable-api", false, "启用只读的报警查询接口 /api/v1")
+	check := fs.Bool("check-config", false, "仅校验配置文件及其中的改写, 过滤规则后退出")
+	fs.Parse(args)
+
+	logger, lvl := newLevelLogger(cf.logLevel)
+	if !*check {
+		level.Info(logger).Log("消息", "启动 alert2pg", "版本", Version)
+	}
+
+	cfg, err := config.Load(cf.configFile)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法加载配置文件", "文件", cf.configFile, "错误", err)
+		return 1
+	}
+	if *check {
+		return checkConfig(cfg, cf.configFile)
+	}
+	lvl.SetLevel(logLevel(cfg, cf.logLevel))
+
+	// 2. 创建服务
+	tenants, err := newTenantResolver(cfg)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法创建多租户解析器", "错误", err)
+		return 1
+	}
+	f, err := newFilter(cfg)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法创建报警过滤器", "错误", err)
+		return 1
+	}
+	bufferOpts := append(bufferOptions(cfg),
+		buffer.WithFlapping(time.Duration(cfg.Buffer.Flapping.Window), cfg.Buffer.Flapping.Threshold),
+	)
+	if tenants != nil {
+		bufferOpts = append(bufferOpts, buffer.WithTenancy(tenants), buffer.WithTenantQuota(cfg.Tenancy.MaxAlerts))
+	}
+	b := buffer.New(logger, bufferOpts...)
+	sink, err := newSink(cfg, logger)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法创建存储后端", "存储后端", cfg.Storage.Driver, "错误", err)
+		return 1
+	}
+	// storage 服务退出时已关闭存储后端, 此处保证提前退出时同样释放存储后端的资源.
+	defer sink.Close()
+	s, err := storage.New(b, sink, logger,
+		storage.WithTimeout(time.Duration(cfg.Storage.Timeout)),
+		storage.WithParallelism(cfg.Storage.Parallelism),
+		storage.WithMinBatchInterval(time.Duration(cfg.Storage.MinBatchInterval)),
+		storage.WithDrainTimeout(time.Duration(cfg.Shutdown.Timeout)),
+		storage.WithSpillFile(cfg.Shutdown.SpillFile),
+		storage.WithRetry(cfg.Storage.Retry.MaxAttempts, time.Duration(cfg.Storage.Retry.InitialBackoff), time.Duration(cfg.Storage.Retry.MaxBackoff)),
+	)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法创建 storage 服务", "错误", err)
+		return 1
+	}
+	wd, err := newWatchdog(cfg, b, logger)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法创建心跳报警监控", "错误", err)
+		return 1
+	}
+	w, err := webhook.New(b, logger,
+		webhook.WithAddress(*listenAddress),
+		webhook.WithGracePeriod(time.Duration(cfg.Shutdown.GracePeriod)),
+		webhook.WithTenantResolver(tenants),
+		webhook.WithRelabel(cfg.Relabel),
+		webhook.WithFilter(f),
+		webhook.WithWatchdog(wd),
+	)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法创建 webhook 服务", "错误", err)
+		return 1
+	}
+	prometheus.MustRegister(w, s, b, f)
+
+	// 存活及就绪检查, 数据库不可用或尚未加载 firing 报警时未就绪, webhook 仍接收报警写入 Buffer.
+	w.Handle("/-/healthy", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(rw, "alert2pg is Healthy.")
+	}))
+	w.Handle("/-/ready", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			http.Error(rw, "alert2pg is not ready: 存储后端未就绪", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(rw, "alert2pg is Ready.")
+	}))
+
+	// 重新加载配置时应用的修改, 全部校验通过后才依次应用, 避免部分配置生效.
+	// 其他配置的修改需重启服务.
+	reloads := []applier{
+		func(cfg *config.Config) (func(), error) {
+			rules, err := filterRules(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if err := filter.Validate(rules); err != nil {
+				return nil, err
+			}
+			// 规则已校验, 替换规则不会失败.
+			return func() { f.Update(rules) }, nil
+		},
+	}
+	if tenants != nil {
+		reloads = append(reloads, func(cfg *config.Config) (func(), error) {
+			if err := tenant.ValidateTokens(cfg.Tenancy.Tokens); err != nil {
+				return nil, err
+			}
+			return func() { tenants.SetTokens(cfg.Tenancy.Tokens) }, nil
+		})
+	}
+	reloads = append(reloads, func(cfg *config.Config) (func(), error) {
+		return func() {
+			lvl.SetLevel(logLevel(cfg, cf.logLevel))
+			w.SetRelabel(cfg.Relabel)
+			b.Reload(bufferOptions(cfg)...)
+			s.Reload(
+				storage.WithTimeout(time.Duration(cfg.Storage.Timeout)),
+				storage.WithParallelism(cfg.Storage.Parallelism),
+				storage.WithMinBatchInterval(time.Duration(cfg.Storage.MinBatchInterval)),
+			)
+		}, nil
+	})
 
-	// 2. 创建线程管理器
+	// 报警查询接口, 与 webhook 共用监听地址.
+	if *enableAPI {
+		querier, ok := sink.(api.Querier)
+		if !ok {
+			level.Error(logger).Log("消息", "存储后端不支持报警查询接口", "存储后端", cfg.Storage.Driver)
+			return 1
+		}
+		a, err := api.New(querier, logger, api.WithTenantResolver(tenants))
+		if err != nil {
+			level.Error(logger).Log("消息", "无法创建报警查询接口", "错误", err)
+			return 1
+		}
+		prometheus.MustRegister(a)
+		w.Handle("/api/", a)
+	}
 
-	// 3. 读取数据库中  firing 报警并添加到 Buffer 中.
+	// 3. 加载上次退出时未能存储的报警, 数据库中的 firing 报警由 Storage 在数据库可用后加载, 不覆盖已存在的报警.
+	{
+		spilled, err := storage.LoadSpill(cfg.Shutdown.SpillFile)
+		if err != nil {
+			level.Error(logger).Log("消息", "无法读取溢出文件中的报警", "文件", cfg.Shutdown.SpillFile, "错误", err)
+			return 1
+		}
+		if len(spilled) > 0 {
+			b.Restore(spilled)
+			level.Info(logger).Log("消息", "已加载溢出文件中未存储的报警", "文件", cfg.Shutdown.SpillFile, "数量", len(spilled))
+		}
+	}
 
 	// 4. Buffer 执行 Sync 一次.
-	// 服务启动初始化阶段 -> Buffer 加载数据库中 firing 报警 -> Buffer Sync -> Storage 存储操作
+	// 服务启动初始化阶段 -> Buffer Sync -> Storage 在数据库可用后加载 firing 报警 -> Storage 存储操作
 
 	// 开始所有服务.
 
-	// 接收到关闭信息 -> Webhook 服务停止 -> Buffer 执行同步服务 -> Storage 完成全部数据存储 -> 退出程序
+	// 接收到关闭信息 -> Webhook 服务停止 -> Buffer 执行同步服务 -> Storage 在截止时间前完成数据存储 -> 未存储的报警写入溢出文件 -> 退出程序
+	// run.Group 按添加顺序依次执行 interrupt, 保证退出顺序.
 	var g run.Group
 
+	// 退出的截止时间, 在第一个 interrupt 中开始计时.
+	// run.Group 在同一个 goroutine 中依次执行 interrupt, 无需加锁.
+	var deadline time.Time
+
 	// 信号处理
 	{
 		// 使用有缓冲通道, 防止阻塞系统通知.
@@ -50,6 +462,7 @@ func main() {
 				return nil
 			},
 			func(_ error) {
+				deadline = time.Now().Add(time.Duration(cfg.Shutdown.Timeout))
 				close(cancel)
 			},
 		)
@@ -59,11 +472,11 @@ func main() {
 	{
 		g.Add(
 			func() error {
-				close(webhookExitChan)
-				return nil
+				return w.Run()
 			},
 			func(_ error) {
 				level.Info(logger).Log("消息", "webhook 服务关闭中...")
+				w.Stop()
 			},
 		)
 	}
@@ -72,31 +485,210 @@ func main() {
 	{
 		g.Add(
 			func() error {
-				close(bufferExitChan)
+				b.Run()
+				return nil
+			},
+			func(err error) {
+				level.Info(logger).Log("消息", "Buffer 服务关闭中...")
+				b.Stop()
+			},
+		)
+	}
+
+	// 心跳报警监控
+	if wd != nil {
+		prometheus.MustRegister(wd)
+		g.Add(
+			func() error {
+				wd.Run()
+				return nil
+			},
+			func(err error) {
+				level.Info(logger).Log("消息", "心跳报警监控关闭中...")
+				wd.Stop()
+			},
+		)
+	}
+
+	// 静默规则归档服务
+	saver, ok := sink.(silence.Saver)
+	if cfg.Silence.Enabled && !ok {
+		level.Warn(logger).Log("消息", "存储后端不支持静默规则归档, 跳过静默规则归档服务", "存储后端", cfg.Storage.Driver)
+	}
+	if cfg.Silence.Enabled && ok {
+		c, err := silence.New(saver, logger,
+			silence.WithAlertmanagerAddrs(cfg.Alertmanager.Addrs()),
+			silence.WithInterval(time.Duration(cfg.Silence.Interval)),
+		)
+		if err != nil {
+			level.Error(logger).Log("消息", "无法创建静默规则归档服务", "错误", err)
+			return 1
+		}
+		prometheus.MustRegister(c)
+		reloads = append(reloads, func(cfg *config.Config) (func(), error) {
+			return func() { c.SetAlertmanagerAddrs(cfg.Alertmanager.Addrs()) }, nil
+		})
+		g.Add(
+			func() error {
+				c.Run()
+				return nil
+			},
+			func(err error) {
+				level.Info(logger).Log("消息", "静默规则归档服务关闭中...")
+				c.Stop()
+			},
+		)
+	}
+
+	// 报警统计指标服务
+	if cfg.Analytics.Enabled {
+		pg, ok := postgresSink(sink, "报警统计指标服务", cfg, logger)
+		if !ok {
+			return 1
+		}
+		e, err := analytics.New(pg, logger,
+			analytics.WithInterval(time.Duration(cfg.Analytics.Interval)),
+			analytics.WithWindow(time.Duration(cfg.Analytics.Window)),
+			analytics.WithGroupBy(cfg.Analytics.GroupBy),
+			analytics.WithTop(cfg.Analytics.Top),
+		)
+		if err != nil {
+			level.Error(logger).Log("消息", "无法创建报警统计指标服务", "错误", err)
+			return 1
+		}
+		prometheus.MustRegister(e)
+		g.Add(
+			func() error {
+				e.Run()
+				return nil
+			},
+			func(err error) {
+				level.Info(logger).Log("消息", "报警统计指标服务关闭中...")
+				e.Stop()
+			},
+		)
+	}
+
+	// 分区维护服务
+	if cfg.Storage.Partitioning.Enabled {
+		pg, ok := postgresSink(sink, "分区维护服务", cfg, logger)
+		if !ok {
+			return 1
+		}
+		p, err := storage.NewPartitioner(pg, logger,
+			storage.WithPartitionInterval(time.Duration(cfg.Storage.Partitioning.Interval)),
+			storage.WithPartitionPremake(cfg.Storage.Partitioning.Premake),
+			storage.WithPartitionRetention(time.Duration(cfg.Storage.Partitioning.Retention)),
+		)
+		if err != nil {
+			level.Error(logger).Log("消息", "无法创建分区维护服务", "错误", err)
+			return 1
+		}
+		prometheus.MustRegister(p)
+		g.Add(
+			func() error {
+				p.Run()
+				return nil
+			},
+			func(err error) {
+				level.Info(logger).Log("消息", "分区维护服务关闭中...")
+				p.Stop()
+			},
+		)
+	}
+
+	// 报警保留策略服务
+	if cfg.Retention.Enabled {
+		pg, ok := postgresSink(sink, "报警保留策略服务", cfg, logger)
+		if !ok {
+			return 1
+		}
+		r, err := storage.NewRetention(pg, logger, retentionOptions(cfg)...)
+		if err != nil {
+			level.Error(logger).Log("消息", "无法创建报警保留策略服务", "错误", err)
+			return 1
+		}
+		prometheus.MustRegister(r)
+		g.Add(
+			func() error {
+				r.Run()
+				return nil
+			},
+			func(err error) {
+				level.Info(logger).Log("消息", "报警保留策略服务关闭中...")
+				r.Stop()
+			},
+		)
+	}
+
+	// Outbox 转发服务
+	if cfg.Outbox.Enabled {
+		pg, ok := postgresSink(sink, "Outbox 转发服务", cfg, logger)
+		if !ok {
+			return 1
+		}
+		publishers, err := newPublishers(cfg)
+		if err != nil {
+			level.Error(logger).Log("消息", "无法创建 Outbox 消息发布者", "错误", err)
+			return 1
+		}
+		r, err := storage.NewRelay(pg, publishers, logger,
+			storage.WithRelayInterval(time.Duration(cfg.Outbox.Interval)),
+			storage.WithRelayBatchSize(cfg.Outbox.BatchSize),
+			storage.WithRelayTimeout(time.Duration(cfg.Outbox.Timeout)),
+		)
+		if err != nil {
+			level.Error(logger).Log("消息", "无法创建 Outbox 转发服务", "错误", err)
+			return 1
+		}
+		prometheus.MustRegister(r)
+		g.Add(
+			func() error {
+				r.Run()
+				return nil
+			},
+			func(err error) {
+				level.Info(logger).Log("消息", "Outbox 转发服务关闭中...")
+				r.Stop()
+			},
+		)
+	}
+
+	// 重新加载配置, 处理 SIGHUP 信号及 POST /-/reload 请求.
+	{
+		rl := newReloader(cf.configFile, logger, reloads...)
+		prometheus.MustRegister(rl)
+		w.Handle("/-/reload", rl)
+		g.Add(
+			func() error {
+				rl.Run()
 				return nil
 			},
 			func(err error) {
-				level.Info(logger).Log("消息", "Buffer 服务关闭中...等待 webhook 服务退出")
-				<-webhookExitChan
-				// Buffer 清理相关工作
+				rl.Stop()
 			},
 		)
 	}
 
-	// storage 服务
+	// storage 服务, 需要最后退出, 其他服务依赖 storage 的数据库连接, 退出时关闭存储后端.
 	{
 		g.Add(
 			func() error {
+				s.Run()
 				return nil
 			},
 			func(err error) {
-				<-bufferExitChan
+				level.Info(logger).Log("消息", "storage 服务关闭中...", "截止时间", deadline)
+				ctx, cancel := context.WithDeadline(context.Background(), deadline)
+				defer cancel()
+				s.Shutdown(ctx)
 			},
 		)
 	}
 
 	if err := g.Run(); err != nil {
 		level.Error(logger).Log("消息", "alert2pg 运行失败", "错误", err)
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// freeAddr 返回一个本地可用的监听地址.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// get 请求 url 并返回状态码及响应内容, 请求失败时状态码为 0.
+func get(url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// useRegistry 在测试期间使用新的默认 Registry, serve 可在同一进程中多次注册指标.
+func useRegistry(t *testing.T) {
+	registerer, gatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	reg := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer, prometheus.DefaultGatherer = reg, reg
+	t.Cleanup(func() {
+		prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registerer, gatherer
+	})
+}
+
+// TestServe 使用内存存储后端启动服务, 接收 webhook 报警并存储, 收到 SIGTERM 后正常退出.
+func TestServe(t *testing.T) {
+	useRegistry(t)
+	dir := t.TempDir()
+	addr := freeAddr(t)
+	configFile := filepath.Join(dir, "alert2pg.yml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+alertmanager:
+  address: http://%s
+shutdown:
+  grace_period: 1s
+  timeout: 1s
+  spill_file: %s
+storage:
+  driver: memory
+silence:
+  enabled: false
+`, freeAddr(t), filepath.Join(dir, "alert2pg.spill.json"))), 0o644))
+
+	done := make(chan int, 1)
+	go func() {
+		done <- serve([]string{"--config.file=" + configFile, "--web.listen-address=" + addr, "--log.level=error"})
+	}()
+	base := "http://" + addr
+	require.Eventually(t, func() bool {
+		code, _ := get(base + "/-/healthy")
+		return code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, err := http.Post(base+"/webhook", "application/json", strings.NewReader(`{
+		"version": "4",
+		"status": "firing",
+		"alerts": [{
+			"status": "firing",
+			"labels": {"alertname": "HostDown", "instance": "node-1"},
+			"annotations": {"summary": "node-1 不可用"},
+			"startsAt": "2025-07-01T08:00:00Z",
+			"endsAt": "0001-01-01T00:00:00Z",
+			"fingerprint": "9f1b3c2d4e5f6a7b"
+		}]
+	}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 内存存储后端始终可用, 报警存储后计入成功数量.
+	require.Eventually(t, func() bool {
+		code, _ := get(base + "/-/ready")
+		return code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, body := get(base + "/metrics")
+		return strings.Contains(body, "alert2pg_storage_success_alerts_total 1")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// serve 已注册 SIGTERM 的处理, 信号不会终止测试进程.
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case code := <-done:
+		require.Zero(t, code)
+	case <-time.After(10 * time.Second):
+		t.Fatal("收到 SIGTERM 后服务未退出")
+	}
+	_, err = os.Stat(filepath.Join(dir, "alert2pg.spill.json"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"alert2pg/config"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// runMigrateJSONB 将数据库中 EAV 格式的标签及注释转换为 JSONB 格式, 完成后可将 storage.layout 配置为 jsonb.
+func runMigrateJSONB(args []string) int {
+	fs, cf := newFlagSet("alert2pg migrate-jsonb")
+	batchSize := fs.Int("batch-size", 1000, "单个事务中转换报警的最大数量")
+	purge := fs.Bool("purge-eav", false, "在转换每批报警的同一事务中删除其在 AlertLabel, AlertAnnotation 表中的记录")
+	fs.Parse(args)
+
+	logger := newLogger(cf.logLevel)
+	cfg, err := config.Load(cf.configFile)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法加载配置文件", "文件", cf.configFile, "错误", err)
+		return 1
+	}
+
+	s, err := newPostgres(cfg, logger)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法连接数据库", "错误", err)
+		return 1
+	}
+	defer s.Close()
+
+	start := time.Now()
+	n, err := s.ConvertToJSONB(context.Background(), *batchSize, *purge)
+	if err != nil {
+		level.Error(logger).Log("消息", "转换标签及注释失败", "已转换", n, "错误", err)
+		return 1
+	}
+	fmt.Printf("已转换 %d 条报警, 耗时 %s\n", n, time.Since(start))
+	return 0
+}
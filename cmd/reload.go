@@ -0,0 +1,155 @@
+package main
+
+import (
+	"alert2pg/config"
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// applier 校验新配置并返回应用修改的函数, 校验失败时返回错误, 应用修改不能失败.
+type applier func(cfg *config.Config) (func(), error)
+
+// reloader 在收到 SIGHUP 信号或 POST /-/reload 请求时重新加载配置文件, 并依次应用到运行中的服务.
+// 配置文件无效时保留当前配置, 加载结果通过 alert2pg_config_last_reload_successful 指标导出.
+type reloader struct {
+	filename string
+	appliers []applier
+
+	// 重新加载请求, 由 Run 依次处理并返回加载结果.
+	requests chan chan error
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger log.Logger
+
+	lastReloadSuccessfulGauge prometheus.Gauge
+	lastReloadSuccessGauge    prometheus.Gauge
+}
+
+// newReloader 创建 reloader, 全部 applier 校验通过后才按顺序应用新配置, 任一校验失败时不应用任何修改.
+func newReloader(filename string, logger log.Logger, appliers ...applier) *reloader {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &reloader{
+		filename: filename,
+		appliers: appliers,
+		requests: make(chan chan error),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		logger:   logger,
+		lastReloadSuccessfulGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "alert2pg",
+			Subsystem: "config",
+			Name:      "last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful",
+		}),
+		lastReloadSuccessGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "alert2pg",
+			Subsystem: "config",
+			Name:      "last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload",
+		}),
+	}
+	// 启动时已成功加载配置文件.
+	r.lastReloadSuccessfulGauge.Set(1)
+	r.lastReloadSuccessGauge.SetToCurrentTime()
+	return r
+}
+
+// Run 处理 SIGHUP 信号及重新加载请求.
+func (r *reloader) Run() {
+	defer close(r.done)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			r.reload()
+		case errc := <-r.requests:
+			errc <- r.reload()
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *reloader) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// reload 重新加载配置文件并应用到运行中的服务.
+func (r *reloader) reload() error {
+	start := time.Now()
+	err := r.apply()
+	if err != nil {
+		r.lastReloadSuccessfulGauge.Set(0)
+		level.Error(r.logger).Log("消息", "无法重新加载配置文件, 保留当前配置", "文件", r.filename, "错误", err)
+		return err
+	}
+	r.lastReloadSuccessfulGauge.Set(1)
+	r.lastReloadSuccessGauge.SetToCurrentTime()
+	level.Info(r.logger).Log("消息", "已重新加载配置文件", "文件", r.filename, "耗时", time.Since(start))
+	return nil
+}
+
+func (r *reloader) apply() error {
+	cfg, err := config.Load(r.filename)
+	if err != nil {
+		return err
+	}
+	commits := make([]func(), 0, len(r.appliers))
+	for _, prepare := range r.appliers {
+		commit, err := prepare(cfg)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, commit)
+	}
+	for _, commit := range commits {
+		commit()
+	}
+	return nil
+}
+
+// ServeHTTP 处理 POST /-/reload 请求, 配置文件无效时返回 500.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		http.Error(w, "仅支持 POST, PUT 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	errc := make(chan error, 1)
+	select {
+	case r.requests <- errc:
+	case <-r.ctx.Done():
+		http.Error(w, "alert2pg 正在退出", http.StatusServiceUnavailable)
+		return
+	}
+	if err := <-errc; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (r *reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.lastReloadSuccessfulGauge.Describe(ch)
+	r.lastReloadSuccessGauge.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	r.lastReloadSuccessfulGauge.Collect(ch)
+	r.lastReloadSuccessGauge.Collect(ch)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"alert2pg/config"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// reloadRequest 向 reloader 发送重新加载请求, 返回状态码.
+func reloadRequest(r *reloader, method string) int {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, "/-/reload", nil))
+	return rec.Code
+}
+
+func TestReloader(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "alert2pg.yml")
+	writeConfig := func(content string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(content), 0o644))
+	}
+	writeConfig("log:\n  level: info\n")
+
+	// 最后一个 applier 校验失败时, 排在前面的 applier 同样不应用修改. SIGHUP 在 Run 协程中处理, 使用原子变量记录结果.
+	var current atomic.Value
+	var rejected atomic.Int32
+	r := newReloader(configFile, log.NewNopLogger(),
+		func(cfg *config.Config) (func(), error) {
+			return func() { current.Store(cfg.Log.Level) }, nil
+		},
+		func(cfg *config.Config) (func(), error) {
+			if cfg.Alertmanager.Addrs()[0] == "reject" {
+				rejected.Add(1)
+				return nil, errors.New("无效的 Alertmanager 地址")
+			}
+			return func() {}, nil
+		},
+	)
+	go r.Run()
+	defer r.Stop()
+	require.Equal(t, 1.0, testutil.ToFloat64(r.lastReloadSuccessfulGauge))
+
+	writeConfig("log:\n  level: debug\n")
+	require.Equal(t, http.StatusOK, reloadRequest(r, http.MethodPost))
+	require.Equal(t, "debug", current.Load())
+	require.Equal(t, 1.0, testutil.ToFloat64(r.lastReloadSuccessfulGauge))
+	success := testutil.ToFloat64(r.lastReloadSuccessGauge)
+
+	// 无法解析或校验失败的配置文件被拒绝, 保留当前配置.
+	for _, content := range []string{"log: [\n", "log:\n  level: trace\n"} {
+		writeConfig(content)
+		require.Equal(t, http.StatusInternalServerError, reloadRequest(r, http.MethodPost))
+		require.Equal(t, "debug", current.Load())
+		require.Equal(t, 0.0, testutil.ToFloat64(r.lastReloadSuccessfulGauge))
+		require.Equal(t, success, testutil.ToFloat64(r.lastReloadSuccessGauge))
+	}
+
+	// 任一 applier 校验失败时不应用任何修改.
+	writeConfig("log:\n  level: info\nalertmanager:\n  addresses: [reject]\n")
+	require.Equal(t, http.StatusInternalServerError, reloadRequest(r, http.MethodPut))
+	require.Equal(t, int32(1), rejected.Load())
+	require.Equal(t, "debug", current.Load())
+	require.Equal(t, 0.0, testutil.ToFloat64(r.lastReloadSuccessfulGauge))
+
+	// 修正配置文件后重新加载成功.
+	time.Sleep(10 * time.Millisecond)
+	writeConfig("log:\n  level: warn\n")
+	require.Equal(t, http.StatusOK, reloadRequest(r, http.MethodPut))
+	require.Equal(t, "warn", current.Load())
+	require.Equal(t, 1.0, testutil.ToFloat64(r.lastReloadSuccessfulGauge))
+	require.Greater(t, testutil.ToFloat64(r.lastReloadSuccessGauge), success)
+
+	// 收到 SIGHUP 信号时重新加载, Run 已在处理请求, 信号处理已注册.
+	writeConfig("log:\n  level: error\n")
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool {
+		return current.Load() == "error"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReloader_Methods(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "alert2pg.yml")
+	require.NoError(t, os.WriteFile(configFile, []byte("log:\n  level: info\n"), 0o644))
+	var reloads int
+	r := newReloader(configFile, log.NewNopLogger(), func(*config.Config) (func(), error) {
+		return func() { reloads++ }, nil
+	})
+	go r.Run()
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodPatch} {
+		require.Equal(t, http.StatusMethodNotAllowed, reloadRequest(r, method), method)
+	}
+	require.Zero(t, reloads)
+	require.Equal(t, http.StatusOK, reloadRequest(r, http.MethodPost))
+	require.Equal(t, http.StatusOK, reloadRequest(r, http.MethodPut))
+	require.Equal(t, 2, reloads)
+
+	// 退出后不再处理重新加载请求.
+	r.Stop()
+	require.Equal(t, http.StatusServiceUnavailable, reloadRequest(r, http.MethodPost))
+	require.Equal(t, 2, reloads)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"alert2pg/config"
+	"alert2pg/storage"
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+// runRetention 立即执行一次报警清理, --dry-run 时仅报告将被清理的报警数量.
+func runRetention(args []string) int {
+	fs, cf := newFlagSet("alert2pg retention")
+	dryRun := fs.Bool("dry-run", false, "仅统计将被清理的报警数量, 不修改数据库")
+	fs.Parse(args)
+
+	logger := newLogger(cf.logLevel)
+	cfg, err := config.Load(cf.configFile)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法加载配置文件", "文件", cf.configFile, "错误", err)
+		return 1
+	}
+
+	s, err := newPostgres(cfg, logger)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法连接数据库", "错误", err)
+		return 1
+	}
+	defer s.Close()
+
+	r, err := storage.NewRetention(s, logger, retentionOptions(cfg)...)
+	if err != nil {
+		level.Error(logger).Log("消息", "无法创建报警保留策略", "错误", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	if !*dryRun {
+		start := time.Now()
+		n, err := r.Prune(ctx)
+		if err != nil {
+			level.Error(logger).Log("消息", "清理过期报警失败", "已清理", n, "错误", err)
+			return 1
+		}
+		fmt.Printf("已清理 %d 条报警, 耗时 %s\n", n, time.Since(start))
+		return 0
+	}
+
+	reports, err := r.DryRun(ctx)
+	if err != nil {
+		level.Error(logger).Log("消息", "统计过期报警失败", "错误", err)
+		return 1
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "规则\t保留时长\t将被清理")
+	var total int64
+	for _, report := range reports {
+		rule := "默认"
+		if report.Rule != nil {
+			rule = report.Rule.Matchers.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", rule, model.Duration(report.MaxAge), report.Alerts)
+		total += report.Alerts
+	}
+	fmt.Fprintf(tw, "合计\t\t%d\n", total)
+	tw.Flush()
+	return 0
+}
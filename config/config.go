@@ -0,0 +1,546 @@
+// Package config 负责加载 alert2pg 的 YAML 配置文件.
+package config
+
+import (
+	"alert2pg/filter"
+	"alert2pg/pkg/matcher"
+	"alert2pg/pkg/relabel"
+	"alert2pg/pkg/tenant"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的存储后端.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// DefaultConfig 默认配置, 与各模块的默认选项保持一致.
+var DefaultConfig = Config{
+	Log: LogConfig{
+		Level: "",
+	},
+	Shutdown: ShutdownConfig{
+		GracePeriod: model.Duration(15 * time.Second),
+		Timeout:     model.Duration(30 * time.Second),
+		SpillFile:   "alert2pg.spill.json",
+	},
+	Alertmanager: AlertmanagerConfig{
+		Address: "localhost:9093",
+	},
+	Buffer: BufferConfig{
+		SyncInterval: model.Duration(1 * time.Second),
+		GcInterval:   model.Duration(5 * time.Minute),
+		MaxLifetime:  model.Duration(10 * time.Minute),
+		SyncFilter: SyncFilterConfig{
+			Active:      true,
+			Silenced:    true,
+			Inhibited:   true,
+			Unprocessed: true,
+		},
+		Flapping: FlappingConfig{
+			Window:    model.Duration(1 * time.Hour),
+			Threshold: 4,
+		},
+		MaxUnloaded: 100000,
+	},
+	Storage: StorageConfig{
+		Driver:           DriverPostgres,
+		Layout:           "eav",
+		Timeout:          model.Duration(5 * time.Second),
+		Parallelism:      4,
+		MinBatchInterval: model.Duration(10 * time.Millisecond),
+		ConnectRetry: ConnectRetryConfig{
+			InitialBackoff: model.Duration(1 * time.Second),
+			MaxBackoff:     model.Duration(1 * time.Minute),
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    5,
+			InitialBackoff: model.Duration(1 * time.Second),
+			MaxBackoff:     model.Duration(5 * time.Minute),
+		},
+		Partitioning: PartitioningConfig{
+			Enabled:  false,
+			Interval: model.Duration(1 * time.Hour),
+			Premake:  3,
+		},
+		Timescale: TimescaleConfig{
+			Enabled:       false,
+			ChunkInterval: model.Duration(7 * 24 * time.Hour),
+			CompressAfter: model.Duration(7 * 24 * time.Hour),
+		},
+	},
+	Silence: SilenceConfig{
+		Enabled:  true,
+		Interval: model.Duration(30 * time.Second),
+	},
+	Outbox: OutboxConfig{
+		Enabled:   false,
+		Interval:  model.Duration(1 * time.Second),
+		BatchSize: 100,
+		Timeout:   model.Duration(10 * time.Second),
+	},
+	Retention: RetentionConfig{
+		Enabled:   false,
+		Interval:  model.Duration(1 * time.Hour),
+		MaxAge:    model.Duration(90 * 24 * time.Hour),
+		BatchSize: 1000,
+	},
+	Analytics: AnalyticsConfig{
+		Enabled:  false,
+		Interval: model.Duration(5 * time.Minute),
+		Window:   model.Duration(24 * time.Hour),
+		GroupBy:  []string{"alertname", "cluster", "service"},
+		Top:      10,
+	},
+	Tenancy: TenancyConfig{
+		Enabled: false,
+		Header:  tenant.DefaultHeader,
+	},
+	Watchdog: WatchdogConfig{
+		Enabled:       false,
+		Match:         `{alertname="Watchdog"}`,
+		Timeout:       model.Duration(5 * time.Minute),
+		CheckInterval: model.Duration(30 * time.Second),
+		SyncFailures:  10,
+		Notify: WatchdogNotifyConfig{
+			Timeout: model.Duration(10 * time.Second),
+		},
+	},
+}
+
+type Config struct {
+	Log          LogConfig          `yaml:"log"`
+	Shutdown     ShutdownConfig     `yaml:"shutdown"`
+	Alertmanager AlertmanagerConfig `yaml:"alertmanager"`
+	Buffer       BufferConfig       `yaml:"buffer"`
+	Storage      StorageConfig      `yaml:"storage"`
+	Silence      SilenceConfig      `yaml:"silence"`
+	Outbox       OutboxConfig       `yaml:"outbox"`
+	Retention    RetentionConfig    `yaml:"retention"`
+	Analytics    AnalyticsConfig    `yaml:"analytics"`
+	Tenancy      TenancyConfig      `yaml:"tenancy"`
+	Relabel      relabel.Rules      `yaml:"relabel"`
+	Filter       FilterConfig       `yaml:"filter"`
+	Watchdog     WatchdogConfig     `yaml:"watchdog"`
+}
+
+// LogConfig 日志配置, 级别为空时使用命令行参数 --log.level.
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+// ShutdownConfig 优雅退出: 停止接收 webhook 请求, Buffer 完成最后一次同步, 在 Timeout 内存储剩余报警,
+// 仍未存储的报警写入 SpillFile, 下次启动时重新加载. SpillFile 为空时丢弃未存储的报警.
+type ShutdownConfig struct {
+	GracePeriod model.Duration `yaml:"grace_period"` // 等待处理中的 webhook 请求完成的时间
+	Timeout     model.Duration `yaml:"timeout"`      // 收到退出信号后存储剩余报警的截止时间
+	SpillFile   string         `yaml:"spill_file"`
+}
+
+// AlertmanagerConfig 同一集群中各 Alertmanager 实例的地址, 同步报警及归档静默规则时依次请求直到成功.
+type AlertmanagerConfig struct {
+	Addresses []string `yaml:"addresses"`
+	Address   string   `yaml:"address"` // 兼容旧版本的单个地址, 配置 Addresses 时忽略
+}
+
+// Addrs 返回 Alertmanager 地址列表, 未配置 Addresses 时使用 Address.
+func (c AlertmanagerConfig) Addrs() []string {
+	if len(c.Addresses) > 0 {
+		return c.Addresses
+	}
+	return []string{c.Address}
+}
+
+type BufferConfig struct {
+	SyncInterval model.Duration   `yaml:"sync_interval"`
+	GcInterval   model.Duration   `yaml:"gc_interval"`
+	MaxLifetime  model.Duration   `yaml:"max_lifetime"`
+	SyncFilter   SyncFilterConfig `yaml:"sync_filter"`
+	Flapping     FlappingConfig   `yaml:"flapping"`
+	// 未存储的报警数量上限, 数据库长时间不可用时超过上限后 webhook 返回 503, 为 0 时不限制.
+	MaxUnloaded int `yaml:"max_unloaded"`
+}
+
+// SyncFilterConfig 同步时从 Alertmanager 获取报警的过滤条件.
+type SyncFilterConfig struct {
+	Active      bool `yaml:"active"`
+	Silenced    bool `yaml:"silenced"`
+	Inhibited   bool `yaml:"inhibited"`
+	Unprocessed bool `yaml:"unprocessed"`
+}
+
+// FlappingConfig 报警抖动检测, 统计窗口内 Firing/Resolved 状态变化次数达到阈值时标记报警为抖动, 阈值为 0 时不检测.
+type FlappingConfig struct {
+	Window    model.Duration `yaml:"window"`
+	Threshold int            `yaml:"threshold"`
+}
+
+type StorageConfig struct {
+	Driver string `yaml:"driver"`
+	// DSN 中未配置的连接参数使用 PG* 环境变量, 连接服务文件及 ~/.pgpass 中的配置.
+	DSN               string         `yaml:"dsn"`
+	MaxConns          int32          `yaml:"max_conns"`           // 连接池最大连接数, 0 表示使用默认值
+	HealthCheckPeriod model.Duration `yaml:"health_check_period"` // 检查空闲连接的间隔, 0 表示使用默认值
+	PasswordFile      string         `yaml:"password_file"`       // 每次新建连接时读取密码的文件, 优先于 DSN 中的密码
+	NotifyChannel     string         `yaml:"notify_channel"`
+	SQLite            SQLiteConfig   `yaml:"sqlite"`
+	Layout            string         `yaml:"layout"`
+	Timeout           model.Duration `yaml:"timeout"`     // 存储一条报警信息的超时时间
+	Parallelism       int            `yaml:"parallelism"` // 并发存储报警信息的数量
+	// 两次批量存储之间的最小间隔, Buffer 中的报警变更在此期间合并为一个批次.
+	MinBatchInterval model.Duration     `yaml:"min_batch_interval"`
+	ConnectRetry     ConnectRetryConfig `yaml:"connect_retry"`
+	Retry            RetryConfig        `yaml:"retry"`
+	Partitioning     PartitioningConfig `yaml:"partitioning"`
+	Timescale        TimescaleConfig    `yaml:"timescale"`
+}
+
+// SQLiteConfig SQLite 存储后端配置.
+type SQLiteConfig struct {
+	Path string `yaml:"path"`
+}
+
+// ConnectRetryConfig 启动时无法连接 PostgreSQL 的重试策略, 连接成功前以降级模式运行, 报警保留在 Buffer 中.
+// InitialBackoff 为 0 时不重试, 无法连接数据库时直接退出.
+type ConnectRetryConfig struct {
+	InitialBackoff model.Duration `yaml:"initial_backoff"`
+	MaxBackoff     model.Duration `yaml:"max_backoff"`
+}
+
+// RetryConfig 存储失败报警的重试策略, 永久性错误达到最大尝试次数后写入死信表.
+type RetryConfig struct {
+	MaxAttempts    int            `yaml:"max_attempts"`
+	InitialBackoff model.Duration `yaml:"initial_backoff"`
+	MaxBackoff     model.Duration `yaml:"max_backoff"`
+}
+
+// PartitioningConfig 按 startsAt 月份对 Alert 及其子表分区, 仅在初始化表结构时生效.
+type PartitioningConfig struct {
+	Enabled   bool           `yaml:"enabled"`
+	Interval  model.Duration `yaml:"interval"`
+	Premake   int            `yaml:"premake"`
+	Retention model.Duration `yaml:"retention"`
+}
+
+// TimescaleConfig 使用 TimescaleDB 超表存储报警, 是否启用仅在初始化表结构时生效.
+type TimescaleConfig struct {
+	Enabled       bool           `yaml:"enabled"`
+	ChunkInterval model.Duration `yaml:"chunk_interval"`
+	CompressAfter model.Duration `yaml:"compress_after"`
+	Retention     model.Duration `yaml:"retention"`
+}
+
+type SilenceConfig struct {
+	Enabled  bool           `yaml:"enabled"`
+	Interval model.Duration `yaml:"interval"`
+}
+
+// AnalyticsConfig 定期统计数据库中的报警并导出为 Prometheus 指标.
+type AnalyticsConfig struct {
+	Enabled  bool           `yaml:"enabled"`
+	Interval model.Duration `yaml:"interval"`
+	Window   model.Duration `yaml:"window"`
+	GroupBy  []string       `yaml:"group_by"`
+	Top      int            `yaml:"top"`
+}
+
+// TenancyConfig 多租户: 报警所属租户依次从 Bearer Token, 请求头, 报警标签中解析, 均未携带时使用默认租户.
+type TenancyConfig struct {
+	Enabled   bool              `yaml:"enabled"`
+	Header    string            `yaml:"header"`
+	Label     string            `yaml:"label"`
+	Tokens    map[string]string `yaml:"tokens"` // Bearer Token 与租户的对应关系, 配置后请求必须携带有效的 Token
+	Default   string            `yaml:"default"`
+	MaxAlerts int               `yaml:"max_alerts"` // 每个租户在 Buffer 中的报警数量上限, 为 0 时不限制
+}
+
+// FilterConfig 报警写入 Buffer 前的过滤规则, 按顺序匹配, 首个匹配的规则生效.
+type FilterConfig struct {
+	Rules []FilterRuleConfig `yaml:"rules"`
+}
+
+// FilterRuleConfig 标签满足 Match 的报警执行 Action: drop, firing_only 或 summary_only.
+type FilterRuleConfig struct {
+	Name          string   `yaml:"name"`
+	Match         string   `yaml:"match"`
+	Action        string   `yaml:"action"`
+	SummaryLabels []string `yaml:"summary_labels"`
+}
+
+// Rule 返回过滤规则.
+func (r FilterRuleConfig) Rule() (filter.Rule, error) {
+	ms, err := matcher.Parse(r.Match)
+	if err != nil {
+		return filter.Rule{}, err
+	}
+	rule := filter.Rule{Name: r.Name, Matchers: ms, Action: filter.Action(r.Action), SummaryLabels: r.SummaryLabels}
+	return rule, rule.Validate()
+}
+
+// WatchdogConfig 心跳报警监控, 超过 Timeout 未收到标签满足 Match 的 Firing 报警,
+// 或 Buffer 与 Alertmanager 连续同步失败 SyncFailures 次时记录日志并发送通知.
+type WatchdogConfig struct {
+	Enabled       bool                 `yaml:"enabled"`
+	Match         string               `yaml:"match"`
+	Timeout       model.Duration       `yaml:"timeout"`
+	CheckInterval model.Duration       `yaml:"check_interval"`
+	SyncFailures  int                  `yaml:"sync_failures"`
+	Notify        WatchdogNotifyConfig `yaml:"notify"`
+}
+
+// WatchdogNotifyConfig 以 JSON 格式 POST 通知的地址, 为空时仅记录日志.
+type WatchdogNotifyConfig struct {
+	URL     string         `yaml:"url"`
+	Timeout model.Duration `yaml:"timeout"`
+}
+
+// OutboxConfig 将存储成功的报警通过 Outbox 表转发到消息总线, 至少配置一个发布者.
+type OutboxConfig struct {
+	Enabled   bool           `yaml:"enabled"`
+	Interval  model.Duration `yaml:"interval"`
+	BatchSize int            `yaml:"batch_size"`
+	Timeout   model.Duration `yaml:"timeout"`
+	Kafka     KafkaConfig    `yaml:"kafka"`
+	NATS      NATSConfig     `yaml:"nats"`
+	HTTP      WebhookConfig  `yaml:"http"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+}
+
+type NATSConfig struct {
+	URL     string `yaml:"url"`
+	Subject string `yaml:"subject"`
+}
+
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+}
+
+type RetentionConfig struct {
+	Enabled   bool                  `yaml:"enabled"`
+	Interval  model.Duration        `yaml:"interval"`
+	MaxAge    model.Duration        `yaml:"max_age"`
+	BatchSize int                   `yaml:"batch_size"`
+	Archive   bool                  `yaml:"archive"`
+	Rules     []RetentionRuleConfig `yaml:"rules"`
+}
+
+// RetentionRuleConfig 按标签覆盖默认保留时长, 按顺序匹配, 首个匹配的规则生效.
+// 使用 Match 指定 Prometheus 标签匹配表达式, 或使用 Label, Value 指定单个标签的值.
+type RetentionRuleConfig struct {
+	Match  string         `yaml:"match"`
+	Label  string         `yaml:"label"`
+	Value  string         `yaml:"value"`
+	MaxAge model.Duration `yaml:"max_age"`
+}
+
+// Matchers 返回规则的标签匹配条件.
+func (r RetentionRuleConfig) Matchers() (matcher.Matchers, error) {
+	if r.Match != "" {
+		return matcher.Parse(r.Match)
+	}
+	m, err := matcher.New(matcher.MatchEqual, r.Label, r.Value)
+	if err != nil {
+		return nil, err
+	}
+	return matcher.Matchers{m}, nil
+}
+
+// Load 加载并校验配置文件, 未配置的字段使用默认值.
+func Load(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取配置文件: %w", err)
+	}
+	return Parse(content)
+}
+
+// Parse 解析并校验配置内容, 未配置的字段使用默认值.
+func Parse(content []byte) (*Config, error) {
+	cfg := DefaultConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("无法解析配置文件: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate 校验配置内容.
+func (c *Config) Validate() error {
+	switch c.Log.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("无效的配置: log.level 仅支持 debug, info, warn, error")
+	}
+	if c.Shutdown.GracePeriod <= 0 || c.Shutdown.Timeout <= 0 {
+		return fmt.Errorf("无效的配置: shutdown 等待时间及截止时间必须大于 0")
+	}
+	if slices.Contains(c.Alertmanager.Addrs(), "") {
+		return fmt.Errorf("无效的配置: alertmanager.addresses 不能包含空地址")
+	}
+	if c.Buffer.SyncInterval <= 0 || c.Buffer.GcInterval <= 0 {
+		return fmt.Errorf("无效的配置: buffer 同步及回收间隔必须大于 0")
+	}
+	if f := c.Buffer.Flapping; f.Threshold < 0 || (f.Threshold > 0 && f.Window <= 0) {
+		return fmt.Errorf("无效的配置: buffer.flapping 阈值不能小于 0, 启用时统计窗口必须大于 0")
+	}
+	if c.Buffer.MaxUnloaded < 0 {
+		return fmt.Errorf("无效的配置: buffer.max_unloaded 不能小于 0")
+	}
+	switch c.Storage.Driver {
+	case DriverPostgres, DriverMemory:
+	case DriverSQLite:
+		if c.Storage.SQLite.Path == "" {
+			return fmt.Errorf("无效的配置: storage.sqlite.path 不能为空")
+		}
+	default:
+		return fmt.Errorf("无效的配置: storage.driver 仅支持 %s, %s, %s", DriverPostgres, DriverSQLite, DriverMemory)
+	}
+	if c.Storage.Driver != DriverPostgres && (c.Storage.Partitioning.Enabled || c.Storage.Timescale.Enabled || c.Retention.Enabled) {
+		return fmt.Errorf("无效的配置: storage.partitioning, storage.timescale 及 retention 仅支持 %s 存储后端", DriverPostgres)
+	}
+	if t := c.Storage.Timescale; t.Enabled {
+		if c.Storage.Partitioning.Enabled || c.Retention.Enabled {
+			return fmt.Errorf("无效的配置: storage.timescale 启用时使用 TimescaleDB 保留策略, 不能同时启用 storage.partitioning 及 retention")
+		}
+		if c.Storage.Layout != "jsonb" {
+			return fmt.Errorf("无效的配置: storage.timescale 仅支持 jsonb 存储方式")
+		}
+		if t.ChunkInterval <= 0 || t.CompressAfter < 0 || t.Retention < 0 {
+			return fmt.Errorf("无效的配置: storage.timescale 分块跨度必须大于 0, 压缩及保留时长不能小于 0")
+		}
+	}
+	if c.Storage.Layout != "eav" && c.Storage.Layout != "jsonb" {
+		return fmt.Errorf("无效的配置: storage.layout 仅支持 eav, jsonb")
+	}
+	if c.Storage.MaxConns < 0 || c.Storage.HealthCheckPeriod < 0 {
+		return fmt.Errorf("无效的配置: storage 最大连接数及检查空闲连接的间隔不能小于 0")
+	}
+	if c.Storage.Timeout <= 0 || c.Storage.Parallelism <= 0 || c.Storage.MinBatchInterval < 0 {
+		return fmt.Errorf("无效的配置: storage 超时时间及并发数量必须大于 0, 最小批次间隔不能小于 0")
+	}
+	if r := c.Storage.Retry; r.MaxAttempts <= 0 || r.InitialBackoff <= 0 || r.MaxBackoff < r.InitialBackoff {
+		return fmt.Errorf("无效的配置: storage.retry 最大尝试次数及退避时间必须大于 0, 且 max_backoff 不能小于 initial_backoff")
+	}
+	if r := c.Storage.ConnectRetry; r.InitialBackoff < 0 || (r.InitialBackoff > 0 && r.MaxBackoff < r.InitialBackoff) {
+		return fmt.Errorf("无效的配置: storage.connect_retry 退避时间不能小于 0, 且 max_backoff 不能小于 initial_backoff")
+	}
+	if p := c.Storage.Partitioning; p.Enabled && (p.Interval <= 0 || p.Premake < 0 || p.Retention < 0) {
+		return fmt.Errorf("无效的配置: storage.partitioning 维护间隔必须大于 0, 预创建分区数量及保留时长不能小于 0")
+	}
+	if o := c.Outbox; o.Enabled {
+		if c.Storage.Driver != DriverPostgres {
+			return fmt.Errorf("无效的配置: outbox 仅支持 %s 存储后端", DriverPostgres)
+		}
+		if o.Interval <= 0 || o.BatchSize <= 0 || o.Timeout <= 0 {
+			return fmt.Errorf("无效的配置: outbox 轮询间隔, 批次大小及超时时间必须大于 0")
+		}
+		if len(o.Kafka.Brokers) == 0 && o.NATS.URL == "" && o.HTTP.URL == "" {
+			return fmt.Errorf("无效的配置: outbox 至少需要配置 kafka, nats, http 中的一个发布者")
+		}
+		if len(o.Kafka.Brokers) > 0 && o.Kafka.Topic == "" {
+			return fmt.Errorf("无效的配置: outbox.kafka.topic 不能为空")
+		}
+		if o.NATS.URL != "" && o.NATS.Subject == "" {
+			return fmt.Errorf("无效的配置: outbox.nats.subject 不能为空")
+		}
+	}
+	if a := c.Analytics; a.Enabled {
+		if c.Storage.Driver != DriverPostgres {
+			return fmt.Errorf("无效的配置: analytics 仅支持 %s 存储后端", DriverPostgres)
+		}
+		if a.Interval <= 0 || a.Window <= 0 || a.Top <= 0 || len(a.GroupBy) == 0 {
+			return fmt.Errorf("无效的配置: analytics 刷新间隔, 统计窗口及 top 必须大于 0, group_by 不能为空")
+		}
+	}
+	if t := c.Tenancy; t.Enabled {
+		if c.Storage.Driver != DriverPostgres || c.Storage.Timescale.Enabled {
+			return fmt.Errorf("无效的配置: tenancy 仅支持 %s 存储后端, 且不能与 storage.timescale 同时启用", DriverPostgres)
+		}
+		if t.Header == "" && t.Label == "" && len(t.Tokens) == 0 && t.Default == "" {
+			return fmt.Errorf("无效的配置: tenancy 至少需要配置 header, label, tokens, default 中的一个")
+		}
+		if t.MaxAlerts < 0 {
+			return fmt.Errorf("无效的配置: tenancy.max_alerts 不能小于 0")
+		}
+		if t.Default != "" && !tenant.Valid(t.Default) {
+			return fmt.Errorf("无效的配置: tenancy.default 无效的租户 %q", t.Default)
+		}
+		for _, id := range t.Tokens {
+			if !tenant.Valid(id) {
+				return fmt.Errorf("无效的配置: tenancy.tokens 无效的租户 %q", id)
+			}
+		}
+	}
+	names := make(map[string]struct{}, len(c.Filter.Rules))
+	for i, r := range c.Filter.Rules {
+		if _, err := r.Rule(); err != nil {
+			return fmt.Errorf("无效的配置: filter.rules[%d]: %w", i, err)
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("无效的配置: filter.rules[%d] 重复的规则名称 %s", i, r.Name)
+		}
+		names[r.Name] = struct{}{}
+		// 按请求头或 Token 区分租户时仅默认租户与 Alertmanager 同步, 其他租户的报警只能通过 Resolved 通知恢复.
+		if t := c.Tenancy; filter.Action(r.Action) == filter.FiringOnly && t.Enabled && t.Label == "" && (t.Header != "" || len(t.Tokens) > 0) {
+			return fmt.Errorf("无效的配置: filter.rules[%d] 按 tenancy.header 或 tokens 区分租户时不能使用 %s, 需配置 tenancy.label", i, filter.FiringOnly)
+		}
+	}
+	if w := c.Watchdog; w.Enabled {
+		ms, err := matcher.Parse(w.Match)
+		if err != nil {
+			return fmt.Errorf("无效的配置: watchdog.match: %w", err)
+		}
+		if len(ms) == 0 {
+			return fmt.Errorf("无效的配置: watchdog.match 标签匹配条件不能为空")
+		}
+		if w.Timeout <= 0 || w.CheckInterval <= 0 || w.SyncFailures < 0 || w.Notify.Timeout <= 0 {
+			return fmt.Errorf("无效的配置: watchdog 超时时间及检查间隔必须大于 0, sync_failures 不能小于 0")
+		}
+	}
+	if c.Silence.Enabled && c.Silence.Interval <= 0 {
+		return fmt.Errorf("无效的配置: silence.interval 必须大于 0")
+	}
+	if c.Retention.Enabled {
+		if c.Retention.Interval <= 0 {
+			return fmt.Errorf("无效的配置: retention.interval 必须大于 0")
+		}
+		if c.Retention.BatchSize <= 0 {
+			return fmt.Errorf("无效的配置: retention.batch_size 必须大于 0")
+		}
+	}
+	if c.Retention.MaxAge <= 0 {
+		return fmt.Errorf("无效的配置: retention.max_age 必须大于 0")
+	}
+	for i, rule := range c.Retention.Rules {
+		if (rule.Label == "") == (rule.Match == "") || rule.MaxAge <= 0 {
+			return fmt.Errorf("无效的配置: retention.rules[%d] 需指定 match 或 label 其中之一, 且保留时长必须大于 0", i)
+		}
+		ms, err := rule.Matchers()
+		if err != nil {
+			return fmt.Errorf("无效的配置: retention.rules[%d].match: %w", i, err)
+		}
+		if len(ms) == 0 {
+			return fmt.Errorf("无效的配置: retention.rules[%d].match 标签匹配条件不能为空", i)
+		}
+	}
+	return nil
+}
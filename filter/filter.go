@@ -0,0 +1,216 @@
+// Package filter 在报警写入 Buffer 前按规则过滤报警, 避免心跳, 测试等无需存储的报警写入数据库.
+package filter
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Action 规则匹配报警后执行的动作.
+type Action string
+
+const (
+	// Drop 丢弃报警.
+	Drop Action = "drop"
+	// FiringOnly 仅保存报警的 Firing 状态变化, 丢弃 webhook 推送的 Resolved 通知,
+	// 报警的恢复由 Buffer 与 Alertmanager 同步时确定.
+	FiringOnly Action = "firing_only"
+	// SummaryOnly 仅保存报警摘要: SummaryLabels 中的标签及 summary 注释.
+	SummaryOnly Action = "summary_only"
+)
+
+// summaryAnnotation SummaryOnly 动作保留的注释.
+const summaryAnnotation = "summary"
+
+// DefaultSummaryLabels SummaryOnly 动作默认保留的标签.
+var DefaultSummaryLabels = []string{"alertname", "severity"}
+
+// Rule 过滤规则, 标签满足 Matchers 的报警执行 Action.
+type Rule struct {
+	Name          string
+	Matchers      matcher.Matchers
+	Action        Action
+	SummaryLabels []string // SummaryOnly 动作保留的标签, 为空时使用 DefaultSummaryLabels
+}
+
+// Validate 校验过滤规则.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if len(r.Matchers) == 0 {
+		return fmt.Errorf("规则 %s 的标签匹配条件不能为空", r.Name)
+	}
+	switch r.Action {
+	case Drop, FiringOnly, SummaryOnly:
+	default:
+		return fmt.Errorf("规则 %s 的动作 %q 无效, 仅支持 %s, %s, %s", r.Name, r.Action, Drop, FiringOnly, SummaryOnly)
+	}
+	return nil
+}
+
+// Filter 按顺序匹配过滤规则, 首个匹配的规则生效, 未匹配任何规则的报警保持不变.
+type Filter struct {
+	mu    sync.RWMutex
+	rules []Rule
+
+	droppedCounter    *prometheus.CounterVec
+	summarizedCounter *prometheus.CounterVec
+}
+
+func New(rules []Rule) (*Filter, error) {
+	if err := Validate(rules); err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		rules: rules,
+		droppedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "alert2pg",
+				Subsystem: "filter",
+				Name:      "dropped_alerts_total",
+				Help:      "Total number of alerts dropped per filter rule",
+			},
+			[]string{"rule"},
+		),
+		summarizedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "alert2pg",
+				Subsystem: "filter",
+				Name:      "summarized_alerts_total",
+				Help:      "Total number of alerts reduced to a summary per filter rule",
+			},
+			[]string{"rule"},
+		),
+	}
+	f.initCounters(rules)
+	return f, nil
+}
+
+// Update 替换过滤规则, 规则无效时保留当前规则. 已删除规则的计数不再导出.
+func (f *Filter) Update(rules []Rule) error {
+	if err := Validate(rules); err != nil {
+		return err
+	}
+
+	names := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		names[r.Name] = struct{}{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.rules {
+		if _, ok := names[r.Name]; !ok {
+			f.droppedCounter.DeleteLabelValues(r.Name)
+			f.summarizedCounter.DeleteLabelValues(r.Name)
+		}
+	}
+	f.rules = rules
+	f.initCounters(rules)
+	return nil
+}
+
+// Validate 校验规则, 规则名称不能重复.
+func Validate(rules []Rule) error {
+	names := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("重复的规则名称: %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+	}
+	return nil
+}
+
+// initCounters 初始化各规则的计数, 未匹配过报警的规则也导出为 0.
+func (f *Filter) initCounters(rules []Rule) {
+	for _, r := range rules {
+		f.droppedCounter.WithLabelValues(r.Name)
+		if r.Action == SummaryOnly {
+			f.summarizedCounter.WithLabelValues(r.Name)
+		}
+	}
+}
+
+// Process 过滤报警, 返回需要写入 Buffer 的报警, 不修改传入的报警.
+func (f *Filter) Process(alerts alert.Alerts) alert.Alerts {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.rules) == 0 {
+		return alerts
+	}
+	rlt := make(alert.Alerts, 0, len(alerts))
+	for _, a := range alerts {
+		rule, ok := f.match(a)
+		if !ok {
+			rlt = append(rlt, a)
+			continue
+		}
+		switch rule.Action {
+		case Drop:
+			f.droppedCounter.WithLabelValues(rule.Name).Inc()
+		case FiringOnly:
+			if a.Status != alert.Firing {
+				f.droppedCounter.WithLabelValues(rule.Name).Inc()
+				continue
+			}
+			rlt = append(rlt, a)
+		case SummaryOnly:
+			f.summarizedCounter.WithLabelValues(rule.Name).Inc()
+			rlt = append(rlt, summarize(a, rule.SummaryLabels))
+		}
+	}
+	return rlt
+}
+
+// match 返回首个匹配报警的规则.
+func (f *Filter) match(a alert.Alert) (Rule, bool) {
+	for _, r := range f.rules {
+		if r.Matchers.Matches(a.Labels) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// summarize 返回仅包含摘要信息的报警.
+func summarize(a alert.Alert, labels []string) alert.Alert {
+	if len(labels) == 0 {
+		labels = DefaultSummaryLabels
+	}
+	kept := make(map[string]string, len(labels))
+	for _, name := range labels {
+		if v, ok := a.Labels[name]; ok {
+			kept[name] = v
+		}
+	}
+	annotations := make(map[string]string, 1)
+	if v, ok := a.Annotations[summaryAnnotation]; ok {
+		annotations[summaryAnnotation] = v
+	}
+	a.Labels, a.Annotations = kept, annotations
+	a.GeneratorURL = ""
+	return a
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (f *Filter) Describe(ch chan<- *prometheus.Desc) {
+	f.droppedCounter.Describe(ch)
+	f.summarizedCounter.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (f *Filter) Collect(ch chan<- prometheus.Metric) {
+	f.droppedCounter.Collect(ch)
+	f.summarizedCounter.Collect(ch)
+}
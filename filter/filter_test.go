@@ -0,0 +1,93 @@
+package filter
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newAlert(fingerprint, status string, labels map[string]string) alert.Alert {
+	a := alert.DefaultAlert()
+	a.Fingerprint = fingerprint
+	a.Status = status
+	a.Labels = labels
+	a.Annotations = map[string]string{"summary": "摘要", "description": "详细描述"}
+	a.GeneratorURL = "http://prometheus/graph"
+	return a
+}
+
+func TestFilter_Process(t *testing.T) {
+	f, err := New([]Rule{
+		{Name: "heartbeat", Matchers: matcher.MustParse(`{alertname=~"Watchdog|InfoInhibitor"}`), Action: Drop},
+		{Name: "events", Matchers: matcher.MustParse(`{kind="event"}`), Action: FiringOnly},
+		{Name: "batch", Matchers: matcher.MustParse(`{team="batch"}`), Action: SummaryOnly, SummaryLabels: []string{"alertname", "team"}},
+		// 首个匹配的规则生效.
+		{Name: "shadowed", Matchers: matcher.MustParse(`{alertname="Watchdog"}`), Action: SummaryOnly},
+	})
+	require.NoError(t, err)
+
+	input := alert.Alerts{
+		newAlert("a1", alert.Firing, map[string]string{"alertname": "Watchdog"}),
+		newAlert("a2", alert.Firing, map[string]string{"alertname": "Deploy", "kind": "event"}),
+		newAlert("a3", alert.Resolved, map[string]string{"alertname": "Deploy", "kind": "event"}),
+		newAlert("a4", alert.Firing, map[string]string{"alertname": "JobFailed", "team": "batch", "job": "etl"}),
+		newAlert("a5", alert.Firing, map[string]string{"alertname": "HighLatency"}),
+	}
+	got := f.Process(input)
+
+	fingerprints := make([]string, 0, len(got))
+	for _, a := range got {
+		fingerprints = append(fingerprints, a.Fingerprint)
+	}
+	require.Equal(t, []string{"a2", "a4", "a5"}, fingerprints)
+
+	// 摘要报警仅保留指定标签及 summary 注释, 不修改传入的报警.
+	require.Equal(t, map[string]string{"alertname": "JobFailed", "team": "batch"}, got[1].Labels)
+	require.Equal(t, map[string]string{"summary": "摘要"}, got[1].Annotations)
+	require.Empty(t, got[1].GeneratorURL)
+	require.Equal(t, "etl", input[3].Labels["job"])
+	require.Equal(t, input[4], got[2])
+
+	require.Equal(t, 1.0, testutil.ToFloat64(f.droppedCounter.WithLabelValues("heartbeat")))
+	require.Equal(t, 1.0, testutil.ToFloat64(f.droppedCounter.WithLabelValues("events")))
+	require.Equal(t, 0.0, testutil.ToFloat64(f.droppedCounter.WithLabelValues("batch")))
+	require.Equal(t, 1.0, testutil.ToFloat64(f.summarizedCounter.WithLabelValues("batch")))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	ms := matcher.MustParse(`alertname="Watchdog"`)
+	for _, rules := range [][]Rule{
+		{{Matchers: ms, Action: Drop}},
+		{{Name: "a", Action: Drop}},
+		{{Name: "a", Matchers: ms, Action: "sample"}},
+		{{Name: "a", Matchers: ms, Action: Drop}, {Name: "a", Matchers: ms, Action: FiringOnly}},
+	} {
+		_, err := New(rules)
+		require.Error(t, err)
+	}
+}
+
+func TestFilter_Update(t *testing.T) {
+	f, err := New([]Rule{
+		{Name: "heartbeat", Matchers: matcher.MustParse(`{alertname="Watchdog"}`), Action: Drop},
+		{Name: "test", Matchers: matcher.MustParse(`{env="test"}`), Action: Drop},
+	})
+	require.NoError(t, err)
+	f.Process(alert.Alerts{newAlert("a1", alert.Firing, map[string]string{"alertname": "Watchdog"})})
+
+	// 无效的规则不替换当前规则.
+	require.Error(t, f.Update([]Rule{{Name: "invalid", Action: Drop}}))
+	require.Equal(t, 2, testutil.CollectAndCount(f.droppedCounter))
+
+	// 保留规则的计数, 删除已移除规则的计数.
+	require.NoError(t, f.Update([]Rule{
+		{Name: "heartbeat", Matchers: matcher.MustParse(`{alertname="Watchdog"}`), Action: Drop},
+	}))
+	require.Equal(t, 1, testutil.CollectAndCount(f.droppedCounter))
+	require.Equal(t, 1.0, testutil.ToFloat64(f.droppedCounter.WithLabelValues("heartbeat")))
+	got := f.Process(alert.Alerts{newAlert("a2", alert.Firing, map[string]string{"alertname": "X", "env": "test"})})
+	require.Len(t, got, 1)
+}
@@ -11,6 +11,12 @@ const (
 	Resolved = "resolved" // 报警状态: Resolved
 )
 
+const (
+	StateActive      = "active"      // Alertmanager 报警状态: 正常通知
+	StateSuppressed  = "suppressed"  // Alertmanager 报警状态: 被静默或抑制
+	StateUnprocessed = "unprocessed" // Alertmanager 报警状态: 尚未处理
+)
+
 func DefaultAlert() Alert {
 	return Alert{
 		Loaded:   false,
@@ -42,6 +48,9 @@ type Alert struct {
 	// 2) 当 loaded 为 True 时, 重复接收并"逻辑层面(非真实写入)"将该报警信息成功写入到数据库的时间.
 	LoadedAt time.Time `json:"-"`
 
+	// 报警所属租户, 由 webhook 根据租户配置设置, 未启用多租户时为空.
+	Tenant string `json:"tenant,omitempty"`
+
 	// 报警信息
 	Fingerprint  string            `json:"fingerprint"`
 	Status       string            `json:"status"`
@@ -50,6 +59,17 @@ type Alert struct {
 	Labels       map[string]string `json:"labels"`
 	Annotations  map[string]string `json:"annotations"`
 	GeneratorURL string            `json:"generatorURL"`
+
+	// Alertmanager v2 API 中的报警状态信息, webhook 推送的报警中不包含以下字段, 由 Buffer 同步时更新.
+	State       string    `json:"state,omitempty"`
+	SilencedBy  []string  `json:"silencedBy,omitempty"`
+	InhibitedBy []string  `json:"inhibitedBy,omitempty"`
+	Receivers   []string  `json:"receivers,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt,omitempty"`
+
+	// Buffer 检测到的报警抖动信息: 统计窗口内相同 fingerprint 的 Firing/Resolved 状态变化次数, 超过阈值时标记为抖动.
+	Flapping    bool `json:"flapping,omitempty"`
+	Transitions int  `json:"transitions,omitempty"`
 }
 
 // UnmarshalJSON 实现自定义的 JSON 反序列化方法, 确保反序列化时标记字段被初始化.
@@ -59,7 +79,11 @@ func (a *Alert) UnmarshalJSON(data []byte) error {
 	return json.Unmarshal(data, (*plain)(a))
 }
 
+// Key 返回报警的唯一标识, 启用多租户时以租户为前缀, 避免不同租户相同 fingerprint 的报警冲突.
 func (a *Alert) Key() string {
+	if a.Tenant != "" {
+		return fmt.Sprintf("%s/%s:%d", a.Tenant, a.Fingerprint, a.StartsAt.UnixMilli())
+	}
 	return fmt.Sprintf("%s:%d", a.Fingerprint, a.StartsAt.UnixMilli())
 }
 
@@ -83,6 +107,42 @@ func (a Alert) Equal(b Alert) bool {
 	return true
 }
 
+// StateEqual 判断 Alertmanager 中的报警状态信息是否一致, 不比较 UpdatedAt.
+func (a Alert) StateEqual(b Alert) bool {
+	return a.State == b.State &&
+		stringSliceEqual(a.SilencedBy, b.SilencedBy) &&
+		stringSliceEqual(a.InhibitedBy, b.InhibitedBy) &&
+		stringSliceEqual(a.Receivers, b.Receivers)
+}
+
+// HasState 判断报警是否携带 Alertmanager 中的报警状态信息.
+func (a Alert) HasState() bool {
+	return a.State != ""
+}
+
+// SetState 使用 b 中的报警状态信息更新报警, 状态发生变化时报警需要重新写入数据库.
+func (a *Alert) SetState(b Alert) {
+	if !a.StateEqual(b) {
+		a.Loaded = false
+		a.LoadedAt = time.Now()
+	}
+	a.State = b.State
+	a.SilencedBy = cloneStringSlice(b.SilencedBy)
+	a.InhibitedBy = cloneStringSlice(b.InhibitedBy)
+	a.Receivers = cloneStringSlice(b.Receivers)
+	a.UpdatedAt = b.UpdatedAt
+}
+
+// IsSilenced 判断报警是否被静默.
+func (a Alert) IsSilenced() bool {
+	return len(a.SilencedBy) > 0
+}
+
+// IsInhibited 判断报警是否被抑制.
+func (a Alert) IsInhibited() bool {
+	return len(a.InhibitedBy) > 0
+}
+
 // IsExpired 判断 Resolved 报警信息是否过期.
 func (a Alert) IsExpired(t time.Duration) bool {
 	//
@@ -101,6 +161,7 @@ func (a *Alert) Clone() *Alert {
 	return &Alert{
 		Loaded:       a.Loaded,
 		LoadedAt:     a.LoadedAt,
+		Tenant:       a.Tenant,
 		Fingerprint:  a.Fingerprint,
 		Status:       a.Status,
 		StartsAt:     a.StartsAt,
@@ -108,6 +169,13 @@ func (a *Alert) Clone() *Alert {
 		Labels:       cloneStringMap(a.Labels),
 		Annotations:  cloneStringMap(a.Annotations),
 		GeneratorURL: a.GeneratorURL,
+		State:        a.State,
+		SilencedBy:   cloneStringSlice(a.SilencedBy),
+		InhibitedBy:  cloneStringSlice(a.InhibitedBy),
+		Receivers:    cloneStringSlice(a.Receivers),
+		UpdatedAt:    a.UpdatedAt,
+		Flapping:     a.Flapping,
+		Transitions:  a.Transitions,
 	}
 }
 
@@ -122,3 +190,26 @@ func cloneStringMap(src map[string]string) map[string]string {
 	}
 	return dst
 }
+
+// cloneStringSlice 深拷贝切片.
+func cloneStringSlice(src []string) []string {
+	if src == nil {
+		return nil
+	}
+	dst := make([]string, len(src))
+	copy(dst, src)
+	return dst
+}
+
+// stringSliceEqual 判断两个切片内容是否一致, nil 与空切片视为一致.
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
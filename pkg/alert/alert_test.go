@@ -245,3 +245,28 @@ func TestAlert_Clone(t *testing.T) {
 		t.Errorf("原始数据与副本之间非深拷贝")
 	}
 }
+
+func TestAlert_SetState(t *testing.T) {
+	alert := Alert{
+		Loaded:   true,
+		LoadedAt: time.Now().Add(-time.Hour),
+		Status:   Firing,
+		State:    StateActive,
+	}
+
+	// 仅更新时间变化时不需要重新写入数据库.
+	updatedAt := time.Now()
+	alert.SetState(Alert{State: StateActive, UpdatedAt: updatedAt})
+	require.True(t, alert.Loaded)
+	require.Equal(t, updatedAt, alert.UpdatedAt)
+
+	// 报警被静默时需要重新写入数据库.
+	alert.SetState(Alert{State: StateSuppressed, SilencedBy: []string{"silence-id"}, UpdatedAt: updatedAt})
+	require.False(t, alert.Loaded)
+	require.Equal(t, StateSuppressed, alert.State)
+	require.True(t, alert.IsSilenced())
+	require.False(t, alert.IsInhibited())
+
+	// nil 与空切片视为一致.
+	require.True(t, Alert{State: StateActive}.StateEqual(Alert{State: StateActive, SilencedBy: []string{}}))
+}
@@ -0,0 +1,38 @@
+package alert
+
+import "time"
+
+const (
+	SilenceActive  = "active"  // 静默状态: 生效中
+	SilencePending = "pending" // 静默状态: 尚未开始
+	SilenceExpired = "expired" // 静默状态: 已过期
+)
+
+type Silences []Silence
+
+// Silence Alertmanager 中的静默规则.
+type Silence struct {
+	ID        string          `json:"id"`
+	Matchers  SilenceMatchers `json:"matchers"`
+	StartsAt  time.Time       `json:"startsAt"`
+	EndsAt    time.Time       `json:"endsAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	CreatedBy string          `json:"createdBy"`
+	Comment   string          `json:"comment"`
+	State     string          `json:"state"`
+}
+
+type SilenceMatchers []SilenceMatcher
+
+// SilenceMatcher 静默规则中的标签匹配条件.
+type SilenceMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// IsExpired 判断静默规则是否已过期.
+func (s Silence) IsExpired() bool {
+	return s.State == SilenceExpired
+}
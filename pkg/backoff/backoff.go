@@ -0,0 +1,33 @@
+// Package backoff 计算失败重试的指数退避时间, 用于存储重试, 数据库重连及 LISTEN 重连.
+package backoff
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff 指数退避, 退避时间从 Initial 开始按 2 的指数增长, 不超过 Max, 并增加至多 20% 的随机抖动,
+// 避免多个实例同时重试. Max 小于等于 0 时不限制最大退避时间.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Duration 返回第 attempts 次失败后的退避时间, attempts 从 1 开始.
+func (b Backoff) Duration(attempts int) time.Duration {
+	limit := b.Max
+	if limit <= 0 {
+		// 加上抖动后不溢出.
+		limit = math.MaxInt64 / 2
+	}
+	d := b.Initial
+	for i := 1; i < attempts && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	if d > 0 {
+		d += time.Duration(rand.Int64N(int64(d)/5 + 1))
+	}
+	return d
+}
@@ -0,0 +1,40 @@
+package backoff
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff_Duration(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  Backoff
+		attempts int
+		want     time.Duration
+	}{
+		{"首次失败", Backoff{time.Second, 10 * time.Second}, 1, time.Second},
+		{"指数增长", Backoff{time.Second, 10 * time.Second}, 2, 2 * time.Second},
+		{"指数增长", Backoff{time.Second, 10 * time.Second}, 4, 8 * time.Second},
+		{"不超过最大退避时间", Backoff{time.Second, 10 * time.Second}, 5, 10 * time.Second},
+		{"不超过最大退避时间", Backoff{time.Second, 10 * time.Second}, 1000, 10 * time.Second},
+		{"初始值大于最大值", Backoff{time.Minute, 10 * time.Second}, 1, 10 * time.Second},
+		{"不限制最大退避时间", Backoff{time.Second, 0}, 11, 1024 * time.Second},
+		{"未设置退避时间", Backoff{}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 10 {
+				got := tt.backoff.Duration(tt.attempts)
+				require.GreaterOrEqual(t, got, tt.want)
+				require.LessOrEqual(t, got, tt.want+tt.want/5)
+			}
+		})
+	}
+
+	// 不限制最大退避时间时不溢出.
+	got := Backoff{Initial: time.Second}.Duration(math.MaxInt)
+	require.Greater(t, got, time.Duration(0))
+}
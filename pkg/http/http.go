@@ -4,70 +4,180 @@ import (
 	"alert2pg/pkg/alert"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 )
 
+// Alert Alertmanager v2 API 返回的报警信息.
 type Alert struct {
 	Fingerprint  string            `json:"fingerprint"`
-	Status       string            `json:"-"`
+	Status       AlertStatus       `json:"status"`
+	Receivers    []Receiver        `json:"receivers"`
 	StartsAt     time.Time         `json:"startsAt"`
 	EndsAt       time.Time         `json:"endsAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
 	Labels       map[string]string `json:"labels"`
 	Annotations  map[string]string `json:"annotations"`
 	GeneratorURL string            `json:"generatorURL"`
 }
 
+// AlertStatus Alertmanager v2 API 中的报警状态.
+type AlertStatus struct {
+	State       string   `json:"state"`
+	SilencedBy  []string `json:"silencedBy"`
+	InhibitedBy []string `json:"inhibitedBy"`
+}
+
+// Receiver Alertmanager v2 API 中的报警接收者.
+type Receiver struct {
+	Name string `json:"name"`
+}
+
 func (a *Alert) UnmarshalJSON(data []byte) error {
 	type plain Alert
 	*a = Alert{
-		Status:      alert.Firing,
 		Labels:      make(map[string]string),
 		Annotations: make(map[string]string),
 	}
 	return json.Unmarshal(data, (*plain)(a))
 }
 
+// Convert 将 Alertmanager v2 API 报警信息转换为 alert.Alert, 并初始化标记位.
+// 报警结束时间不晚于更新时间时视为 Resolved, 否则为 Firing.
+func (a Alert) Convert() alert.Alert {
+	status := alert.Firing
+	if !a.EndsAt.IsZero() && !a.EndsAt.After(a.UpdatedAt) {
+		status = alert.Resolved
+	}
+
+	receivers := make([]string, 0, len(a.Receivers))
+	for _, r := range a.Receivers {
+		receivers = append(receivers, r.Name)
+	}
+
+	return alert.Alert{
+		Fingerprint:  a.Fingerprint,
+		Status:       status,
+		StartsAt:     a.StartsAt,
+		EndsAt:       a.EndsAt,
+		Labels:       a.Labels,
+		Annotations:  a.Annotations,
+		GeneratorURL: a.GeneratorURL,
+		State:        a.Status.State,
+		SilencedBy:   a.Status.SilencedBy,
+		InhibitedBy:  a.Status.InhibitedBy,
+		Receivers:    receivers,
+		UpdatedAt:    a.UpdatedAt,
+		Loaded:       false,
+		LoadedAt:     time.Now(),
+	}
+}
+
 type Alerts []Alert
 
+// Silence Alertmanager v2 API 返回的静默规则.
+type Silence struct {
+	ID        string                `json:"id"`
+	Status    SilenceStatus         `json:"status"`
+	Matchers  alert.SilenceMatchers `json:"matchers"`
+	StartsAt  time.Time             `json:"startsAt"`
+	EndsAt    time.Time             `json:"endsAt"`
+	UpdatedAt time.Time             `json:"updatedAt"`
+	CreatedBy string                `json:"createdBy"`
+	Comment   string                `json:"comment"`
+}
+
+// SilenceStatus Alertmanager v2 API 中的静默规则状态.
+type SilenceStatus struct {
+	State string `json:"state"`
+}
+
+// Convert 将 Alertmanager v2 API 静默规则转换为 alert.Silence.
+func (s Silence) Convert() alert.Silence {
+	return alert.Silence{
+		ID:        s.ID,
+		Matchers:  s.Matchers,
+		StartsAt:  s.StartsAt,
+		EndsAt:    s.EndsAt,
+		UpdatedAt: s.UpdatedAt,
+		CreatedBy: s.CreatedBy,
+		Comment:   s.Comment,
+		State:     s.Status.State,
+	}
+}
+
 // GetFiringAlertsFromAlertmanager 从 Alertmanager 获取当前处于 Firing 状态的报警信息, 并初始化标记位.
-func GetFiringAlertsFromAlertmanager(addr string, active, silenced, inhibited, unprocessed bool) (alert.Alerts, error) {
+// 依次请求 addrs 中的 Alertmanager, 同一集群的实例之间同步报警, 任一实例请求成功即返回.
+func GetFiringAlertsFromAlertmanager(addrs []string, active, silenced, inhibited, unprocessed bool) (alert.Alerts, error) {
 	alerts := make(alert.Alerts, 0)
+	path := fmt.Sprintf("/api/v2/alerts?active=%t&silenced=%t&inhibited=%t&unprocessed=%t", active, silenced, inhibited, unprocessed)
+	rlt, err := getAny[Alerts](addrs, path)
+	if err != nil {
+		return alerts, err
+	}
+
+	for _, a := range rlt {
+		alerts = append(alerts, a.Convert())
+	}
+
+	return alerts, nil
+}
+
+// GetSilencesFromAlertmanager 从 Alertmanager 获取全部静默规则, 包括已过期但尚未被 Alertmanager 清理的静默规则.
+// 依次请求 addrs 中的 Alertmanager, 任一实例请求成功即返回.
+func GetSilencesFromAlertmanager(addrs []string) (alert.Silences, error) {
+	silences := make(alert.Silences, 0)
+	rlt, err := getAny[[]Silence](addrs, "/api/v2/silences")
+	if err != nil {
+		return silences, err
+	}
+
+	for _, s := range rlt {
+		silences = append(silences, s.Convert())
+	}
+
+	return silences, nil
+}
+
+// getAny 依次请求 addrs 中的 Alertmanager API, 返回首个成功的响应, 全部失败时返回各地址的错误.
+func getAny[T any](addrs []string, path string) (T, error) {
+	var zero T
+	if len(addrs) == 0 {
+		return zero, fmt.Errorf("未配置 Alertmanager 地址")
+	}
+	errs := make([]error, 0, len(addrs))
+	for _, addr := range addrs {
+		var v T
+		err := get("http://"+addr+path, &v)
+		if err == nil {
+			return v, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+	}
+	return zero, errors.Join(errs...)
+}
+
+// get 请求 Alertmanager API 并将响应体解析到 v 中.
+func get(url string, v any) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	url := fmt.Sprintf("http://%s/api/v2/alerts?active=%t&silenced=%t&inhibited=%t&unprocessed=%t", addr, active, silenced, inhibited, unprocessed)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return alerts, fmt.Errorf("无法创建请求: %w", err)
+		return fmt.Errorf("无法创建请求: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return alerts, fmt.Errorf("无法发送请求: %w", err)
+		return fmt.Errorf("无法发送请求: %w", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return alerts, fmt.Errorf("请求失败: %s", resp.Status)
+		return fmt.Errorf("请求失败: %s", resp.Status)
 	}
-	var rlt Alerts
-	if err := json.NewDecoder(resp.Body).Decode(&rlt); err != nil {
-		return alerts, fmt.Errorf("无法解析响应体: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("无法解析响应体: %w", err)
 	}
-
-	for _, a := range rlt {
-		alerts = append(alerts, alert.Alert{
-			Fingerprint:  a.Fingerprint,
-			Status:       a.Status,
-			StartsAt:     a.StartsAt,
-			EndsAt:       a.EndsAt,
-			Labels:       a.Labels,
-			Annotations:  a.Annotations,
-			GeneratorURL: a.GeneratorURL,
-			Loaded:       false,
-			LoadedAt:     time.Now(),
-		})
-	}
-
-	return alerts, nil
+	return nil
 }
@@ -107,6 +107,11 @@ func TestGetFiringAlertsFromAlertmanager_Success(t *testing.T) {
 				"summary":     "节点可用率低于90%",
 			},
 			GeneratorURL: "/graph?g0.expr=cluster_availability%7Bcluster%3D%22test%22%2Csource%3D%22other%22%7D+%3C+0.9&g0.tab=1",
+			State:        alert.StateActive,
+			SilencedBy:   []string{},
+			InhibitedBy:  []string{},
+			Receivers:    []string{"web_hook_default"},
+			UpdatedAt:    time.Date(2025, 7, 8, 6, 1, 48, 609000000, time.UTC),
 		},
 		{
 			Loaded:      false,
@@ -130,13 +135,22 @@ func TestGetFiringAlertsFromAlertmanager_Success(t *testing.T) {
 				"summary":     "0008卷降级",
 			},
 			GeneratorURL: "/graph?g0.expr=lustre_volume_degraded%7Bcluster%3D%22test%22%2Cdevice%3D%22oss1%22%2Cvolume%3D%220008%22%7D+%3E+0&g0.tab=1",
+			State:        alert.StateActive,
+			SilencedBy:   []string{},
+			InhibitedBy:  []string{},
+			Receivers:    []string{"web_hook_default"},
+			UpdatedAt:    time.Date(2025, 7, 8, 6, 1, 48, 595000000, time.UTC),
 		},
 	}
 	server := mockAlertmanagerServer(t, http.StatusOK, content)
 	defer server.Close()
 
-	addr := server.Listener.Addr().String()
-	actual, err := GetFiringAlertsFromAlertmanager(addr, true, false, false, false)
+	// 第一个 Alertmanager 不可用时请求下一个.
+	failed := mockAlertmanagerServer(t, http.StatusServiceUnavailable, "")
+	defer failed.Close()
+
+	addrs := []string{failed.Listener.Addr().String(), server.Listener.Addr().String()}
+	actual, err := GetFiringAlertsFromAlertmanager(addrs, true, false, false, false)
 	require.NoError(t, err)
 	require.Len(t, actual, 2)
 	sort.Slice(expected, func(i, j int) bool {
@@ -149,5 +163,144 @@ func TestGetFiringAlertsFromAlertmanager_Success(t *testing.T) {
 		require.False(t, actual[i].Loaded)
 		require.True(t, actual[i].LoadedAt.After(expected[i].LoadedAt))
 		require.True(t, actual[i].Equal(expected[i]))
+		require.True(t, actual[i].StateEqual(expected[i]))
+		require.Equal(t, expected[i].UpdatedAt, actual[i].UpdatedAt)
 	}
 }
+
+func TestGetFiringAlertsFromAlertmanager_Suppressed(t *testing.T) {
+	content := `
+	[
+		{
+			"annotations": {},
+			"endsAt": "2025-07-08T06:05:48.268Z",
+			"fingerprint": "077bf4e884599215",
+			"receivers": [{"name": "web_hook_default"}, {"name": "email"}],
+			"startsAt": "2025-07-02T22:23:18.268Z",
+			"status": {
+				"inhibitedBy": ["0de75c943e4d50f9"],
+				"silencedBy": ["d3a0c1f2-4b5e-4c6d-8e9f-0a1b2c3d4e5f"],
+				"state": "suppressed"
+			},
+			"updatedAt": "2025-07-08T06:01:48.609Z",
+			"generatorURL": "",
+			"labels": {"alertname": "clusterAvailabilityLow"}
+		},
+		{
+			"annotations": {},
+			"endsAt": "2025-07-08T06:00:00.000Z",
+			"fingerprint": "0de75c943e4d50f9",
+			"receivers": [],
+			"startsAt": "2025-07-07T10:23:03.268Z",
+			"status": {"inhibitedBy": [], "silencedBy": [], "state": "active"},
+			"updatedAt": "2025-07-08T06:01:48.595Z",
+			"generatorURL": "",
+			"labels": {"alertname": "lustreDegraded"}
+		}
+	]
+	`
+	server := mockAlertmanagerServer(t, http.StatusOK, content)
+	defer server.Close()
+
+	actual, err := GetFiringAlertsFromAlertmanager([]string{server.Listener.Addr().String()}, true, true, true, true)
+	require.NoError(t, err)
+	require.Len(t, actual, 2)
+	sort.Slice(actual, func(i, j int) bool {
+		return actual[i].Fingerprint < actual[j].Fingerprint
+	})
+
+	require.Equal(t, alert.Firing, actual[0].Status)
+	require.Equal(t, alert.StateSuppressed, actual[0].State)
+	require.True(t, actual[0].IsSilenced())
+	require.True(t, actual[0].IsInhibited())
+	require.Equal(t, []string{"d3a0c1f2-4b5e-4c6d-8e9f-0a1b2c3d4e5f"}, actual[0].SilencedBy)
+	require.Equal(t, []string{"0de75c943e4d50f9"}, actual[0].InhibitedBy)
+	require.Equal(t, []string{"web_hook_default", "email"}, actual[0].Receivers)
+
+	// 结束时间早于更新时间, 视为 Resolved.
+	require.Equal(t, alert.Resolved, actual[1].Status)
+	require.False(t, actual[1].IsSilenced())
+	require.False(t, actual[1].IsInhibited())
+}
+
+func TestGetSilencesFromAlertmanager_Success(t *testing.T) {
+	content := `
+	[
+		{
+			"id": "d3a0c1f2-4b5e-4c6d-8e9f-0a1b2c3d4e5f",
+			"status": {"state": "active"},
+			"updatedAt": "2025-07-08T06:01:48.609Z",
+			"comment": "存储维护",
+			"createdBy": "admin",
+			"endsAt": "2025-07-08T08:00:00.000Z",
+			"startsAt": "2025-07-08T06:00:00.000Z",
+			"matchers": [
+				{"isEqual": true, "isRegex": false, "name": "cluster", "value": "test"},
+				{"isEqual": true, "isRegex": true, "name": "alertname", "value": "lustre.*"}
+			]
+		},
+		{
+			"id": "5c9b3e7a-1f2d-4a6b-9c8d-7e6f5a4b3c2d",
+			"status": {"state": "expired"},
+			"updatedAt": "2025-07-07T06:01:48.609Z",
+			"comment": "",
+			"createdBy": "ops",
+			"endsAt": "2025-07-07T08:00:00.000Z",
+			"startsAt": "2025-07-07T06:00:00.000Z",
+			"matchers": [
+				{"isEqual": false, "isRegex": false, "name": "severity", "value": "INFO"}
+			]
+		}
+	]
+	`
+	server := mockAlertmanagerServer(t, http.StatusOK, content)
+	defer server.Close()
+
+	actual, err := GetSilencesFromAlertmanager([]string{server.Listener.Addr().String()})
+	require.NoError(t, err)
+	require.Equal(t, alert.Silences{
+		{
+			ID: "d3a0c1f2-4b5e-4c6d-8e9f-0a1b2c3d4e5f",
+			Matchers: alert.SilenceMatchers{
+				{Name: "cluster", Value: "test", IsRegex: false, IsEqual: true},
+				{Name: "alertname", Value: "lustre.*", IsRegex: true, IsEqual: true},
+			},
+			StartsAt:  time.Date(2025, 7, 8, 6, 0, 0, 0, time.UTC),
+			EndsAt:    time.Date(2025, 7, 8, 8, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2025, 7, 8, 6, 1, 48, 609000000, time.UTC),
+			CreatedBy: "admin",
+			Comment:   "存储维护",
+			State:     alert.SilenceActive,
+		},
+		{
+			ID: "5c9b3e7a-1f2d-4a6b-9c8d-7e6f5a4b3c2d",
+			Matchers: alert.SilenceMatchers{
+				{Name: "severity", Value: "INFO", IsRegex: false, IsEqual: false},
+			},
+			StartsAt:  time.Date(2025, 7, 7, 6, 0, 0, 0, time.UTC),
+			EndsAt:    time.Date(2025, 7, 7, 8, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2025, 7, 7, 6, 1, 48, 609000000, time.UTC),
+			CreatedBy: "ops",
+			State:     alert.SilenceExpired,
+		},
+	}, actual)
+	require.False(t, actual[0].IsExpired())
+	require.True(t, actual[1].IsExpired())
+}
+
+func TestGetSilencesFromAlertmanager_Failed(t *testing.T) {
+	server := mockAlertmanagerServer(t, http.StatusInternalServerError, "")
+	defer server.Close()
+	unavailable := mockAlertmanagerServer(t, http.StatusServiceUnavailable, "")
+	defer unavailable.Close()
+
+	// 全部 Alertmanager 请求失败时返回各地址的错误.
+	addrs := []string{server.Listener.Addr().String(), unavailable.Listener.Addr().String()}
+	actual, err := GetSilencesFromAlertmanager(addrs)
+	require.ErrorContains(t, err, addrs[0]+": 请求失败: 500")
+	require.ErrorContains(t, err, addrs[1]+": 请求失败: 503")
+	require.Empty(t, actual)
+
+	_, err = GetSilencesFromAlertmanager(nil)
+	require.ErrorContains(t, err, "未配置 Alertmanager 地址")
+}
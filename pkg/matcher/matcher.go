@@ -0,0 +1,114 @@
+// Package matcher 解析 Prometheus 风格的标签匹配表达式, 如 {alertname="X", severity=~"critical|warning"},
+// 并将其编译为内存中的匹配函数或 PostgreSQL 查询条件, 匹配语义与 Alertmanager 一致.
+package matcher
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Type 标签匹配方式.
+type Type int
+
+const (
+	MatchEqual     Type = iota // =
+	MatchNotEqual              // !=
+	MatchRegexp                // =~
+	MatchNotRegexp             // !~
+)
+
+var typeNames = map[Type]string{
+	MatchEqual:     "=",
+	MatchNotEqual:  "!=",
+	MatchRegexp:    "=~",
+	MatchNotRegexp: "!~",
+}
+
+func (t Type) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Matcher 单个标签匹配条件. 与 Alertmanager 一致, 不存在的标签视为空字符串, 正则表达式需完整匹配标签值.
+type Matcher struct {
+	Type  Type
+	Name  string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// New 创建标签匹配条件, 正则表达式匹配时校验表达式是否合法.
+func New(t Type, name, value string) (*Matcher, error) {
+	m := &Matcher{Type: t, Name: name, Value: value}
+	switch t {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile(anchor(value))
+		if err != nil {
+			return nil, fmt.Errorf("无效的正则表达式 %q: %w", value, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("无效的标签匹配方式: %s", t)
+	}
+	return m, nil
+}
+
+// MustNew 与 New 相同, 出错时 panic, 用于常量表达式.
+func MustNew(t Type, name, value string) *Matcher {
+	m, err := New(t, name, value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Matches 判断标签值是否满足匹配条件.
+func (m *Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return m.Name + m.Type.String() + strconv.Quote(m.Value)
+}
+
+// Matchers 多个标签匹配条件, 全部满足时匹配.
+type Matchers []*Matcher
+
+// Matches 判断标签集合是否满足全部匹配条件, 空条件匹配任意标签集合.
+func (ms Matchers) Matches(labels map[string]string) bool {
+	for _, m := range ms {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ms Matchers) String() string {
+	s := make([]string, 0, len(ms))
+	for _, m := range ms {
+		s = append(s, m.String())
+	}
+	return "{" + strings.Join(s, ", ") + "}"
+}
+
+// anchor 与 Alertmanager 一致, 正则表达式匹配完整的标签值.
+func anchor(v string) string {
+	return "^(?:" + v + ")$"
+}
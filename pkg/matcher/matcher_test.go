@@ -0,0 +1,204 @@
+package matcher
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMatcher_Anchoring 正则表达式匹配完整的标签值, 与 Alertmanager 中 ^(?:value)$ 的语义一致.
+func TestMatcher_Anchoring(t *testing.T) {
+	tests := []struct {
+		t     Type
+		value string
+		input string
+		match bool
+	}{
+		{MatchRegexp, "foo", "foo", true},
+		{MatchRegexp, "foo", "foobar", false},
+		{MatchRegexp, "foo", "barfoo", false},
+		{MatchRegexp, "foo.*", "foobar", true},
+		{MatchRegexp, ".*foo", "barfoo", true},
+		// 选择整体被锚定, 而非仅锚定首尾分支.
+		{MatchRegexp, "foo|bar", "bar", true},
+		{MatchRegexp, "foo|bar", "foobar", false},
+		{MatchRegexp, "foo|bar", "xbar", false},
+		{MatchRegexp, "foo|bar", "foox", false},
+		{MatchRegexp, "crit|warn", "critical", false},
+		// 用户自行添加的锚点不影响结果.
+		{MatchRegexp, "^foo$", "foo", true},
+		{MatchRegexp, "^foo$", "foobar", false},
+		{MatchRegexp, ".*", "", true},
+		{MatchRegexp, ".+", "", false},
+		{MatchRegexp, "", "", true},
+		{MatchRegexp, "", "foo", false},
+		{MatchRegexp, "FOO", "foo", false},
+		// 内存匹配使用 RE2 语法, 查询条件中转换为等价的 PostgreSQL ARE 表达式, 见 TestSQLRegexp.
+		{MatchRegexp, "(?i)FOO", "foo", true},
+		// . 不匹配换行符.
+		{MatchRegexp, "foo.bar", "foo\nbar", false},
+		{MatchNotRegexp, "foo", "foobar", true},
+		{MatchNotRegexp, "foo|bar", "bar", false},
+		{MatchNotRegexp, ".+", "", true},
+		{MatchEqual, "foo", "foo", true},
+		{MatchEqual, "foo", "foobar", false},
+		{MatchEqual, "", "", true},
+		{MatchNotEqual, "foo", "bar", true},
+		{MatchNotEqual, "", "", false},
+	}
+	for _, tt := range tests {
+		m, err := New(tt.t, "label", tt.value)
+		require.NoError(t, err)
+		require.Equal(t, tt.match, m.Matches(tt.input), "%s matches %q", m, tt.input)
+	}
+}
+
+func TestMatchers_Matches(t *testing.T) {
+	labels := map[string]string{"alertname": "HighLoad", "severity": "critical"}
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{`{}`, true},
+		{`{alertname="HighLoad"}`, true},
+		{`{alertname="HighLoad", severity=~"crit|warn"}`, false},
+		{`{alertname="HighLoad", severity=~"critical|warning"}`, true},
+		// 不存在的标签视为空字符串.
+		{`{team=""}`, true},
+		{`{team!=""}`, false},
+		{`{team=~".*"}`, true},
+		{`{team!~".+"}`, true},
+		{`{team="a"}`, false},
+		{`{team!="a"}`, true},
+	}
+	for _, tt := range tests {
+		ms, err := Parse(tt.expr)
+		require.NoError(t, err)
+		require.Equal(t, tt.match, ms.Matches(labels), tt.expr)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Matchers
+	}{
+		{`{alertname="X"}`, Matchers{MustNew(MatchEqual, "alertname", "X")}},
+		{`alertname="X"`, Matchers{MustNew(MatchEqual, "alertname", "X")}},
+		{` { alertname = "X" , severity =~ "crit|warn", } `, Matchers{
+			MustNew(MatchEqual, "alertname", "X"),
+			MustNew(MatchRegexp, "severity", "crit|warn"),
+		}},
+		{`a!="b",c!~"d"`, Matchers{MustNew(MatchNotEqual, "a", "b"), MustNew(MatchNotRegexp, "c", "d")}},
+		{`{a=b, c=~d.*}`, Matchers{MustNew(MatchEqual, "a", "b"), MustNew(MatchRegexp, "c", "d.*")}},
+		{`{a="x,y}", b="q\"u\\o\n"}`, Matchers{MustNew(MatchEqual, "a", "x,y}"), MustNew(MatchEqual, "b", "q\"u\\o\n")}},
+		{`{a=""}`, Matchers{MustNew(MatchEqual, "a", "")}},
+		{`{}`, Matchers{}},
+		{``, Matchers{}},
+	}
+	for _, tt := range tests {
+		ms, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		require.Equal(t, tt.want, ms, tt.expr)
+	}
+
+	for _, expr := range []string{
+		`{a="b"`,
+		`{="b"}`,
+		`{1a="b"}`,
+		`{a}`,
+		`{a=="b"}`,
+		`{a="b" c="d"}`,
+		`{a="b}`,
+		`{a=~"("}`,
+		`{a="\q"}`,
+	} {
+		_, err := Parse(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestMatchers_String(t *testing.T) {
+	ms := MustParse(`{a="b", c=~"d|e", f!~"g\"h"}`)
+	require.Equal(t, `{a="b", c=~"d|e", f!~"g\"h"}`, ms.String())
+	again, err := Parse(ms.String())
+	require.NoError(t, err)
+	require.Equal(t, ms, again)
+}
+
+func TestMatchers_SQL(t *testing.T) {
+	ms := MustParse(`{alertname="X", severity=~"crit|warn", team!="", env!~"dev"}`)
+
+	sql, args := ms.SQL(LayoutJSONB, "a", []any{"firing"})
+	require.Equal(t, `a.labels @> jsonb_build_object($2::TEXT, $3::TEXT)`+
+		` AND COALESCE(a.labels->>$4, '') ~ $5`+
+		` AND COALESCE(a.labels->>$6, '') <> $7`+
+		` AND COALESCE(a.labels->>$8, '') !~ $9`, sql)
+	require.Equal(t, []any{"firing", "alertname", "X", "severity", "^(?:crit|warn)$", "team", "", "env", "^dev$"}, args)
+
+	sql, args = ms[:2].SQL(LayoutEAV, "a", nil)
+	require.Equal(t, `EXISTS (SELECT 1 FROM AlertLabel l WHERE l.AlertID = a.id AND l.Label = $1 AND l.Value = $2)`+
+		` AND COALESCE((SELECT l.Value FROM AlertLabel l WHERE l.AlertID = a.id AND l.Label = $3), '') ~ $4`, sql)
+	require.Equal(t, []any{"alertname", "X", "severity", "^(?:crit|warn)$"}, args)
+
+	sql, args = Matchers{}.SQL(LayoutEAV, "a", nil)
+	require.Equal(t, "TRUE", sql)
+	require.Empty(t, args)
+}
+
+func TestSQLRegexp(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"crit|warn", `^(?:crit|warn)$`},
+		{"", `^$`},
+		// ARE 不支持标志分组, 忽略大小写展开为字符类.
+		{"(?i)FOO", `^[Ff][Oo][Oo]$`},
+		{"(?i)[a-c]", `^[A-Ca-c]$`},
+		{"(?i)ß", `^[ßẞ]$`},
+		// ARE 中 . 匹配换行符.
+		{"foo.bar", `^foo[^\n]bar$`},
+		{".*", `^[^\n]*$`},
+		{"(?s)a.b", `^a.b$`},
+		{`\d+`, `^[0-9]+$`},
+		{`[^a]`, `^[^a]$`},
+		{`[a-c\]-]`, `^[\u002D\u005Da-c]$`},
+		{`a\.b c`, `^a\.b c$`},
+		{"节点.+", `^节点[^\n]+$`},
+		{`\bfoo\B`, `^\yfoo\Y$`},
+		{"(?m)^a$", `^(?:^|(?<=\n))a(?:$|(?=\n))$`},
+		{"x*?(ab)+", `^x*(?:ab)+$`},
+		// 超过 ARE 重复次数上限时拆分.
+		{"a{2,300}", `^a{2,255}a{0,45}$`},
+		{"a{600}", `^a{255}a{255}a{90}$`},
+		{"a{300,}", `^a{255}a{45,}$`},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, sqlRegexp(tt.value), tt.value)
+	}
+}
+
+// TestSQLRegexp_Semantics 将转换后的 ARE 表达式按 ARE 的语义改写为 RE2 表达式, 校验与原表达式的匹配结果一致.
+func TestSQLRegexp_Semantics(t *testing.T) {
+	// ARE 中 . 匹配换行符, \y, \Y 为单词边界, \uXXXX 为字符转义.
+	escape := regexp.MustCompile(`\\u([0-9A-F]{4})|\\U([0-9A-F]{8})`)
+	toRE2 := func(are string) *regexp.Regexp {
+		are = strings.NewReplacer(`\y`, `\b`, `\Y`, `\B`).Replace(are)
+		are = escape.ReplaceAllString(are, `\x{$1$2}`)
+		return regexp.MustCompile("(?s)" + are)
+	}
+
+	values := []string{"crit|warn", "(?i)crit.*", "foo.bar", "(?s)foo.bar", `\w+-\d{2,3}`, `[^a-c]+`, `(?i:x)Y`, `a\.b|[]-]`, `\bfoo`, "节点.?"}
+	inputs := []string{"", "crit", "CRIT", "critical", "CRIT\nX", "warn", "foo\nbar", "foo.bar", "fooxbar", "ab_1-23", "x-1234", "dd\n", "xY", "XY", "xy", "a.b", "]", "-", "foo", "节点", "节点\n"}
+	for _, value := range values {
+		m, err := New(MatchRegexp, "label", value)
+		require.NoError(t, err)
+		re := toRE2(sqlRegexp(value))
+		for _, input := range inputs {
+			require.Equal(t, m.Matches(input), re.MatchString(input), "%q matches %q", value, input)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package matcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Parse 解析标签匹配表达式, 如 {alertname="X", severity=~"critical|warning"}.
+// 花括号可省略, 多个条件以逗号分隔; 标签值可以为双引号包围的字符串(支持 Go 转义)或不含逗号及花括号的字符串.
+func Parse(s string) (Matchers, error) {
+	p := &parser{input: strings.TrimSpace(s)}
+	if strings.HasPrefix(p.input, "{") {
+		if !strings.HasSuffix(p.input, "}") {
+			return nil, fmt.Errorf("无效的标签匹配表达式 %q: 缺少 }", s)
+		}
+		p.input = p.input[1 : len(p.input)-1]
+	}
+
+	ms := make(Matchers, 0)
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return ms, nil
+		}
+		m, err := p.matcher()
+		if err != nil {
+			return nil, fmt.Errorf("无效的标签匹配表达式 %q: %w", s, err)
+		}
+		ms = append(ms, m)
+
+		p.skipSpace()
+		if p.eof() {
+			return ms, nil
+		}
+		if p.input[p.pos] != ',' {
+			return nil, fmt.Errorf("无效的标签匹配表达式 %q: 位置 %d 处应为 ,", s, p.pos)
+		}
+		p.pos++
+	}
+}
+
+// MustParse 与 Parse 相同, 出错时 panic, 用于常量表达式.
+func MustParse(s string) Matchers {
+	ms, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return ms
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// matcher 解析 name op value.
+func (p *parser) matcher() (*Matcher, error) {
+	start := p.pos
+	for !p.eof() && isNameChar(p.input[p.pos], p.pos == start) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if name == "" {
+		return nil, fmt.Errorf("位置 %d 处应为标签名", start)
+	}
+
+	p.skipSpace()
+	var t Type
+	switch rest := p.input[p.pos:]; {
+	case strings.HasPrefix(rest, "=~"):
+		t = MatchRegexp
+	case strings.HasPrefix(rest, "!~"):
+		t = MatchNotRegexp
+	case strings.HasPrefix(rest, "!="):
+		t = MatchNotEqual
+	case strings.HasPrefix(rest, "="):
+		t = MatchEqual
+	default:
+		return nil, fmt.Errorf("位置 %d 处应为 =, !=, =~ 或 !~", p.pos)
+	}
+	p.pos += len(t.String())
+
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return New(t, name, value)
+}
+
+// value 解析双引号包围的字符串或不含逗号及花括号的字符串.
+func (p *parser) value() (string, error) {
+	start := p.pos
+	if !p.eof() && p.input[p.pos] == '"' {
+		for p.pos++; !p.eof(); p.pos++ {
+			switch p.input[p.pos] {
+			case '\\':
+				p.pos++
+			case '"':
+				p.pos++
+				v, err := strconv.Unquote(p.input[start:p.pos])
+				if err != nil {
+					return "", fmt.Errorf("位置 %d 处的标签值无效: %w", start, err)
+				}
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("位置 %d 处的标签值缺少结束引号", start)
+	}
+
+	for !p.eof() && !strings.ContainsRune(",{}\"", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return strings.TrimSpace(p.input[start:p.pos]), nil
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
@@ -0,0 +1,276 @@
+package matcher
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Layout 报警标签的存储方式.
+type Layout int
+
+const (
+	LayoutEAV   Layout = iota // 标签存储在 AlertLabel 表中
+	LayoutJSONB               // 标签存储在 Alert.labels JSONB 字段中
+)
+
+// SQL 将匹配条件编译为参数化的 PostgreSQL 查询条件, alias 为 Alert 表的别名.
+// 参数追加到 args 之后, 占位符从 len(args)+1 开始编号, 返回查询条件及追加后的参数; 空条件返回 TRUE.
+//
+// 正则表达式与内存匹配相同, 以 ^(?:value)$ 完整匹配标签值. PostgreSQL ARE 与 Go RE2 的语法及语义不同,
+// 如 ARE 不支持 (?i) 等标志分组, . 匹配换行符, 因此按 RE2 解析后转换为语义相同的 ARE 表达式, 见 sqlRegexp.
+func (ms Matchers) SQL(layout Layout, alias string, args []any) (string, []any) {
+	if len(ms) == 0 {
+		return "TRUE", args
+	}
+
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var sql string
+	for i, m := range ms {
+		if i > 0 {
+			sql += " AND "
+		}
+
+		// 非空值的等值匹配要求标签存在, 使用 EXISTS 以便利用 AlertLabel 及 JSONB 索引.
+		if m.Type == MatchEqual && m.Value != "" {
+			if layout == LayoutJSONB {
+				sql += fmt.Sprintf("%s.labels @> jsonb_build_object(%s::TEXT, %s::TEXT)", alias, arg(m.Name), arg(m.Value))
+			} else {
+				sql += fmt.Sprintf("EXISTS (SELECT 1 FROM AlertLabel l WHERE l.AlertID = %s.id AND l.Label = %s AND l.Value = %s)", alias, arg(m.Name), arg(m.Value))
+			}
+			continue
+		}
+
+		var value string
+		if layout == LayoutJSONB {
+			value = fmt.Sprintf("COALESCE(%s.labels->>%s, '')", alias, arg(m.Name))
+		} else {
+			value = fmt.Sprintf("COALESCE((SELECT l.Value FROM AlertLabel l WHERE l.AlertID = %s.id AND l.Label = %s), '')", alias, arg(m.Name))
+		}
+		switch m.Type {
+		case MatchEqual:
+			sql += value + " = " + arg(m.Value)
+		case MatchNotEqual:
+			sql += value + " <> " + arg(m.Value)
+		case MatchRegexp:
+			sql += value + " ~ " + arg(sqlRegexp(m.Value))
+		case MatchNotRegexp:
+			sql += value + " !~ " + arg(sqlRegexp(m.Value))
+		}
+	}
+	return sql, args
+}
+
+// areDupMax PostgreSQL ARE 重复次数 {m,n} 的上限, RE2 的上限为 1000.
+const areDupMax = 255
+
+// sqlRegexp 将完整匹配 value 的 RE2 正则表达式转换为语义相同的 PostgreSQL ARE 正则表达式:
+//   - 标志分组如 (?i) 展开为字符类, 如 (?i)ab 转换为 [Aa][Bb];
+//   - 不匹配换行符的 . 转换为 [^\n], (?s) 下的 . 转换为 ARE 的 .;
+//   - \d, \w, \pL 等字符类展开为与 RE2 相同的字符范围, 如 \d 仅匹配 ASCII 数字;
+//   - (?m) 下的 ^, $ 转换为前后断言, 重复次数超过 255 时拆分为多个重复.
+//
+// 仍存在的差异: \b, \B 转换为 ARE 的 \y, \Y, ARE 的单词字符取决于数据库的 locale, 可能包含非 ASCII 字母;
+// 非 ASCII 字符需要数据库使用 UTF8 编码; 过于复杂的表达式可能超出 ARE 的限制, 查询时返回错误.
+func sqlRegexp(value string) string {
+	re, err := syntax.Parse(anchor(value), syntax.Perl)
+	if err != nil {
+		// New 已校验正则表达式, 未经 New 创建的无效表达式交由 PostgreSQL 报错.
+		return anchor(value)
+	}
+	var b strings.Builder
+	writeARE(&b, re)
+	return b.String()
+}
+
+// writeARE 将 RE2 语法树写为 ARE 表达式, 完整匹配时贪婪与非贪婪量词的结果相同, 统一使用贪婪量词.
+func writeARE(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		// 仅匹配 PostgreSQL 文本中不存在的 NUL 字符.
+		b.WriteString(`[^\u0001-\U0010FFFF]`)
+	case syntax.OpEmptyMatch:
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 {
+				if folds := foldRunes(r); len(folds) > 1 {
+					writeClass(b, folds)
+					continue
+				}
+			}
+			if r == 0 {
+				writeARE(b, &syntax.Regexp{Op: syntax.OpNoMatch})
+				continue
+			}
+			b.WriteString(areLiteral(r, false))
+		}
+	case syntax.OpCharClass:
+		writeClass(b, re.Rune)
+	case syntax.OpAnyCharNotNL:
+		b.WriteString(`[^\n]`)
+	case syntax.OpAnyChar:
+		b.WriteString(".")
+	case syntax.OpBeginLine:
+		b.WriteString(`(?:^|(?<=\n))`)
+	case syntax.OpEndLine:
+		b.WriteString(`(?:$|(?=\n))`)
+	case syntax.OpBeginText:
+		b.WriteString("^")
+	case syntax.OpEndText:
+		b.WriteString("$")
+	case syntax.OpWordBoundary:
+		b.WriteString(`\y`)
+	case syntax.OpNoWordBoundary:
+		b.WriteString(`\Y`)
+	case syntax.OpCapture:
+		writeGroup(b, re.Sub[0])
+	case syntax.OpStar:
+		writeGroup(b, re.Sub[0])
+		b.WriteString("*")
+	case syntax.OpPlus:
+		writeGroup(b, re.Sub[0])
+		b.WriteString("+")
+	case syntax.OpQuest:
+		writeGroup(b, re.Sub[0])
+		b.WriteString("?")
+	case syntax.OpRepeat:
+		writeRepeat(b, re.Sub[0], re.Min, re.Max)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeARE(b, sub)
+		}
+	case syntax.OpAlternate:
+		b.WriteString("(?:")
+		for i, sub := range re.Sub {
+			if i > 0 {
+				b.WriteString("|")
+			}
+			writeARE(b, sub)
+		}
+		b.WriteString(")")
+	}
+}
+
+// writeGroup 将 re 写为非捕获分组, 供量词使用, 单个字符无需分组.
+func writeGroup(b *strings.Builder, re *syntax.Regexp) {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	switch {
+	case re.Op == syntax.OpLiteral && len(re.Rune) == 1 && re.Rune[0] != 0,
+		re.Op == syntax.OpCharClass, re.Op == syntax.OpAnyChar, re.Op == syntax.OpAnyCharNotNL:
+		writeARE(b, re)
+		return
+	}
+	b.WriteString("(?:")
+	writeARE(b, re)
+	b.WriteString(")")
+}
+
+// writeRepeat 写入重复 lo 到 hi 次的 re, hi 为 -1 时不限制, 超过 ARE 上限的重复拆分为多个重复.
+func writeRepeat(b *strings.Builder, re *syntax.Regexp, lo, hi int) {
+	for lo > areDupMax {
+		writeGroup(b, re)
+		fmt.Fprintf(b, "{%d}", areDupMax)
+		lo -= areDupMax
+		if hi != -1 {
+			hi -= areDupMax
+		}
+	}
+	if hi == -1 {
+		writeGroup(b, re)
+		fmt.Fprintf(b, "{%d,}", lo)
+		return
+	}
+
+	n := min(hi, areDupMax)
+	writeGroup(b, re)
+	if lo == n {
+		fmt.Fprintf(b, "{%d}", n)
+	} else {
+		fmt.Fprintf(b, "{%d,%d}", lo, n)
+	}
+	for hi -= n; hi > 0; hi -= n {
+		n = min(hi, areDupMax)
+		writeGroup(b, re)
+		fmt.Fprintf(b, "{0,%d}", n)
+	}
+}
+
+// writeClass 写入字符类, ranges 为 RE2 字符类的有序范围对. 包含 NUL 及最大字符的字符类写为取反的形式.
+func writeClass(b *strings.Builder, ranges []rune) {
+	negated := len(ranges) > 0 && ranges[0] == 0 && ranges[len(ranges)-1] == unicode.MaxRune
+	if negated {
+		complement := make([]rune, 0, len(ranges))
+		for i := 1; i+1 < len(ranges); i += 2 {
+			complement = append(complement, ranges[i]+1, ranges[i+1]-1)
+		}
+		if len(complement) == 0 {
+			b.WriteString(".")
+			return
+		}
+		ranges = complement
+	} else if len(ranges) > 0 && ranges[0] == 0 {
+		// PostgreSQL 文本中不存在 NUL 字符.
+		ranges = append([]rune{1, ranges[1]}, ranges[2:]...)
+		if ranges[1] < 1 {
+			ranges = ranges[2:]
+		}
+	}
+	if len(ranges) == 0 {
+		writeARE(b, &syntax.Regexp{Op: syntax.OpNoMatch})
+		return
+	}
+
+	b.WriteString("[")
+	if negated {
+		b.WriteString("^")
+	}
+	for i := 0; i+1 < len(ranges); i += 2 {
+		b.WriteString(areLiteral(ranges[i], true))
+		if ranges[i+1] != ranges[i] {
+			b.WriteString("-")
+			b.WriteString(areLiteral(ranges[i+1], true))
+		}
+	}
+	b.WriteString("]")
+}
+
+// foldRunes 返回与 r 大小写等价的全部字符, 按 RE2 字符类的形式组成有序范围对.
+func foldRunes(r rune) []rune {
+	folds := []rune{r}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		folds = append(folds, f)
+	}
+	slices.Sort(folds)
+	ranges := make([]rune, 0, 2*len(folds))
+	for _, f := range folds {
+		ranges = append(ranges, f, f)
+	}
+	return ranges
+}
+
+// areLiteral 返回匹配字符 r 的 ARE 表达式, 可打印字符原样写入, 元字符及不可打印字符使用转义.
+// inClass 表示位于字符类中, 字符类中的 ASCII 符号使用 \u 转义, 避免与 ], -, ^ 等冲突.
+func areLiteral(r rune, inClass bool) string {
+	switch {
+	case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		return string(r)
+	case r > unicode.MaxASCII && unicode.IsPrint(r):
+		return string(r)
+	case !inClass && strings.ContainsRune(`\^$.[]|()*+?{}`, r):
+		return `\` + string(r)
+	case !inClass && r < unicode.MaxASCII && unicode.IsPrint(r):
+		return string(r)
+	case r <= 0xFFFF:
+		return fmt.Sprintf(`\u%04X`, r)
+	default:
+		return fmt.Sprintf(`\U%08X`, r)
+	}
+}
@@ -0,0 +1,174 @@
+// Package notify 订阅 alert2pg 通过 PostgreSQL LISTEN/NOTIFY 发布的报警变更事件.
+//
+// alert2pg 在报警存储事务中调用 pg_notify, 事件仅在事务提交后投递.
+// NOTIFY 不保证断线期间的事件送达, 订阅者重连后应按需查询数据库补齐遗漏的变更.
+package notify
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+)
+
+// Payload pg_notify 发送的报警变更信息, 仅包含关键字段以满足 NOTIFY 8000 字节的限制.
+type Payload struct {
+	ID          int       `json:"id"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      string    `json:"status"`
+	StartsAt    time.Time `json:"startsAt"`
+	Alertname   string    `json:"alertname"`
+}
+
+// NewPayload 根据数据库中的报警 ID 及报警信息生成变更信息.
+func NewPayload(id int, a alert.Alert) Payload {
+	return Payload{
+		ID:          id,
+		Tenant:      a.Tenant,
+		Fingerprint: a.Fingerprint,
+		Status:      a.Status,
+		StartsAt:    a.StartsAt,
+		Alertname:   a.Labels["alertname"],
+	}
+}
+
+// Event 报警变更事件, Alert 仅包含变更信息中的字段, 标签中仅包含 alertname.
+type Event struct {
+	ID    int
+	Alert alert.Alert
+}
+
+// ParseEvent 解析 pg_notify 发送的变更信息.
+func ParseEvent(payload string) (Event, error) {
+	var p Payload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return Event{}, fmt.Errorf("无法解析报警变更信息: %w", err)
+	}
+	a := alert.Alert{
+		Tenant:      p.Tenant,
+		Status:      p.Status,
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+		StartsAt:    p.StartsAt,
+		Fingerprint: p.Fingerprint,
+	}
+	if p.Alertname != "" {
+		a.Labels["alertname"] = p.Alertname
+	}
+	return Event{ID: p.ID, Alert: a}, nil
+}
+
+// Subscriber 订阅报警变更事件, 连接断开时按指数退避自动重连.
+type Subscriber struct {
+	connString string
+	channel    string
+	events     chan Event
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	options Options
+	logger  log.Logger
+}
+
+// New 创建订阅者, connString 为 PostgreSQL 连接字符串, channel 与 alert2pg 配置的 storage.notify_channel 一致.
+func New(connString, channel string, logger log.Logger, opts ...optionFunc) (*Subscriber, error) {
+	if channel == "" {
+		return nil, fmt.Errorf("通知通道不能为空")
+	}
+	if _, err := pgx.ParseConfig(connString); err != nil {
+		return nil, fmt.Errorf("无效的数据库连接配置: %w", err)
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Subscriber{
+		connString: connString,
+		channel:    channel,
+		events:     make(chan Event, options.bufferSize),
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		options:    options,
+		logger:     logger,
+	}, nil
+}
+
+// Events 返回报警变更事件通道, Stop 后通道关闭.
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Run 监听报警变更事件直到 Stop 被调用.
+func (s *Subscriber) Run() {
+	defer close(s.done)
+	defer close(s.events)
+
+	attempts := 0
+	for {
+		err := s.listen(func() { attempts = 0 })
+		if s.ctx.Err() != nil {
+			return
+		}
+		attempts++
+		wait := s.options.backoff.Duration(attempts)
+		level.Warn(s.logger).Log("消息", "监听报警变更事件失败, 等待重连", "通道", s.channel, "重连等待", wait, "错误", err)
+		select {
+		case <-time.After(wait):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop 停止监听并关闭事件通道.
+func (s *Subscriber) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// listen 建立连接并持续接收通知, connected 在 LISTEN 成功后调用.
+func (s *Subscriber) listen(connected func()) error {
+	conn, err := pgx.Connect(s.ctx, s.connString)
+	if err != nil {
+		return fmt.Errorf("无法连接数据库: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(s.ctx, "LISTEN "+pgx.Identifier{s.channel}.Sanitize()); err != nil {
+		return fmt.Errorf("无法监听通道: %w", err)
+	}
+	connected()
+	level.Info(s.logger).Log("消息", "开始监听报警变更事件", "通道", s.channel)
+
+	for {
+		n, err := conn.WaitForNotification(s.ctx)
+		if err != nil {
+			return err
+		}
+		event, err := ParseEvent(n.Payload)
+		if err != nil {
+			level.Error(s.logger).Log("消息", "丢弃无法解析的报警变更事件", "内容", n.Payload, "错误", err)
+			continue
+		}
+		select {
+		case s.events <- event:
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"alert2pg/pkg/alert"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEvent(t *testing.T) {
+	startsAt := time.Date(2025, 7, 2, 22, 23, 18, 268000000, time.UTC)
+	a := alert.Alert{
+		Status:      alert.Firing,
+		Labels:      map[string]string{"alertname": "clusterAvailabilityLow", "severity": "INFO"},
+		Annotations: map[string]string{"summary": "节点可用率低于90%"},
+		StartsAt:    startsAt,
+		Fingerprint: "077bf4e884599215",
+	}
+
+	payload, err := json.Marshal(NewPayload(42, a))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":42,"fingerprint":"077bf4e884599215","status":"firing","startsAt":"2025-07-02T22:23:18.268Z","alertname":"clusterAvailabilityLow"}`, string(payload))
+
+	event, err := ParseEvent(string(payload))
+	require.NoError(t, err)
+	want := Event{
+		ID: 42,
+		Alert: alert.Alert{
+			Status:      alert.Firing,
+			Labels:      map[string]string{"alertname": "clusterAvailabilityLow"},
+			Annotations: map[string]string{},
+			StartsAt:    startsAt,
+			Fingerprint: "077bf4e884599215",
+		},
+	}
+	if diff := cmp.Diff(want, event); diff != "" {
+		t.Errorf("ParseEvent() mismatch (-want +got):\n%s", diff)
+	}
+	require.Equal(t, a.Key(), event.Alert.Key())
+}
+
+func TestParseEvent_Tenant(t *testing.T) {
+	var a alert.Alert
+	a.Tenant = "team-a"
+	a.Status = alert.Resolved
+	a.Labels = map[string]string{"alertname": "HostDown"}
+	a.StartsAt = time.Date(2025, 7, 2, 22, 23, 18, 0, time.UTC)
+	a.Fingerprint = "077bf4e884599215"
+
+	payload, err := json.Marshal(NewPayload(7, a))
+	require.NoError(t, err)
+	require.Contains(t, string(payload), `"tenant":"team-a"`)
+
+	event, err := ParseEvent(string(payload))
+	require.NoError(t, err)
+	require.Equal(t, "team-a", event.Alert.Tenant)
+	// 不同租户的相同报警是不同的报警.
+	require.Equal(t, a.Key(), event.Alert.Key())
+	other := a
+	other.Tenant = "team-b"
+	require.NotEqual(t, other.Key(), event.Alert.Key())
+}
+
+func TestParseEvent_Invalid(t *testing.T) {
+	_, err := ParseEvent("not json")
+	require.Error(t, err)
+}
+
+func TestSubscriber_Backoff(t *testing.T) {
+	s, err := New("postgres://localhost/alert2pg", "alert2pg", nil, WithReconnectBackoff(time.Second, 10*time.Second))
+	require.NoError(t, err)
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 10: 10 * time.Second} {
+		got := s.options.backoff.Duration(attempts)
+		require.GreaterOrEqual(t, got, want)
+		require.LessOrEqual(t, got, want+want/5)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New("postgres://localhost/alert2pg", "", nil)
+	require.Error(t, err)
+
+	_, err = New("://", "alert2pg", nil)
+	require.Error(t, err)
+}
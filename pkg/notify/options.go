@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"alert2pg/pkg/backoff"
+	"time"
+)
+
+var defaultOptions = Options{
+	bufferSize: 100,
+	backoff:    backoff.Backoff{Initial: 1 * time.Second, Max: 1 * time.Minute},
+}
+
+type Options struct {
+	bufferSize int             // 事件通道的缓冲大小, 消费过慢时阻塞接收通知
+	backoff    backoff.Backoff // 连接断开后重连的退避时间
+}
+
+type Option interface {
+	apply(*Options)
+}
+
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+// WithBufferSize 设置事件通道的缓冲大小.
+func WithBufferSize(size int) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.bufferSize = size
+	})
+}
+
+// WithReconnectBackoff 设置连接断开后重连的退避时间.
+func WithReconnectBackoff(initial, max time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.backoff = backoff.Backoff{Initial: initial, Max: max}
+	})
+}
@@ -0,0 +1,238 @@
+// Package relabel 按 Prometheus relabel_config 的语义改写报警的标签及注释.
+//
+// 支持的动作: replace, keep, drop, hashmod, labelmap, labeldrop, labelkeep.
+// 正则表达式需完整匹配, 与 Prometheus 一致; 改写后标签值为空时删除该标签.
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action 改写动作.
+type Action string
+
+const (
+	// Replace 将 source_labels 的值以 separator 连接后匹配 regex, 匹配时将 replacement 写入 target_label.
+	Replace Action = "replace"
+	// Keep 丢弃 source_labels 的值不匹配 regex 的报警.
+	Keep Action = "keep"
+	// Drop 丢弃 source_labels 的值匹配 regex 的报警.
+	Drop Action = "drop"
+	// HashMod 将 source_labels 的值的哈希对 modulus 取模后写入 target_label.
+	HashMod Action = "hashmod"
+	// LabelMap 将名称匹配 regex 的标签复制为 replacement 指定的名称.
+	LabelMap Action = "labelmap"
+	// LabelDrop 删除名称匹配 regex 的标签.
+	LabelDrop Action = "labeldrop"
+	// LabelKeep 删除名称不匹配 regex 的标签.
+	LabelKeep Action = "labelkeep"
+)
+
+var nameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// DefaultConfig 未配置字段的默认值, 与 Prometheus 一致.
+var DefaultConfig = Config{
+	Separator:   ";",
+	Regex:       MustNewRegexp("(.*)"),
+	Replacement: "$1",
+	Action:      Replace,
+}
+
+// Regexp 完整匹配的正则表达式, YAML 中以字符串表示.
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp 编译完整匹配 s 的正则表达式.
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	if err != nil {
+		return Regexp{}, fmt.Errorf("无效的正则表达式 %q: %w", s, err)
+	}
+	return Regexp{Regexp: re, original: s}, nil
+}
+
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// String 返回配置中的原始正则表达式.
+func (re Regexp) String() string {
+	return re.original
+}
+
+// UnmarshalYAML 实现 yaml.Unmarshaler 接口.
+func (re *Regexp) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML 实现 yaml.Marshaler 接口.
+func (re Regexp) MarshalYAML() (any, error) {
+	return re.original, nil
+}
+
+// Config 一条改写规则, 字段含义与 Prometheus relabel_config 一致.
+type Config struct {
+	SourceLabels []string `yaml:"source_labels,flow,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        Regexp   `yaml:"regex,omitempty"`
+	Modulus      uint64   `yaml:"modulus,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       Action   `yaml:"action,omitempty"`
+}
+
+// UnmarshalYAML 实现 yaml.Unmarshaler 接口, 未配置的字段使用默认值并校验规则.
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	*c = DefaultConfig
+	type plain Config
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate 校验改写规则.
+func (c *Config) Validate() error {
+	if c.Regex.Regexp == nil {
+		c.Regex = DefaultConfig.Regex
+	}
+	if c.Action == "" {
+		c.Action = Replace
+	}
+	switch c.Action {
+	case Replace, HashMod:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("%s 动作需要配置 target_label", c.Action)
+		}
+		if c.Action == HashMod && c.Modulus == 0 {
+			return fmt.Errorf("hashmod 动作需要配置大于 0 的 modulus")
+		}
+		// target_label 可以引用 regex 的分组, 此时在改写时校验展开后的名称.
+		if !strings.Contains(c.TargetLabel, "$") && !nameRE.MatchString(c.TargetLabel) {
+			return fmt.Errorf("无效的 target_label %q", c.TargetLabel)
+		}
+	case Keep, Drop:
+	case LabelMap:
+		if !strings.Contains(c.Replacement, "$") && !nameRE.MatchString(c.Replacement) {
+			return fmt.Errorf("无效的 replacement %q", c.Replacement)
+		}
+	case LabelDrop, LabelKeep:
+		if len(c.SourceLabels) > 0 || c.TargetLabel != "" || c.Modulus != 0 ||
+			c.Separator != DefaultConfig.Separator || c.Replacement != DefaultConfig.Replacement {
+			return fmt.Errorf("%s 动作仅支持配置 regex", c.Action)
+		}
+	default:
+		return fmt.Errorf("未知的改写动作 %q", c.Action)
+	}
+	for _, name := range c.SourceLabels {
+		if !nameRE.MatchString(name) {
+			return fmt.Errorf("无效的 source_labels %q", name)
+		}
+	}
+	return nil
+}
+
+// Process 依次执行改写规则, 返回改写后的标签副本; 报警被 keep 或 drop 规则丢弃时返回 false.
+// 不修改 labels.
+func Process(labels map[string]string, cfgs ...*Config) (map[string]string, bool) {
+	rlt := make(map[string]string, len(labels))
+	for k, v := range labels {
+		rlt[k] = v
+	}
+	for _, cfg := range cfgs {
+		if !relabel(rlt, cfg) {
+			return nil, false
+		}
+	}
+	return rlt, true
+}
+
+// relabel 执行一条改写规则, 原地修改 labels.
+func relabel(labels map[string]string, cfg *Config) bool {
+	values := make([]string, 0, len(cfg.SourceLabels))
+	for _, name := range cfg.SourceLabels {
+		values = append(values, labels[name])
+	}
+	val := strings.Join(values, cfg.Separator)
+
+	switch cfg.Action {
+	case Drop:
+		if cfg.Regex.MatchString(val) {
+			return false
+		}
+	case Keep:
+		if !cfg.Regex.MatchString(val) {
+			return false
+		}
+	case Replace:
+		indexes := cfg.Regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			break
+		}
+		target := string(cfg.Regex.ExpandString(nil, cfg.TargetLabel, val, indexes))
+		if !nameRE.MatchString(target) {
+			break
+		}
+		set(labels, target, string(cfg.Regex.ExpandString(nil, cfg.Replacement, val, indexes)))
+	case HashMod:
+		sum := md5.Sum([]byte(val))
+		mod := binary.BigEndian.Uint64(sum[8:]) % cfg.Modulus
+		set(labels, cfg.TargetLabel, fmt.Sprintf("%d", mod))
+	case LabelMap:
+		// 基于改写前的标签复制, 避免新标签再次被匹配.
+		mapped := make(map[string]string)
+		for name, v := range labels {
+			if cfg.Regex.MatchString(name) {
+				if target := cfg.Regex.ReplaceAllString(name, cfg.Replacement); nameRE.MatchString(target) {
+					mapped[target] = v
+				}
+			}
+		}
+		for name, v := range mapped {
+			set(labels, name, v)
+		}
+	case LabelDrop:
+		for name := range labels {
+			if cfg.Regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case LabelKeep:
+		for name := range labels {
+			if !cfg.Regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
+
+// set 设置标签值, 值为空时删除标签.
+func set(labels map[string]string, name, value string) {
+	if value == "" {
+		delete(labels, name)
+		return
+	}
+	labels[name] = value
+}
@@ -0,0 +1,93 @@
+package relabel
+
+import (
+	"alert2pg/pkg/alert"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+// fixtureAlert golden 文件中的报警, 仅包含改写涉及的字段.
+type fixtureAlert struct {
+	Fingerprint string            `json:"fingerprint"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// TestRules_Golden 对 testdata 下每个目录, 使用 rules.yml 改写 input.json 中的报警并与 golden.json 比较.
+// 修改改写逻辑后使用 go test -run Golden -update 更新 golden 文件.
+func TestRules_Golden(t *testing.T) {
+	dirs, err := filepath.Glob("testdata/*")
+	require.NoError(t, err)
+	require.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join(dir, "rules.yml"))
+			require.NoError(t, err)
+			var rules Rules
+			require.NoError(t, yaml.Unmarshal(content, &rules))
+
+			content, err = os.ReadFile(filepath.Join(dir, "input.json"))
+			require.NoError(t, err)
+			var input alert.Alerts
+			require.NoError(t, json.Unmarshal(content, &input))
+
+			output := make([]fixtureAlert, 0)
+			for _, a := range rules.Process(input) {
+				output = append(output, fixtureAlert{Fingerprint: a.Fingerprint, Labels: a.Labels, Annotations: a.Annotations})
+			}
+			got, err := json.MarshalIndent(output, "", "  ")
+			require.NoError(t, err)
+			got = append(got, '\n')
+
+			golden := filepath.Join(dir, "golden.json")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, got, 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			require.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+func TestProcess_NotModified(t *testing.T) {
+	labels := map[string]string{"a": "1", "b": "2"}
+	got, ok := Process(labels, &Config{Action: LabelDrop, Regex: MustNewRegexp("a")})
+	require.True(t, ok)
+	require.Equal(t, map[string]string{"b": "2"}, got)
+	require.Equal(t, map[string]string{"a": "1", "b": "2"}, labels)
+}
+
+func TestConfig_Unmarshal(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(`target_label: cluster`), &cfg))
+	require.Equal(t, Replace, cfg.Action)
+	require.Equal(t, ";", cfg.Separator)
+	require.Equal(t, "$1", cfg.Replacement)
+	require.Equal(t, "(.*)", cfg.Regex.String())
+
+	for _, content := range []string{
+		`action: replace`,
+		`action: hashmod
+target_label: shard`,
+		`action: labeldrop
+source_labels: [a]`,
+		`action: unknown`,
+		`regex: "("`,
+		`target_label: "bad-name"`,
+		`source_labels: ["bad-name"]
+action: keep`,
+	} {
+		var cfg Config
+		require.Error(t, yaml.Unmarshal([]byte(content), &cfg), content)
+	}
+}
@@ -0,0 +1,42 @@
+package relabel
+
+import "alert2pg/pkg/alert"
+
+// Rules 报警改写规则, 分别作用于报警的标签及注释.
+// 标签或注释被 keep, drop 规则丢弃时丢弃整条报警.
+type Rules struct {
+	Labels      []*Config `yaml:"labels,omitempty"`
+	Annotations []*Config `yaml:"annotations,omitempty"`
+}
+
+// Empty 判断是否未配置任何改写规则.
+func (r Rules) Empty() bool {
+	return len(r.Labels) == 0 && len(r.Annotations) == 0
+}
+
+// Process 改写报警的标签及注释, 返回改写后保留的报警, 不修改传入的报警.
+// 改写不会重新计算 fingerprint, 报警仍以 Alertmanager 中的 fingerprint 标识.
+func (r Rules) Process(alerts alert.Alerts) alert.Alerts {
+	if r.Empty() {
+		return alerts
+	}
+	rlt := make(alert.Alerts, 0, len(alerts))
+	for _, a := range alerts {
+		if len(r.Labels) > 0 {
+			labels, ok := Process(a.Labels, r.Labels...)
+			if !ok {
+				continue
+			}
+			a.Labels = labels
+		}
+		if len(r.Annotations) > 0 {
+			annotations, ok := Process(a.Annotations, r.Annotations...)
+			if !ok {
+				continue
+			}
+			a.Annotations = annotations
+		}
+		rlt = append(rlt, a)
+	}
+	return rlt
+}
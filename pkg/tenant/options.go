@@ -0,0 +1,47 @@
+package tenant
+
+var defaultOptions = Options{
+	header: DefaultHeader,
+}
+
+type Options struct {
+	header        string            // 携带租户的请求头, 为空时不从请求头解析
+	label         string            // 携带租户的报警标签, 为空时不从标签解析
+	tokens        map[string]string // Bearer Token 与租户的对应关系, 配置后请求必须携带有效的 Token
+	defaultTenant string            // 无法解析租户时使用的默认租户, 为空时拒绝请求
+}
+
+type Option interface {
+	apply(*Options)
+}
+
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+func WithHeader(header string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.header = header
+	})
+}
+
+func WithLabel(label string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.label = label
+	})
+}
+
+// WithTokens 设置 Bearer Token 与租户的对应关系.
+func WithTokens(tokens map[string]string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.tokens = tokens
+	})
+}
+
+func WithDefault(tenant string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.defaultTenant = tenant
+	})
+}
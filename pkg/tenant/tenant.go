@@ -0,0 +1,200 @@
+// Package tenant 提供多租户支持: 从 webhook 请求的 Token, 请求头或报警标签中解析报警所属租户,
+// 并通过 context 在查询中传递租户.
+package tenant
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultHeader 默认携带租户的请求头, 与 Cortex, Mimir 及 Loki 一致.
+const DefaultHeader = "X-Scope-OrgID"
+
+var (
+	// ErrUnauthorized 请求未携带有效的 Token, 或请求的租户与 Token 对应的租户不一致.
+	ErrUnauthorized = errors.New("未授权的租户")
+	// ErrMissing 无法确定报警所属租户.
+	ErrMissing = errors.New("缺少租户信息")
+	// ErrInvalid 租户格式无效或报警标签中的租户与请求的租户不一致.
+	ErrInvalid = errors.New("无效的租户")
+)
+
+var idRE = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// Valid 判断租户 ID 是否有效: 1-64 个字母, 数字, 下划线, 点或中划线.
+func Valid(id string) bool {
+	return idRE.MatchString(id)
+}
+
+type contextKey struct{}
+
+// WithContext 返回携带租户的 context, 存储后端查询时仅返回该租户的数据.
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext 返回 context 中的租户.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// Resolver 解析报警所属租户, 优先级依次为: Bearer Token, 请求头, 报警标签, 默认租户.
+// 请求携带租户时, 报警标签中的租户必须与其一致, 防止租户写入其他租户的数据.
+type Resolver struct {
+	// mu 保护可在运行时替换的 Token.
+	mu      sync.RWMutex
+	options Options
+}
+
+func New(opts ...Option) (*Resolver, error) {
+	options := defaultOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+	if err := ValidateTokens(options.tokens); err != nil {
+		return nil, err
+	}
+	if options.defaultTenant != "" && !Valid(options.defaultTenant) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalid, options.defaultTenant)
+	}
+	return &Resolver{options: options}, nil
+}
+
+// SetTokens 替换 Bearer Token 与租户的对应关系, 租户无效时保留当前 Token.
+func (r *Resolver) SetTokens(tokens map[string]string) error {
+	if err := ValidateTokens(tokens); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.options.tokens = tokens
+	return nil
+}
+
+// ValidateTokens 校验 Bearer Token 对应的租户.
+func ValidateTokens(tokens map[string]string) error {
+	for _, id := range tokens {
+		if !Valid(id) {
+			return fmt.Errorf("%w: %q", ErrInvalid, id)
+		}
+	}
+	return nil
+}
+
+// Request 解析请求携带的租户, 请求未携带租户时返回空字符串.
+// 配置 Token 时请求必须携带有效的 Bearer Token, 请求头中的租户必须与 Token 对应的租户一致.
+func (r *Resolver) Request(req *http.Request) (string, error) {
+	var header string
+	if r.options.header != "" {
+		header = strings.TrimSpace(req.Header.Get(r.options.header))
+		if header != "" && !Valid(header) {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, header)
+		}
+	}
+	r.mu.RLock()
+	tokens := r.options.tokens
+	r.mu.RUnlock()
+	if len(tokens) == 0 {
+		return header, nil
+	}
+
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", ErrUnauthorized
+	}
+	id, ok := lookup(tokens, strings.TrimSpace(token))
+	if !ok || (header != "" && header != id) {
+		return "", ErrUnauthorized
+	}
+	return id, nil
+}
+
+// Query 返回查询请求所属租户, 请求未携带租户时使用默认租户.
+func (r *Resolver) Query(req *http.Request) (string, error) {
+	id, err := r.Request(req)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		id = r.options.defaultTenant
+	}
+	if id == "" {
+		return "", ErrMissing
+	}
+	return id, nil
+}
+
+// lookup 以固定时间比较 Token, 避免通过响应时间猜测 Token.
+func lookup(tokens map[string]string, token string) (string, bool) {
+	var rlt string
+	found := false
+	for t, id := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			rlt, found = id, true
+		}
+	}
+	return rlt, found
+}
+
+// Alert 返回报警所属租户, requestTenant 为 Request 解析的租户.
+func (r *Resolver) Alert(a alert.Alert, requestTenant string) (string, error) {
+	var label string
+	if r.options.label != "" {
+		label = a.Labels[r.options.label]
+	}
+	switch {
+	case requestTenant != "":
+		if label != "" && label != requestTenant {
+			return "", fmt.Errorf("%w: 报警标签 %s=%q 与请求的租户 %q 不一致", ErrInvalid, r.options.label, label, requestTenant)
+		}
+		return requestTenant, nil
+	case label != "":
+		if !Valid(label) {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, label)
+		}
+		return label, nil
+	case r.options.defaultTenant != "":
+		return r.options.defaultTenant, nil
+	}
+	return "", ErrMissing
+}
+
+// Assign 设置报警所属租户, 任意报警无法确定租户时返回错误且不修改报警.
+func (r *Resolver) Assign(alerts alert.Alerts, requestTenant string) error {
+	tenants := make([]string, len(alerts))
+	for i, a := range alerts {
+		id, err := r.Alert(a, requestTenant)
+		if err != nil {
+			return err
+		}
+		tenants[i] = id
+	}
+	for i := range alerts {
+		alerts[i].Tenant = tenants[i]
+	}
+	return nil
+}
+
+// SyncTenant 返回从 Alertmanager 同步的报警所属租户: 报警标签中的租户或默认租户, 无法确定时返回 false.
+func (r *Resolver) SyncTenant(a alert.Alert) (string, bool) {
+	if r.options.label != "" {
+		if id := a.Labels[r.options.label]; Valid(id) {
+			return id, true
+		}
+	}
+	return r.options.defaultTenant, r.options.defaultTenant != ""
+}
+
+// Synced 判断租户的报警是否与 Alertmanager 同步: 按标签区分租户时 Alertmanager 由全部租户共用,
+// 否则 Alertmanager 仅属于默认租户.
+func (r *Resolver) Synced(id string) bool {
+	return r.options.label != "" || (r.options.defaultTenant != "" && id == r.options.defaultTenant)
+}
@@ -0,0 +1,133 @@
+package tenant
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_Request(t *testing.T) {
+	r, err := New(WithTokens(map[string]string{"secret-a": "team-a"}))
+	require.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    string
+		err     error
+	}{
+		{name: "缺少 Token", headers: map[string]string{DefaultHeader: "team-a"}, err: ErrUnauthorized},
+		{name: "无效 Token", headers: map[string]string{"Authorization": "Bearer wrong"}, err: ErrUnauthorized},
+		{name: "Token", headers: map[string]string{"Authorization": "Bearer secret-a"}, want: "team-a"},
+		{name: "Token 与请求头一致", headers: map[string]string{"Authorization": "Bearer secret-a", DefaultHeader: "team-a"}, want: "team-a"},
+		{name: "Token 与请求头不一致", headers: map[string]string{"Authorization": "Bearer secret-a", DefaultHeader: "team-b"}, err: ErrUnauthorized},
+		{name: "无效租户", headers: map[string]string{"Authorization": "Bearer secret-a", DefaultHeader: "team/a"}, err: ErrInvalid},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/webhook", nil)
+			for k, v := range c.headers {
+				req.Header.Set(k, v)
+			}
+			got, err := r.Request(req)
+			if c.err != nil {
+				require.ErrorIs(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+
+	// 未配置 Token 时信任请求头.
+	r, err = New()
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/webhook", nil)
+	got, err := r.Request(req)
+	require.NoError(t, err)
+	require.Empty(t, got)
+	req.Header.Set(DefaultHeader, "team-b")
+	got, err = r.Request(req)
+	require.NoError(t, err)
+	require.Equal(t, "team-b", got)
+}
+
+func TestResolver_Assign(t *testing.T) {
+	r, err := New(WithLabel("tenant"), WithDefault("shared"))
+	require.NoError(t, err)
+
+	labeled := alert.Alert{Labels: map[string]string{"tenant": "team-a"}}
+	plain := alert.Alert{Labels: map[string]string{"alertname": "Test"}}
+
+	alerts := alert.Alerts{labeled, plain}
+	require.NoError(t, r.Assign(alerts, ""))
+	require.Equal(t, "team-a", alerts[0].Tenant)
+	require.Equal(t, "shared", alerts[1].Tenant)
+
+	// 请求携带租户时报警标签必须与其一致, 失败时不修改报警.
+	alerts = alert.Alerts{plain, labeled}
+	require.ErrorIs(t, r.Assign(alerts, "team-b"), ErrInvalid)
+	require.Empty(t, alerts[0].Tenant)
+	alerts = alert.Alerts{plain, labeled}
+	require.NoError(t, r.Assign(alerts, "team-a"))
+	require.Equal(t, "team-a", alerts[0].Tenant)
+
+	// 未配置默认租户时无法确定租户.
+	r, err = New()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.Assign(alert.Alerts{plain}, ""), ErrMissing)
+}
+
+func TestResolver_Sync(t *testing.T) {
+	r, err := New(WithLabel("tenant"), WithDefault("shared"))
+	require.NoError(t, err)
+	id, ok := r.SyncTenant(alert.Alert{Labels: map[string]string{"tenant": "team-a"}})
+	require.True(t, ok)
+	require.Equal(t, "team-a", id)
+	require.True(t, r.Synced("team-b"))
+
+	// 按请求头区分租户时 Alertmanager 仅属于默认租户.
+	r, err = New()
+	require.NoError(t, err)
+	_, ok = r.SyncTenant(alert.Alert{Labels: map[string]string{"tenant": "team-a"}})
+	require.False(t, ok)
+	require.False(t, r.Synced("team-a"))
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	require.False(t, ok)
+	id, ok := FromContext(WithContext(context.Background(), "team-a"))
+	require.True(t, ok)
+	require.Equal(t, "team-a", id)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New(WithDefault("a b"))
+	require.ErrorIs(t, err, ErrInvalid)
+	_, err = New(WithTokens(map[string]string{"t": ""}))
+	require.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestResolver_SetTokens(t *testing.T) {
+	r, err := New(WithTokens(map[string]string{"secret-a": "team-a"}))
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/webhook", nil)
+	req.Header.Set("Authorization", "Bearer secret-b")
+
+	_, err = r.Request(req)
+	require.ErrorIs(t, err, ErrUnauthorized)
+
+	// 租户无效时保留当前 Token.
+	require.ErrorIs(t, r.SetTokens(map[string]string{"secret-b": "team/b"}), ErrInvalid)
+	_, err = r.Request(req)
+	require.ErrorIs(t, err, ErrUnauthorized)
+
+	require.NoError(t, r.SetTokens(map[string]string{"secret-b": "team-b"}))
+	got, err := r.Request(req)
+	require.NoError(t, err)
+	require.Equal(t, "team-b", got)
+}
@@ -0,0 +1,60 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTP 将消息以 JSON 数组的形式 POST 到 webhook 地址, 返回 2xx 状态码时视为发布成功.
+type HTTP struct {
+	client *http.Client
+	url    string
+}
+
+func NewHTTP(url string) (*HTTP, error) {
+	if url == "" {
+		return nil, fmt.Errorf("webhook 地址不能为空")
+	}
+	return &HTTP{client: &http.Client{}, url: url}, nil
+}
+
+func (h *HTTP) Name() string {
+	return "http"
+}
+
+func (h *HTTP) Publish(ctx context.Context, messages []Message) error {
+	alerts := make([]json.RawMessage, 0, len(messages))
+	for _, m := range messages {
+		alerts = append(alerts, m.Value)
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return fmt.Errorf("无法序列化消息: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("无法创建请求: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("无法发送请求到 %s: %w", h.url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s 返回状态码 %d", h.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,50 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Kafka 将消息发布到 Kafka 兼容的消息队列, 同一报警的消息使用指纹作为 Key 写入同一分区以保证顺序.
+type Kafka struct {
+	client *kgo.Client
+	topic  string
+}
+
+func NewKafka(brokers []string, topic string) (*Kafka, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, fmt.Errorf("Kafka 地址及主题不能为空")
+	}
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.DefaultProduceTopic(topic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建 Kafka 客户端: %w", err)
+	}
+	return &Kafka{client: client, topic: topic}, nil
+}
+
+func (k *Kafka) Name() string {
+	return "kafka"
+}
+
+// Publish 同步发布消息, 所有消息均被 ISR 确认后返回.
+func (k *Kafka) Publish(ctx context.Context, messages []Message) error {
+	records := make([]*kgo.Record, 0, len(messages))
+	for _, m := range messages {
+		records = append(records, &kgo.Record{Key: []byte(m.Key), Value: m.Value})
+	}
+	if err := k.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return fmt.Errorf("无法发布消息到 Kafka 主题 %s: %w", k.topic, err)
+	}
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	k.client.Close()
+	return nil
+}
@@ -0,0 +1,50 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS 将消息发布到 NATS 主题, 发布后等待服务端确认收到全部消息.
+type NATS struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func NewNATS(url, subject string) (*NATS, error) {
+	if url == "" || subject == "" {
+		return nil, fmt.Errorf("NATS 地址及主题不能为空")
+	}
+	conn, err := nats.Connect(url, nats.Name("alert2pg"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("无法连接 NATS: %w", err)
+	}
+	return &NATS{conn: conn, subject: subject}, nil
+}
+
+func (n *NATS) Name() string {
+	return "nats"
+}
+
+func (n *NATS) Publish(ctx context.Context, messages []Message) error {
+	for _, m := range messages {
+		msg := nats.NewMsg(n.subject)
+		msg.Header.Set("Alert-Fingerprint", m.Key)
+		msg.Data = m.Value
+		if err := n.conn.PublishMsg(msg); err != nil {
+			return fmt.Errorf("无法发布消息到 NATS 主题 %s: %w", n.subject, err)
+		}
+	}
+	// Flush 返回时服务端已处理之前发送的全部消息.
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("无法确认 NATS 消息发布: %w", err)
+	}
+	return nil
+}
+
+func (n *NATS) Close() error {
+	n.conn.Close()
+	return nil
+}
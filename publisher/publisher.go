@@ -0,0 +1,19 @@
+// Package publisher 负责将已持久化的报警发布到消息总线, 由 storage 中的 Outbox 转发服务调用.
+package publisher
+
+import (
+	"context"
+)
+
+// Message 发布的报警消息, Key 为报警指纹, Value 为报警信息的 JSON.
+type Message struct {
+	Key   string
+	Value []byte
+}
+
+// Publisher 消息发布者, Publish 返回 nil 时表示消息已被接收方确认, 否则整批消息会被重新发布.
+type Publisher interface {
+	Name() string
+	Publish(ctx context.Context, messages []Message) error
+	Close() error
+}
@@ -0,0 +1,170 @@
+package publisher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var messages = []Message{
+	{Key: "077bf4e884599215", Value: []byte(`{"fingerprint":"077bf4e884599215","status":"firing"}`)},
+	{Key: "dd19ae3d4e06ac55", Value: []byte(`{"fingerprint":"dd19ae3d4e06ac55","status":"resolved"}`)},
+}
+
+func TestKafka(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "alerts"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	p, err := NewKafka(cluster.ListenAddrs(), "alerts")
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, p.Publish(ctx, messages))
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("alerts"), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	got := make([]Message, 0)
+	for len(got) < len(messages) {
+		fetches := consumer.PollFetches(ctx)
+		require.NoError(t, fetches.Err())
+		fetches.EachRecord(func(r *kgo.Record) {
+			got = append(got, Message{Key: string(r.Key), Value: r.Value})
+		})
+	}
+	require.Equal(t, messages, got)
+}
+
+func TestKafka_Invalid(t *testing.T) {
+	_, err := NewKafka(nil, "alerts")
+	require.Error(t, err)
+}
+
+// fakeNATS 进程内的 NATS 服务端, 仅实现发布消息所需的协议.
+type fakeNATS struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeNATS{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return f
+}
+
+func (f *fakeNATS) url() string {
+	return "nats://" + f.listener.Addr().String()
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	io.WriteString(conn, `INFO {"server_id":"fake","version":"2.10.0","proto":1,"headers":true,"max_payload":1048576}`+"\r\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "HPUB":
+			// HPUB <subject> [reply-to] <header size> <total size>
+			headerSize, _ := strconv.Atoi(fields[len(fields)-2])
+			totalSize, _ := strconv.Atoi(fields[len(fields)-1])
+			buf := make([]byte, totalSize+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			key := ""
+			for _, h := range strings.Split(string(buf[:headerSize]), "\r\n") {
+				if k, v, ok := strings.Cut(h, ":"); ok && k == "Alert-Fingerprint" {
+					key = strings.TrimSpace(v)
+				}
+			}
+			f.mu.Lock()
+			f.messages = append(f.messages, Message{Key: key, Value: buf[headerSize:totalSize]})
+			f.mu.Unlock()
+		}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	server := newFakeNATS(t)
+	p, err := NewNATS(server.url(), "alerts")
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, p.Publish(ctx, messages))
+
+	// Flush 确认后服务端已收到全部消息.
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Equal(t, messages, server.messages)
+}
+
+func TestHTTP(t *testing.T) {
+	var got []json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer server.Close()
+
+	p, err := NewHTTP(server.URL)
+	require.NoError(t, err)
+	defer p.Close()
+	require.NoError(t, p.Publish(context.Background(), messages))
+	require.Len(t, got, 2)
+	require.JSONEq(t, string(messages[0].Value), string(got[0]))
+	require.JSONEq(t, string(messages[1].Value), string(got[1]))
+}
+
+func TestHTTP_Failed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	p, err := NewHTTP(server.URL)
+	require.NoError(t, err)
+	require.Error(t, p.Publish(context.Background(), messages))
+}
@@ -0,0 +1,34 @@
+package silence
+
+import "time"
+
+var defaultOptions = Options{
+	interval: 30 * time.Second,
+}
+
+type Options struct {
+	alertmanagerAddrs []string      // 同一集群中各 Alertmanager 的地址, 采集时依次请求直到成功
+	interval          time.Duration // 采集 Alertmanager 静默规则的时间间隔
+}
+
+type Option interface {
+	apply(*Options)
+}
+
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+func WithAlertmanagerAddrs(addrs []string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.alertmanagerAddrs = addrs
+	})
+}
+
+func WithInterval(interval time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.interval = interval
+	})
+}
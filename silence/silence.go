@@ -0,0 +1,175 @@
+// Package silence 负责定期采集 Alertmanager 中的静默规则并归档到数据库中.
+// Alertmanager 仅在保留期内保存已过期的静默规则, 归档后可用于事后追溯报警被静默的原因.
+package silence
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/http"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Saver 静默规则持久化接口, 由 storage.Storage 实现.
+type Saver interface {
+	SaveSilences(ctx context.Context, silences alert.Silences) (alert.Silences, error)
+}
+
+type Collector struct {
+	saver Saver
+
+	// 已归档的静默规则, 未发生变化的静默规则不再重复写入.
+	archived map[string]alert.Silence
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu 保护可在运行时修改的 Alertmanager 地址.
+	mu      sync.RWMutex
+	options Options
+	logger  log.Logger
+
+	collectDurationHistogram prometheus.Histogram
+	archivedSilenceCounter   prometheus.Counter
+	failedCollectCounter     prometheus.Counter
+}
+
+func New(saver Saver, logger log.Logger, opts ...optionFunc) (*Collector, error) {
+	if saver == nil {
+		return nil, fmt.Errorf("空指针: saver")
+	}
+
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Collector{
+		saver:    saver,
+		archived: make(map[string]alert.Silence),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		options:  options,
+		logger:   logger,
+		collectDurationHistogram: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "alert2pg",
+			Subsystem: "silence",
+			Name:      "collect_duration_seconds",
+			Help:      "Histogram of silence collection duration",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		archivedSilenceCounter: prometheus.NewCounter(prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "silence", Name: "archived_silences_total", Help: "Total number of archived silence changes"}),
+		failedCollectCounter:   prometheus.NewCounter(prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "silence", Name: "failed_collections_total", Help: "Total number of failed silence collections"}),
+	}, nil
+}
+
+// Run 启动定期采集静默规则任务.
+func (c *Collector) Run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.options.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.collect(); err != nil {
+				c.failedCollectCounter.Inc()
+				level.Error(c.logger).Log("描述", "归档 Alertmanager 静默规则失败", "err", err)
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// SetAlertmanagerAddrs 修改采集静默规则的 Alertmanager 地址, 下一次采集时生效.
+func (c *Collector) SetAlertmanagerAddrs(addrs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options.alertmanagerAddrs = addrs
+}
+
+// Stop 停止采集任务, 退出前完成一次采集.
+func (c *Collector) Stop() {
+	c.cancel()
+	<-c.done
+	if err := c.collect(); err != nil {
+		level.Error(c.logger).Log("描述", "归档 Alertmanager 静默规则失败", "err", err)
+	}
+}
+
+// Archive 立即采集并归档一次静默规则.
+func (c *Collector) Archive() error {
+	return c.collect()
+}
+
+func (c *Collector) collect() error {
+	start := time.Now()
+	defer func() {
+		c.collectDurationHistogram.Observe(time.Since(start).Seconds())
+	}()
+
+	c.mu.RLock()
+	addrs := c.options.alertmanagerAddrs
+	c.mu.RUnlock()
+	silences, err := http.GetSilencesFromAlertmanager(addrs)
+	if err != nil {
+		return fmt.Errorf("无法获取 Alertmanager 静默规则: %w", err)
+	}
+
+	// 静默规则到期后 Alertmanager 不会修改 updatedAt, 因此需要同时比较状态.
+	set := make(map[string]struct{}, len(silences))
+	changes := make(alert.Silences, 0)
+	for _, s := range silences {
+		set[s.ID] = struct{}{}
+		if archived, ok := c.archived[s.ID]; ok && archived.UpdatedAt.Equal(s.UpdatedAt) && archived.State == s.State {
+			continue
+		}
+		changes = append(changes, s)
+	}
+	// Alertmanager 已清理的静默规则不再需要比较.
+	for id := range c.archived {
+		if _, ok := set[id]; !ok {
+			delete(c.archived, id)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	successes, err := c.saver.SaveSilences(context.Background(), changes)
+	for _, s := range successes {
+		c.archived[s.ID] = s
+	}
+	c.archivedSilenceCounter.Add(float64(len(successes)))
+	if err != nil {
+		return fmt.Errorf("无法保存静默规则: %w", err)
+	}
+	return nil
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.collectDurationHistogram.Describe(ch)
+	c.archivedSilenceCounter.Describe(ch)
+	c.failedCollectCounter.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collectDurationHistogram.Collect(ch)
+	c.archivedSilenceCounter.Collect(ch)
+	c.failedCollectCounter.Collect(ch)
+}
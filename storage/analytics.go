@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"alert2pg/pkg/matcher"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnalyticsQuery 报警统计条件, 按标签 By 的值分组统计开始时间在 [Since, Until) 内且满足 Matchers 的报警.
+// 零值时间不作为过滤条件.
+type AnalyticsQuery struct {
+	By       string
+	Since    time.Time
+	Until    time.Time
+	Matchers matcher.Matchers
+}
+
+// ResolveStats 分组内 Resolved 报警的恢复时长(endsAt - startsAt)统计.
+type ResolveStats struct {
+	Group  string
+	Alerts int64
+	Mean   time.Duration
+	P90    time.Duration
+}
+
+// FiringCount 分组在一个统计周期内触发的报警数量.
+type FiringCount struct {
+	Group  string
+	Period time.Time
+	Alerts int64
+}
+
+// FlappingStats 报警在统计窗口内的 Firing/Resolved 循环次数, 循环次数越多报警越不稳定.
+type FlappingStats struct {
+	Tenant      string
+	Fingerprint string
+	Group       string
+	Cycles      int64
+}
+
+// OpenStats 分组内当前 Firing 报警的持续时长统计.
+type OpenStats struct {
+	Group  string
+	Alerts int64
+	Mean   time.Duration
+	Oldest time.Duration
+}
+
+// ResolveStats 按分组统计 Resolved 报警的平均及 P90 恢复时长.
+func (p *Postgres) ResolveStats(ctx context.Context, q AnalyticsQuery) ([]ResolveStats, error) {
+	group, where, args := p.analyticsFilter(ctx, q, "a.status = 'resolved' AND a.endsAt IS NOT NULL")
+	rows, err := p.pool.Query(ctx, fmt.Sprintf(`
+	SELECT g, count(*), avg(d), percentile_cont(0.9) WITHIN GROUP (ORDER BY d)
+	FROM (SELECT %s AS g, EXTRACT(EPOCH FROM a.endsAt - a.startsAt)::FLOAT8 AS d FROM Alert a WHERE %s) t
+	GROUP BY g ORDER BY g`, group, where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("无法统计报警恢复时长: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]ResolveStats, 0)
+	for rows.Next() {
+		var s ResolveStats
+		var mean, p90 float64
+		if err := rows.Scan(&s.Group, &s.Alerts, &mean, &p90); err != nil {
+			return nil, fmt.Errorf("无法读取报警恢复时长: %w", err)
+		}
+		s.Mean, s.P90 = seconds(mean), seconds(p90)
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// FiringCounts 按分组及周期统计触发的报警数量, 周期按 Unix 时间对齐.
+func (p *Postgres) FiringCounts(ctx context.Context, q AnalyticsQuery, period time.Duration) ([]FiringCount, error) {
+	if period < time.Second {
+		return nil, fmt.Errorf("无效的统计周期: %s", period)
+	}
+	group, where, args := p.analyticsFilter(ctx, q, "")
+	args = append(args, period.Seconds())
+	rows, err := p.pool.Query(ctx, fmt.Sprintf(`
+	SELECT g, to_timestamp(floor(EXTRACT(EPOCH FROM startsAt) / $%[3]d) * $%[3]d) AS period, count(*)
+	FROM (SELECT %[1]s AS g, a.startsAt FROM Alert a WHERE %[2]s) t
+	GROUP BY g, period ORDER BY period, g`, group, where, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("无法统计报警数量: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]FiringCount, 0)
+	for rows.Next() {
+		var c FiringCount
+		if err := rows.Scan(&c.Group, &c.Period, &c.Alerts); err != nil {
+			return nil, fmt.Errorf("无法读取报警数量: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Flapping 统计报警在窗口内的 Firing/Resolved 循环次数, 返回循环次数最多的 limit 个报警.
+// 每次循环对应数据库中相同租户及 fingerprint 的一条 Resolved 报警记录, 不同租户的报警可能具有相同的 fingerprint.
+func (p *Postgres) Flapping(ctx context.Context, q AnalyticsQuery, limit int) ([]FlappingStats, error) {
+	group, where, args := p.analyticsFilter(ctx, q, "a.status = 'resolved'")
+	args = append(args, limit)
+	rows, err := p.pool.Query(ctx, fmt.Sprintf(`
+	SELECT a.tenant, a.fingerprint, min(%s), count(*) AS cycles
+	FROM Alert a WHERE %s
+	GROUP BY a.tenant, a.fingerprint
+	HAVING count(*) > 1
+	ORDER BY cycles DESC, a.tenant, a.fingerprint
+	LIMIT $%d`, group, where, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("无法统计报警循环次数: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]FlappingStats, 0)
+	for rows.Next() {
+		var s FlappingStats
+		if err := rows.Scan(&s.Tenant, &s.Fingerprint, &s.Group, &s.Cycles); err != nil {
+			return nil, fmt.Errorf("无法读取报警循环次数: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// OpenStats 按分组统计当前 Firing 报警的数量, 平均及最长持续时长, 不受开始时间范围限制.
+func (p *Postgres) OpenStats(ctx context.Context, q AnalyticsQuery) ([]OpenStats, error) {
+	q.Since, q.Until = time.Time{}, time.Time{}
+	group, where, args := p.analyticsFilter(ctx, q, "a.status = 'firing'")
+	rows, err := p.pool.Query(ctx, fmt.Sprintf(`
+	SELECT g, count(*), avg(d), max(d)
+	FROM (SELECT %s AS g, EXTRACT(EPOCH FROM now() - a.startsAt)::FLOAT8 AS d FROM Alert a WHERE %s) t
+	GROUP BY g ORDER BY g`, group, where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("无法统计 Firing 报警: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]OpenStats, 0)
+	for rows.Next() {
+		var s OpenStats
+		var mean, oldest float64
+		if err := rows.Scan(&s.Group, &s.Alerts, &mean, &oldest); err != nil {
+			return nil, fmt.Errorf("无法读取 Firing 报警统计: %w", err)
+		}
+		s.Mean, s.Oldest = seconds(mean), seconds(oldest)
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// analyticsFilter 生成分组表达式, 查询条件及参数, cond 为额外的查询条件.
+// ctx 中指定租户时仅统计该租户的报警.
+func (p *Postgres) analyticsFilter(ctx context.Context, q AnalyticsQuery, cond string) (string, string, []any) {
+	args := []any{q.By}
+	var group string
+	if p.options.layout == LayoutJSONB {
+		group = "COALESCE(a.labels->>$1, '')"
+	} else {
+		group = "COALESCE((SELECT l.Value FROM AlertLabel l WHERE l.AlertID = a.id AND l.Label = $1), '')"
+	}
+
+	conds := make([]string, 0)
+	if cond != "" {
+		conds = append(conds, cond)
+	}
+	if cond, args = tenantFilter(ctx, "a", args); cond != "" {
+		conds = append(conds, cond)
+	}
+	if !q.Since.IsZero() {
+		args = append(args, q.Since)
+		conds = append(conds, fmt.Sprintf("a.startsAt >= $%d", len(args)))
+	}
+	if !q.Until.IsZero() {
+		args = append(args, q.Until)
+		conds = append(conds, fmt.Sprintf("a.startsAt < $%d", len(args)))
+	}
+	if len(q.Matchers) > 0 {
+		var matchers string
+		matchers, args = q.Matchers.SQL(p.matcherLayout(), "a", args)
+		conds = append(conds, matchers)
+	}
+	if len(conds) == 0 {
+		return group, "TRUE", args
+	}
+	return group, strings.Join(conds, " AND "), args
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeadLetter 死信表中多次存储失败的报警.
+type DeadLetter struct {
+	ID        int
+	Alert     alert.Alert
+	LastError string
+	Attempts  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+var (
+	// ErrDeadLetterNotFound 死信表中不存在指定的报警.
+	ErrDeadLetterNotFound = errors.New("死信表中不存在该报警")
+	// ErrDeadLetterStale 数据库中已存储的报警比死信表中的报警更新, 重新存储会覆盖更新的状态.
+	ErrDeadLetterStale = errors.New("数据库中已存储该报警更新的状态, 不再重新存储, 可使用 purge 从死信表中删除")
+)
+
+// DeadLetter 将多次存储失败的报警写入死信表, 实现 DeadLetterer 接口.
+func (p *Postgres) DeadLetter(ctx context.Context, a alert.Alert, attempts int, lastErr error) error {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("无法序列化报警信息: %w", err)
+	}
+	if _, err := p.pool.Exec(ctx, `
+	INSERT INTO DeadLetter (tenant, fingerprint, startsAt, payload, lastError, attempts)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (tenant, fingerprint, startsAt) DO UPDATE
+	SET payload = EXCLUDED.payload,
+		lastError = EXCLUDED.lastError,
+		attempts = DeadLetter.attempts + EXCLUDED.attempts,
+		updatedAt = now()`,
+		a.Tenant, a.Fingerprint, a.StartsAt, payload, lastErr.Error(), attempts); err != nil {
+		return fmt.Errorf("无法写入死信表: %w", err)
+	}
+	level.Warn(p.logger).Log("详情", "报警多次存储失败, 已写入死信表", "fingerprint", a.Fingerprint, "startsAt", a.StartsAt, "尝试次数", attempts, "错误详情", lastErr)
+	return nil
+}
+
+// DeadLetters 按更新时间倒序返回死信表中的报警, limit 小于等于 0 时返回全部.
+func (p *Postgres) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	sql, args := deadLettersSQL(limit)
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询死信表: %w", err)
+	}
+	defer rows.Close()
+
+	letters := make([]DeadLetter, 0)
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("无法查询死信表: %w", err)
+	}
+	return letters, nil
+}
+
+// GetDeadLetter 返回死信表中指定 ID 的报警.
+func (p *Postgres) GetDeadLetter(ctx context.Context, id int) (DeadLetter, error) {
+	row := p.pool.QueryRow(ctx, `SELECT id, payload, lastError, attempts, createdAt, updatedAt FROM DeadLetter WHERE id = $1`, id)
+	letter, err := scanDeadLetter(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return letter, ErrDeadLetterNotFound
+	}
+	return letter, err
+}
+
+// ReplayDeadLetter 使用当前表结构重新存储死信表中的报警, 存储及从死信表中删除在同一事务中完成, 失败时更新错误信息及尝试次数.
+// 数据库中已存储的报警比死信表中的报警更新时返回 ErrDeadLetterStale, 不覆盖已存储的状态.
+func (p *Postgres) ReplayDeadLetter(ctx context.Context, id int) error {
+	letter, err := p.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	a := letter.Alert
+	if p.options.partitioned {
+		if err := p.ensurePartition(ctx, a.StartsAt); err != nil {
+			return fmt.Errorf("创建分区失败: %w", err)
+		}
+	}
+
+	saveErr := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		// 锁定死信表记录, 同一报警并发重新存储时仅存储一次.
+		if err := tx.QueryRow(ctx, `SELECT id FROM DeadLetter WHERE id = $1 FOR UPDATE`, id).Scan(&id); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrDeadLetterNotFound
+			}
+			return fmt.Errorf("无法锁定死信表记录: %w", err)
+		}
+		if err := p.setTenant(ctx, tx, a.Tenant); err != nil {
+			return err
+		}
+
+		var stored storedState
+		err := tx.QueryRow(ctx, `SELECT status, updatedAt FROM Alert WHERE tenant = $1 AND fingerprint = $2 AND startsAt = $3 FOR UPDATE`,
+			a.Tenant, a.Fingerprint, a.StartsAt).Scan(&stored.status, &stored.updatedAt)
+		switch {
+		case err == nil && stored.supersedes(a):
+			return ErrDeadLetterStale
+		case err != nil && !errors.Is(err, pgx.ErrNoRows):
+			return fmt.Errorf("查询 Alert 表中的报警失败: %w", err)
+		}
+
+		if err := p.saveTx(ctx, tx, a); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM DeadLetter WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("无法从死信表中删除报警: %w", err)
+		}
+		return nil
+	})
+	if saveErr == nil || errors.Is(saveErr, ErrDeadLetterNotFound) || errors.Is(saveErr, ErrDeadLetterStale) {
+		return saveErr
+	}
+
+	if _, err := p.pool.Exec(ctx, `UPDATE DeadLetter SET lastError = $1, attempts = attempts + 1, updatedAt = now() WHERE id = $2`, saveErr.Error(), id); err != nil {
+		level.Error(p.logger).Log("详情", "无法更新死信表", "id", id, "错误详情", err)
+	}
+	return fmt.Errorf("重新存储报警失败: %w", saveErr)
+}
+
+// storedState Alert 表中已存储报警的状态.
+type storedState struct {
+	status    string
+	updatedAt *time.Time
+}
+
+// supersedes 判断已存储的报警是否比 a 更新: 同一报警 Resolved 后不会再次 Firing,
+// 两者均有 Alertmanager 更新时间时, 已存储的更新时间更晚同样视为更新.
+func (s storedState) supersedes(a alert.Alert) bool {
+	if s.status == alert.Resolved && a.Status == alert.Firing {
+		return true
+	}
+	return s.updatedAt != nil && !a.UpdatedAt.IsZero() && s.updatedAt.After(a.UpdatedAt)
+}
+
+// PurgeDeadLetters 从死信表中删除指定 ID 的报警, ids 为空时删除全部, 返回删除的数量.
+func (p *Postgres) PurgeDeadLetters(ctx context.Context, ids []int) (int64, error) {
+	sql, args := purgeDeadLettersSQL(ids)
+	tag, err := p.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, fmt.Errorf("无法清理死信表: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// deadLettersSQL 生成按更新时间倒序查询死信表的 SQL, limit 小于等于 0 时不限制数量.
+func deadLettersSQL(limit int) (string, []any) {
+	sql := `SELECT id, payload, lastError, attempts, createdAt, updatedAt FROM DeadLetter ORDER BY updatedAt DESC, id DESC`
+	args := []any{}
+	if limit > 0 {
+		sql += ` LIMIT $1`
+		args = append(args, limit)
+	}
+	return sql, args
+}
+
+// purgeDeadLettersSQL 生成删除死信表中报警的 SQL, ids 为空时删除全部.
+func purgeDeadLettersSQL(ids []int) (string, []any) {
+	sql := `DELETE FROM DeadLetter`
+	args := []any{}
+	if len(ids) > 0 {
+		sql += ` WHERE id = ANY($1)`
+		args = append(args, ids)
+	}
+	return sql, args
+}
+
+// scanDeadLetter 读取一行死信表记录.
+func scanDeadLetter(row pgx.Row) (DeadLetter, error) {
+	var letter DeadLetter
+	var payload []byte
+	if err := row.Scan(&letter.ID, &payload, &letter.LastError, &letter.Attempts, &letter.CreatedAt, &letter.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return letter, err
+		}
+		return letter, fmt.Errorf("无法读取死信表记录: %w", err)
+	}
+	if err := json.Unmarshal(payload, &letter.Alert); err != nil {
+		return letter, fmt.Errorf("无法解析死信表中的报警信息 %d: %w", letter.ID, err)
+	}
+	return letter, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// rowFunc 使用函数实现 pgx.Row.
+type rowFunc func(dest ...any) error
+
+func (f rowFunc) Scan(dest ...any) error { return f(dest...) }
+
+// deadLetterRow 返回一行死信表记录, 依次为 id, payload, lastError, attempts, createdAt, updatedAt.
+func deadLetterRow(id int, payload []byte, lastError string, attempts int, createdAt, updatedAt time.Time) pgx.Row {
+	return rowFunc(func(dest ...any) error {
+		*dest[0].(*int) = id
+		*dest[1].(*[]byte) = payload
+		*dest[2].(*string) = lastError
+		*dest[3].(*int) = attempts
+		*dest[4].(*time.Time) = createdAt
+		*dest[5].(*time.Time) = updatedAt
+		return nil
+	})
+}
+
+func TestScanDeadLetter(t *testing.T) {
+	createdAt := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	a := newTestAlert("a")
+	a.Tenant = "team-a"
+	payload, err := json.Marshal(a)
+	require.NoError(t, err)
+
+	letter, err := scanDeadLetter(deadLetterRow(7, payload, "约束冲突", 5, createdAt, createdAt.Add(time.Minute)))
+	require.NoError(t, err)
+	require.Equal(t, 7, letter.ID)
+	require.Equal(t, "约束冲突", letter.LastError)
+	require.Equal(t, 5, letter.Attempts)
+	require.Equal(t, createdAt, letter.CreatedAt)
+	require.Equal(t, createdAt.Add(time.Minute), letter.UpdatedAt)
+	require.Equal(t, a.Fingerprint, letter.Alert.Fingerprint)
+	require.Equal(t, "team-a", letter.Alert.Tenant)
+	require.True(t, a.StartsAt.Equal(letter.Alert.StartsAt))
+
+	// 不存在的记录原样返回 pgx.ErrNoRows, 由调用方转换为 ErrDeadLetterNotFound.
+	_, err = scanDeadLetter(rowFunc(func(...any) error { return pgx.ErrNoRows }))
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+
+	_, err = scanDeadLetter(rowFunc(func(...any) error { return errors.New("连接已关闭") }))
+	require.ErrorContains(t, err, "无法读取死信表记录")
+
+	// 无法解析的报警信息.
+	_, err = scanDeadLetter(deadLetterRow(8, []byte("{"), "", 1, createdAt, createdAt))
+	require.ErrorContains(t, err, "无法解析死信表中的报警信息 8")
+}
+
+func TestDeadLettersSQL(t *testing.T) {
+	sql, args := deadLettersSQL(0)
+	require.NotContains(t, sql, "LIMIT")
+	require.Empty(t, args)
+
+	sql, args = deadLettersSQL(10)
+	require.Contains(t, sql, "ORDER BY updatedAt DESC, id DESC LIMIT $1")
+	require.Equal(t, []any{10}, args)
+
+	sql, args = purgeDeadLettersSQL(nil)
+	require.Equal(t, "DELETE FROM DeadLetter", sql)
+	require.Empty(t, args)
+
+	sql, args = purgeDeadLettersSQL([]int{1, 2})
+	require.Equal(t, "DELETE FROM DeadLetter WHERE id = ANY($1)", sql)
+	require.Equal(t, []any{[]int{1, 2}}, args)
+}
+
+func TestStoredState_Supersedes(t *testing.T) {
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	earlier, later := now.Add(-time.Minute), now.Add(time.Minute)
+	newAlert := func(status string, updatedAt time.Time) alert.Alert {
+		a := alert.DefaultAlert()
+		a.Status = status
+		a.UpdatedAt = updatedAt
+		return a
+	}
+
+	tests := []struct {
+		name   string
+		stored storedState
+		alert  alert.Alert
+		want   bool
+	}{
+		{"已恢复的报警不再 Firing", storedState{status: alert.Resolved}, newAlert(alert.Firing, time.Time{}), true},
+		{"Firing 报警可以恢复", storedState{status: alert.Firing, updatedAt: &now}, newAlert(alert.Resolved, time.Time{}), false},
+		{"已存储的更新时间更晚", storedState{status: alert.Firing, updatedAt: &later}, newAlert(alert.Firing, now), true},
+		{"死信表中的更新时间更晚", storedState{status: alert.Firing, updatedAt: &earlier}, newAlert(alert.Firing, now), false},
+		{"更新时间相同", storedState{status: alert.Firing, updatedAt: &now}, newAlert(alert.Firing, now), false},
+		{"已存储的报警没有更新时间", storedState{status: alert.Firing}, newAlert(alert.Firing, now), false},
+		{"死信表中的报警没有更新时间", storedState{status: alert.Firing, updatedAt: &now}, newAlert(alert.Firing, time.Time{}), false},
+		{"已恢复的报警再次恢复", storedState{status: alert.Resolved, updatedAt: &later}, newAlert(alert.Resolved, now), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.stored.supersedes(tt.alert))
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+)
+
+// ConvertToJSONB 将 EAV 格式存储的标签及注释按批次转换为 JSONB 格式, 返回转换的报警数量.
+// 转换可以重复执行, 已转换的报警不会被再次处理; purge 为 true 时在同一事务中删除本批次报警在 AlertLabel, AlertAnnotation 表中的记录,
+// 转换期间仍以 EAV 格式写入的报警未被转换, 其标签及注释不会被删除, 可以再次执行转换.
+func (p *Postgres) ConvertToJSONB(ctx context.Context, batchSize int, purge bool) (int64, error) {
+	return convertBatches(batchSize, p.logger, func(limit int) (int64, error) {
+		var n int64
+		err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, `
+			WITH candidates AS (
+				SELECT id FROM Alert
+				WHERE labels IS NULL
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			UPDATE Alert a SET
+				labels = COALESCE((SELECT jsonb_object_agg(l.Label, l.Value) FROM AlertLabel l WHERE l.AlertID = a.id), '{}'::JSONB),
+				annotations = COALESCE((SELECT jsonb_object_agg(n.Annotation, n.Value) FROM AlertAnnotation n WHERE n.AlertID = a.id), '{}'::JSONB)
+			WHERE a.id IN (SELECT id FROM candidates)
+			RETURNING a.id`, limit)
+			if err != nil {
+				return err
+			}
+			ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+			if err != nil {
+				return err
+			}
+			n = int64(len(ids))
+			if !purge || len(ids) == 0 {
+				return nil
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM AlertLabel WHERE AlertID = ANY($1)`, ids); err != nil {
+				return fmt.Errorf("无法删除 EAV 格式的标签: %w", err)
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM AlertAnnotation WHERE AlertID = ANY($1)`, ids); err != nil {
+				return fmt.Errorf("无法删除 EAV 格式的注释: %w", err)
+			}
+			return nil
+		})
+		return n, err
+	})
+}
+
+// convertBatches 每个事务转换至多 batchSize 条报警, 某一批次转换数量小于 batchSize 时视为全部转换完成, 返回转换的报警总数.
+func convertBatches(batchSize int, logger log.Logger, convert func(limit int) (int64, error)) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("无效的批次大小: %d", batchSize)
+	}
+
+	var total int64
+	for {
+		n, err := convert(batchSize)
+		if err != nil {
+			return total, fmt.Errorf("无法转换报警标签及注释: %w", err)
+		}
+		total += n
+		level.Info(logger).Log("消息", "转换报警标签及注释", "本批次", n, "合计", total)
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertBatches(t *testing.T) {
+	// batches 依次为每个批次转换的报警数量.
+	run := func(batchSize int, batches []int64, failAt int) (int64, []int, error) {
+		limits := make([]int, 0)
+		total, err := convertBatches(batchSize, log.NewNopLogger(), func(limit int) (int64, error) {
+			limits = append(limits, limit)
+			if len(limits) == failAt {
+				return 0, errors.New("连接已关闭")
+			}
+			return batches[len(limits)-1], nil
+		})
+		return total, limits, err
+	}
+
+	// 最后一个批次不满时结束.
+	total, limits, err := run(3, []int64{3, 3, 1}, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), total)
+	require.Equal(t, []int{3, 3, 3}, limits)
+
+	// 报警数量恰好为批次大小的整数倍时, 再执行一个空批次后结束.
+	total, limits, err = run(3, []int64{3, 3, 0}, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), total)
+	require.Len(t, limits, 3)
+
+	// 批次失败时返回已转换的数量, 已提交的批次不回滚, 重新执行时继续转换.
+	total, limits, err = run(3, []int64{3, 3, 3}, 2)
+	require.Error(t, err)
+	require.Equal(t, int64(3), total)
+	require.Len(t, limits, 2)
+
+	_, limits, err = run(0, nil, 0)
+	require.Error(t, err)
+	require.Empty(t, limits)
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"maps"
+	"sync"
+)
+
+// Memory 基于内存的 Sink 实现, 数据不会持久化, 用于测试及无数据库的端到端验证.
+type Memory struct {
+	mu     sync.Mutex
+	alerts map[string]alert.Alert
+
+	// fail 不为 nil 时在存储报警前调用, 返回错误时报警存储失败, 用于模拟存储故障.
+	fail func(alert.Alert) error
+}
+
+func NewMemory() *Memory {
+	return &Memory{alerts: make(map[string]alert.Alert)}
+}
+
+// Save 存储报警信息, 与 PostgreSQL 实现保持一致: 标签不更新, 注释合并, 不含状态信息时保留已有状态.
+func (m *Memory) Save(ctx context.Context, alerts alert.Alerts) (alert.Alerts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	successes := make(alert.Alerts, 0, len(alerts))
+	for _, a := range alerts {
+		if err := ctx.Err(); err != nil {
+			return successes, err
+		}
+		if m.fail != nil {
+			if err := m.fail(a); err != nil {
+				return successes, err
+			}
+		}
+
+		stored := *a.Clone()
+		if old, ok := m.alerts[a.Key()]; ok {
+			stored.Labels = old.Labels
+			stored.Annotations = maps.Clone(old.Annotations)
+			if stored.Annotations == nil {
+				stored.Annotations = make(map[string]string, len(a.Annotations))
+			}
+			maps.Copy(stored.Annotations, a.Annotations)
+			if a.State == "" {
+				stored.State, stored.SilencedBy, stored.InhibitedBy, stored.Receivers = old.State, old.SilencedBy, old.InhibitedBy, old.Receivers
+			}
+			if a.UpdatedAt.IsZero() {
+				stored.UpdatedAt = old.UpdatedAt
+			}
+		}
+		m.alerts[a.Key()] = stored
+		successes = append(successes, a)
+	}
+	return successes, nil
+}
+
+// LoadFiring 返回处于 Firing 状态的报警信息.
+func (m *Memory) LoadFiring(ctx context.Context) (alert.Alerts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts := make(alert.Alerts, 0)
+	for _, a := range m.alerts {
+		if a.Status == alert.Firing {
+			alerts = append(alerts, *a.Clone())
+		}
+	}
+	return alerts, nil
+}
+
+// Alerts 返回已存储的全部报警信息.
+func (m *Memory) Alerts() alert.Alerts {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts := make(alert.Alerts, 0, len(m.alerts))
+	for _, a := range m.alerts {
+		alerts = append(alerts, *a.Clone())
+	}
+	return alerts
+}
+
+// Close 实现 Sink 接口, 内存数据在 Close 后仍然可以读取.
+func (m *Memory) Close() error {
+	return nil
+}
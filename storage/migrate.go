@@ -0,0 +1,458 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+)
+
+// migration 数据库表结构变更, 按 version 顺序执行, 已执行的版本记录在 SchemaMigration 表中.
+// 分区模式下优先执行 partitioned 中的语句, TimescaleDB 模式下优先执行 timescale 中的语句.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+	partitioned []string
+	timescale   []string
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "报警基础表结构",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Alert (
+				id           SERIAL PRIMARY KEY,
+				fingerprint  TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				startsAt     TIMESTAMPTZ NOT NULL,
+				endsAt       TIMESTAMPTZ,
+				generatorURL TEXT,
+				UNIQUE (fingerprint, startsAt)
+			)`,
+			`CREATE TABLE IF NOT EXISTS AlertLabel (
+				AlertID INTEGER NOT NULL REFERENCES Alert (id) ON DELETE CASCADE,
+				Label   TEXT NOT NULL,
+				Value   TEXT NOT NULL,
+				PRIMARY KEY (AlertID, Label)
+			)`,
+			`CREATE TABLE IF NOT EXISTS AlertAnnotation (
+				AlertID    INTEGER NOT NULL REFERENCES Alert (id) ON DELETE CASCADE,
+				Annotation TEXT NOT NULL,
+				Value      TEXT NOT NULL,
+				PRIMARY KEY (AlertID, Annotation)
+			)`,
+		},
+		// 分区表的主键及外键必须包含分区键, 因此子表冗余 AlertStartsAt 字段并按其分区.
+		partitioned: []string{
+			`CREATE TABLE IF NOT EXISTS Alert (
+				id           SERIAL,
+				fingerprint  TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				startsAt     TIMESTAMPTZ NOT NULL,
+				endsAt       TIMESTAMPTZ,
+				generatorURL TEXT,
+				PRIMARY KEY (id, startsAt),
+				UNIQUE (fingerprint, startsAt)
+			) PARTITION BY RANGE (startsAt)`,
+			`CREATE TABLE IF NOT EXISTS AlertLabel (
+				AlertID       INTEGER NOT NULL,
+				AlertStartsAt TIMESTAMPTZ NOT NULL,
+				Label         TEXT NOT NULL,
+				Value         TEXT NOT NULL,
+				PRIMARY KEY (AlertID, AlertStartsAt, Label),
+				FOREIGN KEY (AlertID, AlertStartsAt) REFERENCES Alert (id, startsAt) ON DELETE CASCADE
+			) PARTITION BY RANGE (AlertStartsAt)`,
+			`CREATE TABLE IF NOT EXISTS AlertAnnotation (
+				AlertID       INTEGER NOT NULL,
+				AlertStartsAt TIMESTAMPTZ NOT NULL,
+				Annotation    TEXT NOT NULL,
+				Value         TEXT NOT NULL,
+				PRIMARY KEY (AlertID, AlertStartsAt, Annotation),
+				FOREIGN KEY (AlertID, AlertStartsAt) REFERENCES Alert (id, startsAt) ON DELETE CASCADE
+			) PARTITION BY RANGE (AlertStartsAt)`,
+		},
+		// 超表的唯一约束必须包含时间列, 且 TimescaleDB 不支持引用超表的外键, 子表冗余 AlertStartsAt 字段.
+		// TimescaleDB 模式下标签及注释以 JSONB 格式存储, AlertLabel, AlertAnnotation 表仅为保持表结构一致.
+		timescale: []string{
+			`CREATE EXTENSION IF NOT EXISTS timescaledb`,
+			`CREATE TABLE IF NOT EXISTS Alert (
+				id           SERIAL,
+				fingerprint  TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				startsAt     TIMESTAMPTZ NOT NULL,
+				endsAt       TIMESTAMPTZ,
+				generatorURL TEXT,
+				PRIMARY KEY (id, startsAt),
+				UNIQUE (fingerprint, startsAt)
+			)`,
+			`SELECT create_hypertable('alert', 'startsat', if_not_exists => TRUE)`,
+			`CREATE TABLE IF NOT EXISTS AlertLabel (
+				AlertID       INTEGER NOT NULL,
+				AlertStartsAt TIMESTAMPTZ NOT NULL,
+				Label         TEXT NOT NULL,
+				Value         TEXT NOT NULL,
+				PRIMARY KEY (AlertID, AlertStartsAt, Label)
+			)`,
+			`CREATE TABLE IF NOT EXISTS AlertAnnotation (
+				AlertID       INTEGER NOT NULL,
+				AlertStartsAt TIMESTAMPTZ NOT NULL,
+				Annotation    TEXT NOT NULL,
+				Value         TEXT NOT NULL,
+				PRIMARY KEY (AlertID, AlertStartsAt, Annotation)
+			)`,
+		},
+	},
+	{
+		version:     2,
+		description: "Alertmanager 报警状态信息",
+		statements: []string{
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS state TEXT`,
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS silencedBy TEXT[]`,
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS inhibitedBy TEXT[]`,
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS receivers TEXT[]`,
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS updatedAt TIMESTAMPTZ`,
+			`CREATE INDEX IF NOT EXISTS alert_state_idx ON Alert (state)`,
+		},
+	},
+	{
+		version:     3,
+		description: "Alertmanager 静默规则",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Silence (
+				id        TEXT PRIMARY KEY,
+				createdBy TEXT NOT NULL,
+				comment   TEXT NOT NULL,
+				startsAt  TIMESTAMPTZ NOT NULL,
+				endsAt    TIMESTAMPTZ NOT NULL,
+				updatedAt TIMESTAMPTZ NOT NULL,
+				state     TEXT NOT NULL,
+				expiredAt TIMESTAMPTZ
+			)`,
+			`CREATE TABLE IF NOT EXISTS SilenceMatcher (
+				SilenceID TEXT NOT NULL REFERENCES Silence (id) ON DELETE CASCADE,
+				Name      TEXT NOT NULL,
+				Value     TEXT NOT NULL,
+				IsRegex   BOOLEAN NOT NULL,
+				IsEqual   BOOLEAN NOT NULL,
+				PRIMARY KEY (SilenceID, Name, Value, IsRegex, IsEqual)
+			)`,
+			// 报警与静默规则的关联关系, 静默规则可能晚于报警被采集, 因此 SilenceID 不设置外键.
+			`CREATE TABLE IF NOT EXISTS AlertSilence (
+				AlertID   INTEGER NOT NULL REFERENCES Alert (id) ON DELETE CASCADE,
+				SilenceID TEXT NOT NULL,
+				PRIMARY KEY (AlertID, SilenceID)
+			)`,
+			`CREATE INDEX IF NOT EXISTS alertsilence_silenceid_idx ON AlertSilence (SilenceID)`,
+		},
+		partitioned: []string{
+			`CREATE TABLE IF NOT EXISTS Silence (
+				id        TEXT PRIMARY KEY,
+				createdBy TEXT NOT NULL,
+				comment   TEXT NOT NULL,
+				startsAt  TIMESTAMPTZ NOT NULL,
+				endsAt    TIMESTAMPTZ NOT NULL,
+				updatedAt TIMESTAMPTZ NOT NULL,
+				state     TEXT NOT NULL,
+				expiredAt TIMESTAMPTZ
+			)`,
+			`CREATE TABLE IF NOT EXISTS SilenceMatcher (
+				SilenceID TEXT NOT NULL REFERENCES Silence (id) ON DELETE CASCADE,
+				Name      TEXT NOT NULL,
+				Value     TEXT NOT NULL,
+				IsRegex   BOOLEAN NOT NULL,
+				IsEqual   BOOLEAN NOT NULL,
+				PRIMARY KEY (SilenceID, Name, Value, IsRegex, IsEqual)
+			)`,
+			`CREATE TABLE IF NOT EXISTS AlertSilence (
+				AlertID       INTEGER NOT NULL,
+				AlertStartsAt TIMESTAMPTZ NOT NULL,
+				SilenceID     TEXT NOT NULL,
+				PRIMARY KEY (AlertID, AlertStartsAt, SilenceID),
+				FOREIGN KEY (AlertID, AlertStartsAt) REFERENCES Alert (id, startsAt) ON DELETE CASCADE
+			) PARTITION BY RANGE (AlertStartsAt)`,
+			`CREATE INDEX IF NOT EXISTS alertsilence_silenceid_idx ON AlertSilence (SilenceID)`,
+		},
+		// AlertSilence 与 Alert 使用相同的分块跨度及保留策略, 保证删除报警时同时删除关联关系.
+		timescale: []string{
+			`CREATE TABLE IF NOT EXISTS Silence (
+				id        TEXT PRIMARY KEY,
+				createdBy TEXT NOT NULL,
+				comment   TEXT NOT NULL,
+				startsAt  TIMESTAMPTZ NOT NULL,
+				endsAt    TIMESTAMPTZ NOT NULL,
+				updatedAt TIMESTAMPTZ NOT NULL,
+				state     TEXT NOT NULL,
+				expiredAt TIMESTAMPTZ
+			)`,
+			`CREATE TABLE IF NOT EXISTS SilenceMatcher (
+				SilenceID TEXT NOT NULL REFERENCES Silence (id) ON DELETE CASCADE,
+				Name      TEXT NOT NULL,
+				Value     TEXT NOT NULL,
+				IsRegex   BOOLEAN NOT NULL,
+				IsEqual   BOOLEAN NOT NULL,
+				PRIMARY KEY (SilenceID, Name, Value, IsRegex, IsEqual)
+			)`,
+			`CREATE TABLE IF NOT EXISTS AlertSilence (
+				AlertID       INTEGER NOT NULL,
+				AlertStartsAt TIMESTAMPTZ NOT NULL,
+				SilenceID     TEXT NOT NULL,
+				PRIMARY KEY (AlertID, AlertStartsAt, SilenceID)
+			)`,
+			`SELECT create_hypertable('alertsilence', 'alertstartsat', if_not_exists => TRUE)`,
+			`CREATE INDEX IF NOT EXISTS alertsilence_silenceid_idx ON AlertSilence (SilenceID)`,
+		},
+	},
+	{
+		version:     4,
+		description: "报警保留策略",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS alert_status_endsat_idx ON Alert (status, endsAt)`,
+			`CREATE INDEX IF NOT EXISTS alertlabel_label_value_idx ON AlertLabel (Label, Value)`,
+			`CREATE TABLE IF NOT EXISTS AlertArchive (
+				id           INTEGER PRIMARY KEY,
+				fingerprint  TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				startsAt     TIMESTAMPTZ NOT NULL,
+				endsAt       TIMESTAMPTZ,
+				generatorURL TEXT,
+				state        TEXT,
+				silencedBy   TEXT[],
+				inhibitedBy  TEXT[],
+				receivers    TEXT[],
+				updatedAt    TIMESTAMPTZ,
+				labels       JSONB NOT NULL,
+				annotations  JSONB NOT NULL,
+				archivedAt   TIMESTAMPTZ NOT NULL DEFAULT now()
+			)`,
+		},
+	},
+	{
+		version:     5,
+		description: "JSONB 格式的标签及注释",
+		statements: []string{
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS labels JSONB`,
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS annotations JSONB`,
+			`CREATE INDEX IF NOT EXISTS alert_labels_gin_idx ON Alert USING GIN (labels jsonb_path_ops)`,
+			`CREATE INDEX IF NOT EXISTS alert_annotations_gin_idx ON Alert USING GIN (annotations jsonb_path_ops)`,
+		},
+	},
+	{
+		version:     6,
+		description: "存储失败报警的死信表",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS DeadLetter (
+				id          SERIAL PRIMARY KEY,
+				fingerprint TEXT NOT NULL,
+				startsAt    TIMESTAMPTZ NOT NULL,
+				payload     JSONB NOT NULL,
+				lastError   TEXT NOT NULL,
+				attempts    INTEGER NOT NULL,
+				createdAt   TIMESTAMPTZ NOT NULL DEFAULT now(),
+				updatedAt   TIMESTAMPTZ NOT NULL DEFAULT now(),
+				UNIQUE (fingerprint, startsAt)
+			)`,
+		},
+	},
+	{
+		version:     7,
+		description: "TimescaleDB 压缩及连续聚合",
+		// 仅 TimescaleDB 模式下执行, 其他模式下只记录版本.
+		timescale: []string{
+			// 唯一约束中的列必须用于压缩分段或排序.
+			`ALTER TABLE Alert SET (
+				timescaledb.compress,
+				timescaledb.compress_segmentby = 'fingerprint',
+				timescaledb.compress_orderby = 'startsAt DESC, id'
+			)`,
+			// 仅压缩不包含 Firing 报警的分块, Firing 报警恢复时仍需要更新.
+			`CREATE OR REPLACE PROCEDURE alert2pg_compress_resolved_chunks(job_id INTEGER, config JSONB)
+			LANGUAGE plpgsql AS $$
+			DECLARE
+				chunk  REGCLASS;
+				firing BOOLEAN;
+			BEGIN
+				FOR chunk IN SELECT show_chunks('alert', older_than => (config->>'compress_after')::INTERVAL) LOOP
+					EXECUTE format('SELECT EXISTS (SELECT 1 FROM %s WHERE status = ''firing'')', chunk) INTO firing;
+					IF NOT firing THEN
+						PERFORM compress_chunk(chunk, if_not_compressed => TRUE);
+					END IF;
+					COMMIT;
+				END LOOP;
+			END
+			$$`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS AlertHourly
+			WITH (timescaledb.continuous) AS
+			SELECT time_bucket(INTERVAL '1 hour', startsAt) AS bucket,
+				labels->>'alertname' AS alertname,
+				labels->>'severity' AS severity,
+				count(*) AS alerts
+			FROM Alert
+			GROUP BY bucket, alertname, severity
+			WITH NO DATA`,
+			`SELECT add_continuous_aggregate_policy('alerthourly',
+				start_offset => INTERVAL '3 days',
+				end_offset => INTERVAL '1 hour',
+				schedule_interval => INTERVAL '1 hour',
+				if_not_exists => TRUE)`,
+		},
+	},
+	{
+		version:     8,
+		description: "报警转发 Outbox",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS Outbox (
+				id          BIGSERIAL PRIMARY KEY,
+				fingerprint TEXT NOT NULL,
+				startsAt    TIMESTAMPTZ NOT NULL,
+				payload     JSONB NOT NULL,
+				createdAt   TIMESTAMPTZ NOT NULL DEFAULT now()
+			)`,
+		},
+	},
+	{
+		version:     9,
+		description: "报警抖动标记",
+		statements: []string{
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS flapping BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS transitions INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE AlertArchive ADD COLUMN IF NOT EXISTS flapping BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE AlertArchive ADD COLUMN IF NOT EXISTS transitions INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version:     10,
+		description: "报警所属租户",
+		// 不同租户的报警可能具有相同的 fingerprint, 唯一约束需包含租户.
+		statements: []string{
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE AlertArchive ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE DeadLetter ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE Alert DROP CONSTRAINT IF EXISTS alert_fingerprint_startsat_key`,
+			`ALTER TABLE Alert ADD CONSTRAINT alert_tenant_fingerprint_startsat_key UNIQUE (tenant, fingerprint, startsAt)`,
+			`ALTER TABLE DeadLetter DROP CONSTRAINT IF EXISTS deadletter_fingerprint_startsat_key`,
+			`ALTER TABLE DeadLetter ADD CONSTRAINT deadletter_tenant_fingerprint_startsat_key UNIQUE (tenant, fingerprint, startsAt)`,
+		},
+		// 已压缩的超表无法修改唯一约束, TimescaleDB 模式下不支持多租户, 仅添加租户字段保持表结构一致.
+		timescale: []string{
+			`ALTER TABLE Alert ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE AlertArchive ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE DeadLetter ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE DeadLetter DROP CONSTRAINT IF EXISTS deadletter_fingerprint_startsat_key`,
+			`ALTER TABLE DeadLetter ADD CONSTRAINT deadletter_tenant_fingerprint_startsat_key UNIQUE (tenant, fingerprint, startsAt)`,
+		},
+	},
+	{
+		version:     11,
+		description: "TimescaleDB 保留不包含 Firing 报警的分块",
+		// 仅 TimescaleDB 模式下执行, 其他模式下只记录版本.
+		timescale: []string{
+			// 内置的保留策略按时间删除分块, 会删除仍处于 Firing 状态的报警, 仅删除不包含 Firing 报警的分块.
+			// 先删除 AlertSilence 的分块, 检查时仍能关联到对应的报警.
+			`CREATE OR REPLACE PROCEDURE alert2pg_drop_resolved_chunks(job_id INTEGER, config JSONB)
+			LANGUAGE plpgsql AS $$
+			DECLARE
+				chunk  REGCLASS;
+				firing BOOLEAN;
+			BEGIN
+				FOR chunk IN SELECT show_chunks('alertsilence', older_than => (config->>'drop_after')::INTERVAL) LOOP
+					EXECUTE format('SELECT EXISTS (SELECT 1 FROM %s s JOIN Alert a ON a.id = s.AlertID AND a.startsAt = s.AlertStartsAt WHERE a.status = ''firing'')', chunk) INTO firing;
+					IF NOT firing THEN
+						EXECUTE format('DROP TABLE %s', chunk);
+					END IF;
+					COMMIT;
+				END LOOP;
+				FOR chunk IN SELECT show_chunks('alert', older_than => (config->>'drop_after')::INTERVAL) LOOP
+					EXECUTE format('SELECT EXISTS (SELECT 1 FROM %s WHERE status = ''firing'')', chunk) INTO firing;
+					IF NOT firing THEN
+						EXECUTE format('DROP TABLE %s', chunk);
+					END IF;
+					COMMIT;
+				END LOOP;
+			END
+			$$`,
+		},
+	},
+	{
+		version:     12,
+		description: "Outbox 消息所属租户",
+		statements: []string{
+			`ALTER TABLE Outbox ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// migrate 执行尚未执行的数据库表结构变更.
+func (p *Postgres) migrate(ctx context.Context) error {
+	if _, err := p.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS SchemaMigration (
+		version     INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		appliedAt   TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("无法创建 SchemaMigration 表: %w", err)
+	}
+
+	current := 0
+	if err := p.pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM SchemaMigration`).Scan(&current); err != nil {
+		return fmt.Errorf("无法查询数据库表结构版本: %w", err)
+	}
+
+	// 分区及 TimescaleDB 模式仅能在初始化表结构时选择, 之后不能切换.
+	if current > 0 {
+		var kind string
+		if err := p.pool.QueryRow(ctx, `SELECT relkind::TEXT FROM pg_class WHERE relname = 'alert' AND relkind IN ('r', 'p') AND pg_table_is_visible(oid)`).Scan(&kind); err != nil {
+			return fmt.Errorf("无法查询 Alert 表类型: %w", err)
+		}
+		if partitioned := kind == "p"; partitioned != p.options.partitioned {
+			return fmt.Errorf("已存在的 Alert 表分区模式(%t)与配置(%t)不一致", partitioned, p.options.partitioned)
+		}
+		if p.options.timescale {
+			hypertable, err := p.isHypertable(ctx, "alert")
+			if err != nil {
+				return err
+			}
+			if !hypertable {
+				return fmt.Errorf("已存在的 Alert 表不是 TimescaleDB 超表, 无法启用 TimescaleDB 模式")
+			}
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		statements := m.statements
+		switch {
+		case p.options.timescale:
+			if m.timescale != nil {
+				statements = m.timescale
+			}
+		case p.options.partitioned:
+			if m.partitioned != nil {
+				statements = m.partitioned
+			}
+		}
+		if err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+			for _, stmt := range statements {
+				if _, err := tx.Exec(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO SchemaMigration (version, description) VALUES ($1, $2)`, m.version, m.description)
+			return err
+		}); err != nil {
+			return fmt.Errorf("无法执行数据库表结构变更 %d(%s): %w", m.version, m.description, err)
+		}
+		level.Info(p.logger).Log("消息", "数据库表结构变更完成", "版本", m.version, "描述", m.description)
+	}
+
+	if err := p.applyTenancyPolicies(ctx); err != nil {
+		return err
+	}
+	if p.options.timescale {
+		return p.applyTimescalePolicies(ctx)
+	}
+	return nil
+}
@@ -1,19 +1,43 @@
 package storage
 
 import (
+	"alert2pg/pkg/matcher"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const (
+	LayoutEAV   = "eav"   // 标签及注释按行存储在 AlertLabel, AlertAnnotation 表中
+	LayoutJSONB = "jsonb" // 标签及注释以 JSONB 格式存储在 Alert 表的 labels, annotations 列中
+)
+
 var defaultOptions = Options{
-	timeout: 5 * time.Second,
+	timeout:        5 * time.Second,
+	parallelism:    4,
+	maxAttempts:    5,
+	initialBackoff: 1 * time.Second,
+	maxBackoff:     5 * time.Minute,
+	drainTimeout:   30 * time.Second,
+	// 合并短时间内的多次报警变更, 减少数据库事务数量.
+	minBatchInterval: 10 * time.Millisecond,
 }
 
 type Options struct {
-	cfg         pgxpool.Config
 	timeout     time.Duration // 执行存储一条报警信息的超时时间
 	parallelism int
+
+	// 两次批量存储之间的最小间隔, Buffer 中的报警变更在此期间合并为一个批次.
+	minBatchInterval time.Duration
+
+	// 存储失败报警的重试策略, 永久性错误达到最大尝试次数后写入死信表.
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// 停止时存储剩余报警的最长时间, 仍未存储的报警写入溢出文件, 文件路径为空时丢弃.
+	drainTimeout time.Duration
+	spillFile    string
 }
 
 type Option interface {
@@ -25,3 +49,323 @@ type optionFunc func(*Options)
 func (f optionFunc) apply(o *Options) {
 	f(o)
 }
+
+// WithTimeout 设置存储一条报警信息的超时时间.
+func WithTimeout(timeout time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.timeout = timeout
+	})
+}
+
+// WithParallelism 设置并发存储报警信息的数量.
+func WithParallelism(parallelism int) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.parallelism = parallelism
+	})
+}
+
+// WithMinBatchInterval 设置两次批量存储之间的最小间隔.
+func WithMinBatchInterval(interval time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.minBatchInterval = interval
+	})
+}
+
+// WithDrainTimeout 设置 Stop 时存储剩余报警的最长时间.
+func WithDrainTimeout(timeout time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.drainTimeout = timeout
+	})
+}
+
+// WithSpillFile 设置停止时仍未存储的报警写入的溢出文件, 下次启动时通过 LoadSpill 重新加载.
+func WithSpillFile(path string) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.spillFile = path
+	})
+}
+
+// WithRetry 设置存储失败报警的重试策略.
+func WithRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.maxAttempts = maxAttempts
+		o.initialBackoff = initialBackoff
+		o.maxBackoff = maxBackoff
+	})
+}
+
+var defaultPostgresOptions = PostgresOptions{
+	timeout:                5 * time.Second,
+	layout:                 LayoutEAV,
+	timescaleChunkInterval: 7 * 24 * time.Hour,
+}
+
+type PostgresOptions struct {
+	// 数据库连接配置: cfg 不为 nil 时使用 cfg, 否则解析 dsn. dsn 中未配置的参数使用 PG* 环境变量,
+	// 连接服务文件(PGSERVICE, PGSERVICEFILE)及密码文件(PGPASSFILE, 默认 ~/.pgpass)中的配置.
+	cfg               *pgxpool.Config
+	dsn               string
+	maxConns          int32         // 连接池最大连接数, 0 表示使用 pgxpool 默认值
+	healthCheckPeriod time.Duration // 检查空闲连接的间隔, 0 表示使用 pgxpool 默认值
+	passwordFile      string        // 每次新建连接时读取密码的文件, 用于 Kubernetes Secret 等定期轮换的密码
+
+	// 启动时无法连接数据库的重试退避时间, initialBackoff 为 0 时 NewPostgres 直接返回错误.
+	connectInitialBackoff time.Duration
+	connectMaxBackoff     time.Duration
+
+	timeout     time.Duration // 执行存储一条静默规则的超时时间
+	partitioned bool          // 是否按 startsAt 月份对 Alert 及其子表分区, 仅在初始化表结构时生效
+	layout      string        // 标签及注释的存储方式
+
+	notifyChannel string // 报警存储成功后发布变更通知的通道, 为空时不发布
+	outbox        bool   // 是否在存储报警的事务中写入 Outbox 表, 由 Relay 转发到消息总线
+	tenancy       bool   // 是否启用租户行级安全策略
+
+	// TimescaleDB 超表模式, 是否启用仅在初始化表结构时生效, 压缩及保留任务每次启动时按配置更新.
+	timescale              bool
+	timescaleChunkInterval time.Duration // 超表分块的时间跨度
+	timescaleCompressAfter time.Duration // 压缩开始时间早于该时长且不包含 Firing 报警的分块, 0 表示不压缩
+	timescaleRetention     time.Duration // 删除开始时间早于该时长且不包含 Firing 报警的分块, 0 表示永久保留
+}
+
+type PostgresOption interface {
+	apply(*PostgresOptions)
+}
+
+type postgresOptionFunc func(*PostgresOptions)
+
+func (f postgresOptionFunc) apply(o *PostgresOptions) {
+	f(o)
+}
+
+// WithPoolConfig 设置数据库连接池配置, cfg 必须由 pgxpool.ParseConfig 创建, 设置后忽略 WithDSN.
+func WithPoolConfig(cfg *pgxpool.Config) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.cfg = cfg
+	})
+}
+
+// WithDSN 设置数据库连接字符串, 支持 URL 及 key=value 格式, 为空时仅使用 PG* 环境变量及连接服务文件.
+func WithDSN(dsn string) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.dsn = dsn
+	})
+}
+
+// WithMaxConns 设置连接池最大连接数, 0 表示使用 pgxpool 默认值.
+func WithMaxConns(n int32) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.maxConns = n
+	})
+}
+
+// WithHealthCheckPeriod 设置检查空闲连接的间隔, 0 表示使用 pgxpool 默认值.
+func WithHealthCheckPeriod(period time.Duration) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.healthCheckPeriod = period
+	})
+}
+
+// WithPasswordFile 设置数据库密码文件, 每次新建连接时重新读取, 密码轮换后新建的连接使用新密码.
+func WithPasswordFile(path string) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.passwordFile = path
+	})
+}
+
+// WithConnectRetry 设置启动时无法连接数据库时在后台重试连接, 退避时间从 initialBackoff 开始每次翻倍并增加随机抖动,
+// 不超过 maxBackoff, maxBackoff 为 0 时不限制. 连接成功前 NewPostgres 返回的 Postgres 处于降级模式, Storage 暂停存储, 报警保留在 Buffer 中.
+// initialBackoff 为 0 时不重试, 无法连接数据库时 NewPostgres 直接返回错误. 表结构变更失败不属于连接失败, 总是直接返回错误.
+func WithConnectRetry(initialBackoff, maxBackoff time.Duration) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.connectInitialBackoff = initialBackoff
+		o.connectMaxBackoff = maxBackoff
+	})
+}
+
+// WithPartitioning 设置是否按 startsAt 月份对 Alert 及其子表分区.
+func WithPartitioning(partitioned bool) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.partitioned = partitioned
+	})
+}
+
+// WithLayout 设置标签及注释的存储方式, 由 EAV 切换为 JSONB 前需要执行 alert2pg migrate-jsonb 转换已有数据.
+func WithLayout(layout string) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.layout = layout
+	})
+}
+
+// WithNotifyChannel 设置报警存储成功后通过 pg_notify 发布变更通知的通道, 为空时不发布.
+func WithNotifyChannel(channel string) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.notifyChannel = channel
+	})
+}
+
+// WithOutbox 设置是否在存储报警的事务中写入 Outbox 表.
+func WithOutbox(outbox bool) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.outbox = outbox
+	})
+}
+
+// WithTenancy 设置是否启用租户行级安全策略, 启用后存储报警时仅允许写入报警所属租户的数据.
+func WithTenancy(tenancy bool) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.tenancy = tenancy
+	})
+}
+
+// WithTimescale 设置使用 TimescaleDB 超表存储报警, 启用后使用 TimescaleDB 的压缩及保留任务代替逐行清理.
+func WithTimescale(chunkInterval, compressAfter, retention time.Duration) postgresOptionFunc {
+	return postgresOptionFunc(func(o *PostgresOptions) {
+		o.timescale = true
+		o.timescaleChunkInterval = chunkInterval
+		o.timescaleCompressAfter = compressAfter
+		o.timescaleRetention = retention
+	})
+}
+
+var defaultRetentionOptions = RetentionOptions{
+	interval:  1 * time.Hour,
+	maxAge:    90 * 24 * time.Hour,
+	batchSize: 1000,
+}
+
+type RetentionOptions struct {
+	interval  time.Duration   // 执行清理任务的时间间隔
+	maxAge    time.Duration   // Resolved 报警的默认保留时长
+	batchSize int             // 单个事务中清理报警的最大数量, 避免长时间持有锁
+	archive   bool            // 是否将清理的报警移动到 AlertArchive 表中
+	rules     []RetentionRule // 按标签覆盖默认保留时长, 按顺序匹配, 首个匹配的规则生效
+}
+
+// RetentionRule 标签满足 Matchers 的报警保留 MaxAge 时长.
+type RetentionRule struct {
+	Matchers matcher.Matchers
+	MaxAge   time.Duration
+}
+
+type RetentionOption interface {
+	apply(*RetentionOptions)
+}
+
+type retentionOptionFunc func(*RetentionOptions)
+
+func (f retentionOptionFunc) apply(o *RetentionOptions) {
+	f(o)
+}
+
+func WithRetentionInterval(interval time.Duration) retentionOptionFunc {
+	return retentionOptionFunc(func(o *RetentionOptions) {
+		o.interval = interval
+	})
+}
+
+func WithRetentionMaxAge(maxAge time.Duration) retentionOptionFunc {
+	return retentionOptionFunc(func(o *RetentionOptions) {
+		o.maxAge = maxAge
+	})
+}
+
+func WithRetentionBatchSize(batchSize int) retentionOptionFunc {
+	return retentionOptionFunc(func(o *RetentionOptions) {
+		o.batchSize = batchSize
+	})
+}
+
+func WithRetentionArchive(archive bool) retentionOptionFunc {
+	return retentionOptionFunc(func(o *RetentionOptions) {
+		o.archive = archive
+	})
+}
+
+func WithRetentionRules(rules []RetentionRule) retentionOptionFunc {
+	return retentionOptionFunc(func(o *RetentionOptions) {
+		o.rules = rules
+	})
+}
+
+var defaultRelayOptions = RelayOptions{
+	interval:  1 * time.Second,
+	batchSize: 100,
+	timeout:   10 * time.Second,
+}
+
+type RelayOptions struct {
+	interval  time.Duration // Outbox 表为空时轮询的时间间隔
+	batchSize int           // 单次发布消息的最大数量
+	timeout   time.Duration // 发布一个批次的超时时间
+}
+
+type RelayOption interface {
+	apply(*RelayOptions)
+}
+
+type relayOptionFunc func(*RelayOptions)
+
+func (f relayOptionFunc) apply(o *RelayOptions) {
+	f(o)
+}
+
+// WithRelayInterval 设置 Outbox 表为空时轮询的时间间隔.
+func WithRelayInterval(interval time.Duration) relayOptionFunc {
+	return relayOptionFunc(func(o *RelayOptions) {
+		o.interval = interval
+	})
+}
+
+// WithRelayBatchSize 设置单次发布消息的最大数量.
+func WithRelayBatchSize(batchSize int) relayOptionFunc {
+	return relayOptionFunc(func(o *RelayOptions) {
+		o.batchSize = batchSize
+	})
+}
+
+// WithRelayTimeout 设置发布一个批次的超时时间.
+func WithRelayTimeout(timeout time.Duration) relayOptionFunc {
+	return relayOptionFunc(func(o *RelayOptions) {
+		o.timeout = timeout
+	})
+}
+
+var defaultPartitionOptions = PartitionOptions{
+	interval: 1 * time.Hour,
+	premake:  3,
+}
+
+type PartitionOptions struct {
+	interval  time.Duration // 执行分区维护的时间间隔
+	premake   int           // 提前创建未来月份分区的数量
+	retention time.Duration // 分区保留时长, 分区结束时间早于该时长时被删除, 为 0 时不删除
+}
+
+type PartitionOption interface {
+	apply(*PartitionOptions)
+}
+
+type partitionOptionFunc func(*PartitionOptions)
+
+func (f partitionOptionFunc) apply(o *PartitionOptions) {
+	f(o)
+}
+
+func WithPartitionInterval(interval time.Duration) partitionOptionFunc {
+	return partitionOptionFunc(func(o *PartitionOptions) {
+		o.interval = interval
+	})
+}
+
+func WithPartitionPremake(premake int) partitionOptionFunc {
+	return partitionOptionFunc(func(o *PartitionOptions) {
+		o.premake = premake
+	})
+}
+
+func WithPartitionRetention(retention time.Duration) partitionOptionFunc {
+	return partitionOptionFunc(func(o *PartitionOptions) {
+		o.retention = retention
+	})
+}
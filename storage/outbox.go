@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"alert2pg/publisher"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Relay 负责将 Outbox 表中的报警发布到消息总线.
+// 消息发布成功后才从 Outbox 表中删除, 发布失败或进程退出时整批消息会被重新发布, 保证至少一次送达.
+type Relay struct {
+	postgres   *Postgres
+	publishers []publisher.Publisher
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	options RelayOptions
+	logger  log.Logger
+
+	publishedCounter    *prometheus.CounterVec
+	failedCounter       *prometheus.CounterVec
+	pendingGauge        prometheus.Gauge
+	publishLagHistogram prometheus.Histogram
+}
+
+func NewRelay(postgres *Postgres, publishers []publisher.Publisher, logger log.Logger, opts ...RelayOption) (*Relay, error) {
+	if postgres == nil {
+		return nil, fmt.Errorf("空指针: postgres")
+	}
+	if !postgres.options.outbox {
+		return nil, fmt.Errorf("postgres 未启用 Outbox")
+	}
+	if len(publishers) == 0 {
+		return nil, fmt.Errorf("未配置发布者")
+	}
+
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultRelayOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+	if options.batchSize <= 0 {
+		return nil, fmt.Errorf("无效的批次大小: %d", options.batchSize)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		postgres:   postgres,
+		publishers: publishers,
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		options:    options,
+		logger:     logger,
+		publishedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "outbox", Name: "published_messages_total", Help: "Total number of outbox messages published"},
+			[]string{"publisher"},
+		),
+		failedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "outbox", Name: "publish_failures_total", Help: "Total number of failed outbox publish attempts"},
+			[]string{"publisher"},
+		),
+		pendingGauge: prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "outbox", Name: "pending_messages", Help: "Number of outbox messages waiting to be published"}),
+		publishLagHistogram: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "alert2pg",
+			Subsystem: "outbox",
+			Name:      "publish_lag_seconds",
+			Help:      "Histogram of time between alert commit and outbox publish",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		}),
+	}, nil
+}
+
+// Run 启动转发任务, 存在未发布的消息时连续发布, 否则按间隔轮询.
+func (r *Relay) Run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.options.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.relay(r.ctx)
+			if err != nil {
+				if r.ctx.Err() == nil {
+					level.Error(r.logger).Log("描述", "发布 Outbox 消息失败", "err", err)
+				}
+				break
+			}
+			if n < r.options.batchSize {
+				break
+			}
+		}
+		r.updatePending()
+
+		select {
+		case <-ticker.C:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop 停止转发任务并关闭发布者, 正在发布的批次会被回滚并在下次启动时重新发布.
+func (r *Relay) Stop() {
+	r.cancel()
+	<-r.done
+	for _, p := range r.publishers {
+		if err := p.Close(); err != nil {
+			level.Error(r.logger).Log("描述", "关闭发布者失败", "publisher", p.Name(), "err", err)
+		}
+	}
+}
+
+// outboxMessage Outbox 表中待发布的一条消息.
+type outboxMessage struct {
+	id        int64
+	createdAt time.Time
+	message   publisher.Message
+}
+
+// relay 在一个事务中发布一个批次的消息, 发布成功后删除, 返回发布的消息数量.
+// 使用事务级咨询锁保证同一时间只有一个实例转发, 消息按 id 顺序发布, 同一报警的消息不会乱序.
+// 其他实例正在转发时直接返回, 下次轮询时再尝试.
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	var n int
+	err := pgx.BeginFunc(ctx, r.postgres.pool, func(tx pgx.Tx) error {
+		var locked bool
+		if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('alert2pg_outbox_relay'))`).Scan(&locked); err != nil {
+			return fmt.Errorf("无法获取 Outbox 转发锁: %w", err)
+		}
+		if !locked {
+			return nil
+		}
+
+		rows, err := tx.Query(ctx, `SELECT id, fingerprint, payload, createdAt FROM Outbox ORDER BY id LIMIT $1`, r.options.batchSize)
+		if err != nil {
+			return fmt.Errorf("无法查询 Outbox 表: %w", err)
+		}
+		batch := make([]outboxMessage, 0, r.options.batchSize)
+		for rows.Next() {
+			var m outboxMessage
+			if err := rows.Scan(&m.id, &m.message.Key, &m.message.Value, &m.createdAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("无法读取 Outbox 表: %w", err)
+			}
+			batch = append(batch, m)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("无法读取 Outbox 表: %w", err)
+		}
+
+		n, err = r.publish(ctx, batch, func(ids []int64) error {
+			_, err := tx.Exec(ctx, `DELETE FROM Outbox WHERE id = ANY($1)`, ids)
+			return err
+		})
+		return err
+	})
+	return n, err
+}
+
+// publish 将一个批次的消息依次发布到所有发布者, 全部成功后调用 remove 删除已发布的消息, 返回发布的消息数量.
+// 任一发布者失败时不删除消息, 由调用方回滚事务后整批重新发布, 已成功的发布者会收到重复消息.
+func (r *Relay) publish(ctx context.Context, batch []outboxMessage, remove func(ids []int64) error) (int, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	ids := make([]int64, 0, len(batch))
+	messages := make([]publisher.Message, 0, len(batch))
+	for _, m := range batch {
+		ids = append(ids, m.id)
+		messages = append(messages, m.message)
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.options.timeout)
+	defer cancel()
+	for _, p := range r.publishers {
+		if err := p.Publish(publishCtx, messages); err != nil {
+			r.failedCounter.WithLabelValues(p.Name()).Inc()
+			return 0, fmt.Errorf("%s: %w", p.Name(), err)
+		}
+		r.publishedCounter.WithLabelValues(p.Name()).Add(float64(len(messages)))
+	}
+	now := time.Now()
+	for _, m := range batch {
+		r.publishLagHistogram.Observe(now.Sub(m.createdAt).Seconds())
+	}
+
+	if err := remove(ids); err != nil {
+		return 0, fmt.Errorf("无法删除已发布的 Outbox 消息: %w", err)
+	}
+	return len(batch), nil
+}
+
+// updatePending 更新未发布消息数量.
+func (r *Relay) updatePending() {
+	var pending int64
+	if err := r.postgres.pool.QueryRow(r.ctx, `SELECT count(*) FROM Outbox`).Scan(&pending); err != nil {
+		return
+	}
+	r.pendingGauge.Set(float64(pending))
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (r *Relay) Describe(ch chan<- *prometheus.Desc) {
+	r.publishedCounter.Describe(ch)
+	r.failedCounter.Describe(ch)
+	r.pendingGauge.Describe(ch)
+	r.publishLagHistogram.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (r *Relay) Collect(ch chan<- prometheus.Metric) {
+	r.publishedCounter.Collect(ch)
+	r.failedCounter.Collect(ch)
+	r.pendingGauge.Collect(ch)
+	r.publishLagHistogram.Collect(ch)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"alert2pg/publisher"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher 记录收到的消息, err 不为空时发布失败.
+type fakePublisher struct {
+	name     string
+	err      error
+	received [][]publisher.Message
+}
+
+func (f *fakePublisher) Name() string { return f.name }
+
+func (f *fakePublisher) Publish(ctx context.Context, messages []publisher.Message) error {
+	f.received = append(f.received, messages)
+	return f.err
+}
+
+func (f *fakePublisher) Close() error { return nil }
+
+// fakeOutbox 内存中的 Outbox 表, remove 删除指定 id 的消息.
+type fakeOutbox struct {
+	rows []outboxMessage
+}
+
+func (f *fakeOutbox) remove(ids []int64) error {
+	f.rows = slices.DeleteFunc(f.rows, func(m outboxMessage) bool {
+		return slices.Contains(ids, m.id)
+	})
+	return nil
+}
+
+func TestRelay_Publish(t *testing.T) {
+	first := &fakePublisher{name: "first"}
+	second := &fakePublisher{name: "second", err: errors.New("消息总线不可用")}
+	r, err := NewRelay(&Postgres{options: PostgresOptions{outbox: true}}, []publisher.Publisher{first, second}, nil)
+	require.NoError(t, err)
+
+	createdAt := time.Now().Add(-time.Second)
+	outbox := &fakeOutbox{rows: []outboxMessage{
+		{id: 1, createdAt: createdAt, message: publisher.Message{Key: "a", Value: []byte(`{"status":"firing"}`)}},
+		{id: 2, createdAt: createdAt, message: publisher.Message{Key: "b", Value: []byte(`{"status":"firing"}`)}},
+	}}
+	batch := slices.Clone(outbox.rows)
+	messages := []publisher.Message{batch[0].message, batch[1].message}
+
+	// 任一发布者失败时不删除消息, 已成功的发布者会在重新发布时收到重复消息.
+	n, err := r.publish(context.Background(), batch, outbox.remove)
+	require.ErrorContains(t, err, "second: 消息总线不可用")
+	require.Zero(t, n)
+	require.Equal(t, batch, outbox.rows)
+	require.Equal(t, [][]publisher.Message{messages}, first.received)
+	require.Equal(t, 1.0, testutil.ToFloat64(r.failedCounter.WithLabelValues("second")))
+
+	// 全部发布成功后删除消息.
+	second.err = nil
+	n, err = r.publish(context.Background(), batch, outbox.remove)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Empty(t, outbox.rows)
+	require.Equal(t, [][]publisher.Message{messages, messages}, first.received)
+	require.Equal(t, [][]publisher.Message{messages, messages}, second.received)
+	require.Equal(t, 4.0, testutil.ToFloat64(r.publishedCounter.WithLabelValues("first")))
+	require.Equal(t, 2.0, testutil.ToFloat64(r.publishedCounter.WithLabelValues("second")))
+
+	// 无法删除已发布的消息时返回错误, 由事务回滚后重新发布.
+	n, err = r.publish(context.Background(), batch, func([]int64) error {
+		return errors.New("连接已断开")
+	})
+	require.ErrorContains(t, err, "无法删除已发布的 Outbox 消息")
+	require.Zero(t, n)
+
+	// 没有待发布的消息时不调用发布者.
+	n, err = r.publish(context.Background(), nil, outbox.remove)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Len(t, first.received, 3)
+}
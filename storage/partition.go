@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// partitionedTables 按 startsAt 月份分区的表及其分区键, 子表在前, 删除分区时按顺序处理.
+var partitionedTables = []struct {
+	name string
+	key  string
+}{
+	{name: "AlertSilence", key: "AlertStartsAt"},
+	{name: "AlertAnnotation", key: "AlertStartsAt"},
+	{name: "AlertLabel", key: "AlertStartsAt"},
+	{name: "Alert", key: "startsAt"},
+}
+
+// childStatements 子表的写入语句, 参数依次为 AlertID, 子表字段, 分区及 TimescaleDB 模式下最后一个参数为分区键 AlertStartsAt.
+type childStatements struct {
+	insertLabel      string
+	upsertAnnotation string
+	linkSilence      string
+}
+
+var plainStatements = childStatements{
+	insertLabel: `INSERT INTO AlertLabel (AlertID, Label, Value)
+			VALUES ($1, $2, $3)`,
+	upsertAnnotation: `
+		INSERT INTO AlertAnnotation (AlertID, Annotation, Value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (AlertID, Annotation) DO UPDATE
+		SET Value = EXCLUDED.Value`,
+	linkSilence: `
+		INSERT INTO AlertSilence (AlertID, SilenceID)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+}
+
+var partitionedStatements = childStatements{
+	insertLabel: `INSERT INTO AlertLabel (AlertID, Label, Value, AlertStartsAt)
+			VALUES ($1, $2, $3, $4)`,
+	upsertAnnotation: `
+		INSERT INTO AlertAnnotation (AlertID, Annotation, Value, AlertStartsAt)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (AlertID, AlertStartsAt, Annotation) DO UPDATE
+		SET Value = EXCLUDED.Value`,
+	linkSilence: `
+		INSERT INTO AlertSilence (AlertID, SilenceID, AlertStartsAt)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+}
+
+// childArgs 子表写入参数, 分区及 TimescaleDB 模式下追加分区键.
+func (p *Postgres) childArgs(startsAt time.Time, args ...any) []any {
+	if p.options.partitioned || p.options.timescale {
+		args = append(args, startsAt)
+	}
+	return args
+}
+
+// partitionMonth 返回时间所在月份的起始时间(UTC).
+func partitionMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// partitionName 返回表在指定月份的分区名称, 如 alert_p202507.
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_p%s", strings.ToLower(table), month.Format("200601"))
+}
+
+// parsePartitionName 解析 Alert 分区名称对应的月份, 非 alert2pg 创建的分区返回 false.
+func parsePartitionName(name string) (time.Time, bool) {
+	month, err := time.Parse("200601", strings.TrimPrefix(name, "alert_p"))
+	if err != nil || !strings.HasPrefix(name, "alert_p") {
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// ensurePartition 确保报警开始时间所在月份的分区存在, 保证较早开始的报警也能够写入.
+// 仅在检查及记录已创建的分区时持有 partitionsMu, 创建分区期间不阻塞其他月份的写入,
+// 同一月份并发创建时由 CREATE TABLE IF NOT EXISTS 及冲突处理保证幂等.
+func (p *Postgres) ensurePartition(ctx context.Context, startsAt time.Time) error {
+	month := partitionMonth(startsAt)
+
+	p.partitionsMu.Lock()
+	_, ok := p.partitions[month]
+	p.partitionsMu.Unlock()
+	if ok {
+		return nil
+	}
+
+	if err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		// 先创建主表分区, 子表分区的外键依赖主表分区.
+		for i := len(partitionedTables) - 1; i >= 0; i-- {
+			table := partitionedTables[i]
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+				partitionName(table.name, month), table.name, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		// 多个实例同时创建分区时可能出现冲突, 此时分区已由其他实例创建.
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || (pgErr.Code != "42P07" && pgErr.Code != "23505") {
+			return fmt.Errorf("无法创建 %s 分区: %w", month.Format("2006-01"), err)
+		}
+	}
+	p.partitionsMu.Lock()
+	p.partitions[month] = struct{}{}
+	p.partitionsMu.Unlock()
+	return nil
+}
+
+// Partitioner 负责提前创建未来月份的分区, 并分离删除超出保留时长的分区.
+// 启用分区时, 删除整个分区代替逐行删除作为报警的保留机制.
+type Partitioner struct {
+	postgres *Postgres
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	options PartitionOptions
+	logger  log.Logger
+
+	droppedPartitionsCounter prometheus.Counter
+	partitionsGauge          prometheus.Gauge
+}
+
+func NewPartitioner(postgres *Postgres, logger log.Logger, opts ...PartitionOption) (*Partitioner, error) {
+	if postgres == nil {
+		return nil, fmt.Errorf("空指针: postgres")
+	}
+	if !postgres.options.partitioned {
+		return nil, fmt.Errorf("postgres 未启用分区模式")
+	}
+
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultPartitionOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Partitioner{
+		postgres:                 postgres,
+		done:                     make(chan struct{}),
+		ctx:                      ctx,
+		cancel:                   cancel,
+		options:                  options,
+		logger:                   logger,
+		droppedPartitionsCounter: prometheus.NewCounter(prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "partition", Name: "dropped_partitions_total", Help: "Total number of dropped Alert partitions"}),
+		partitionsGauge:          prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "partition", Name: "partitions", Help: "Number of Alert partitions"}),
+	}, nil
+}
+
+// Run 启动分区维护任务, 启动时立即执行一次.
+func (p *Partitioner) Run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.options.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Maintain(p.ctx); err != nil {
+			level.Error(p.logger).Log("描述", "维护 Alert 分区失败", "err", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop 停止分区维护任务.
+func (p *Partitioner) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Maintain 创建当前及未来 premake 个月的分区, 删除结束时间早于保留时长的分区.
+func (p *Partitioner) Maintain(ctx context.Context) error {
+	now := time.Now()
+	current := partitionMonth(now)
+	for i := 0; i <= p.options.premake; i++ {
+		if err := p.postgres.ensurePartition(ctx, current.AddDate(0, i, 0)); err != nil {
+			return err
+		}
+	}
+
+	months, err := p.months(ctx)
+	if err != nil {
+		return err
+	}
+	p.partitionsGauge.Set(float64(len(months)))
+
+	if p.options.retention <= 0 {
+		return nil
+	}
+	expired, err := expiredPartitions(months, now.Add(-p.options.retention), func(month time.Time) (bool, error) {
+		return p.hasFiring(ctx, month)
+	})
+	if err != nil {
+		return err
+	}
+	for _, month := range expired {
+		if err := p.drop(ctx, month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expiredPartitions 返回结束时间不晚于 cutoff 且不包含 Firing 报警的分区月份, firing 检查分区中是否仍存在 Firing 报警.
+func expiredPartitions(months []time.Time, cutoff time.Time, firing func(month time.Time) (bool, error)) ([]time.Time, error) {
+	expired := make([]time.Time, 0)
+	for _, month := range months {
+		if month.AddDate(0, 1, 0).After(cutoff) {
+			continue
+		}
+		ok, err := firing(month)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+		expired = append(expired, month)
+	}
+	return expired, nil
+}
+
+// months 返回数据库中已存在的 Alert 分区月份.
+func (p *Partitioner) months(ctx context.Context) ([]time.Time, error) {
+	rows, err := p.postgres.pool.Query(ctx, `
+	SELECT c.relname FROM pg_inherits i
+	JOIN pg_class c ON c.oid = i.inhrelid
+	JOIN pg_class t ON t.oid = i.inhparent
+	WHERE t.relname = 'alert'
+	ORDER BY c.relname`)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询 Alert 分区: %w", err)
+	}
+	defer rows.Close()
+
+	months := make([]time.Time, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("无法读取 Alert 分区: %w", err)
+		}
+		// 非 alert2pg 创建的分区不做处理.
+		if month, ok := parsePartitionName(name); ok {
+			months = append(months, month)
+		}
+	}
+	return months, rows.Err()
+}
+
+// hasFiring 检查指定月份的分区中是否仍存在 Firing 报警, 存在时跳过删除.
+func (p *Partitioner) hasFiring(ctx context.Context, month time.Time) (bool, error) {
+	alertPartition := partitionName("Alert", month)
+	var firing bool
+	if err := p.postgres.pool.QueryRow(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE status = 'firing')`, alertPartition)).Scan(&firing); err != nil {
+		return false, fmt.Errorf("无法检查分区 %s: %w", alertPartition, err)
+	}
+	if firing {
+		level.Warn(p.logger).Log("消息", "分区中仍存在 Firing 报警, 跳过删除", "分区", alertPartition)
+	}
+	return firing, nil
+}
+
+// drop 分离并删除指定月份的分区.
+func (p *Partitioner) drop(ctx context.Context, month time.Time) error {
+	alertPartition := partitionName("Alert", month)
+	if err := pgx.BeginFunc(ctx, p.postgres.pool, func(tx pgx.Tx) error {
+		for _, table := range partitionedTables {
+			name := partitionName(table.name, month)
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s`, table.name, name)); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP TABLE %s`, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("无法删除分区 %s: %w", alertPartition, err)
+	}
+
+	p.postgres.partitionsMu.Lock()
+	delete(p.postgres.partitions, month)
+	p.postgres.partitionsMu.Unlock()
+	p.droppedPartitionsCounter.Inc()
+	level.Info(p.logger).Log("消息", "已删除过期分区", "月份", month.Format("2006-01"))
+	return nil
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (p *Partitioner) Describe(ch chan<- *prometheus.Desc) {
+	p.droppedPartitionsCounter.Describe(ch)
+	p.partitionsGauge.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (p *Partitioner) Collect(ch chan<- prometheus.Metric) {
+	p.droppedPartitionsCounter.Collect(ch)
+	p.partitionsGauge.Collect(ch)
+}
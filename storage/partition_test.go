@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionMonth(t *testing.T) {
+	// 按 UTC 确定月份, 东八区 7 月 1 日凌晨仍属于 6 月分区.
+	cst := time.FixedZone("CST", 8*60*60)
+	month := partitionMonth(time.Date(2025, 7, 1, 2, 0, 0, 0, cst))
+	require.Equal(t, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), month)
+	require.Equal(t, "alert_p202506", partitionName("Alert", month))
+	require.Equal(t, "alertlabel_p202506", partitionName("AlertLabel", month))
+
+	// 跨年.
+	month = partitionMonth(time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC))
+	require.Equal(t, "alert_p202601", partitionName("Alert", month.AddDate(0, 1, 0)))
+
+	parsed, ok := parsePartitionName("alert_p202506")
+	require.True(t, ok)
+	require.Equal(t, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), parsed)
+	for _, name := range []string{"alert_default", "alert_p2025", "alertlabel_p202506", "alert_p202506_old"} {
+		_, ok := parsePartitionName(name)
+		require.False(t, ok, name)
+	}
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	months := []time.Time{
+		time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	firingMonth := months[1]
+	firing := func(month time.Time) (bool, error) {
+		return month.Equal(firingMonth), nil
+	}
+
+	// 3 月分区在截止时间后结束, 2 月分区仍存在 Firing 报警, 均不删除.
+	cutoff := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+	expired, err := expiredPartitions(months, cutoff, firing)
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{months[0]}, expired)
+
+	// 分区结束时间等于截止时间时删除.
+	expired, err = expiredPartitions(months, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), firing)
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{months[0], months[2]}, expired)
+
+	// 无法检查分区时不删除任何分区.
+	_, err = expiredPartitions(months, cutoff, func(time.Time) (bool, error) {
+		return false, errors.New("数据库不可用")
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,440 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/backoff"
+	"alert2pg/pkg/notify"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres 基于 PostgreSQL 的 Sink 实现, 同时负责表结构变更, 静默规则及死信表的存储.
+type Postgres struct {
+	pool *pgxpool.Pool
+
+	// 分区模式下已确认存在的分区月份及子表写入语句.
+	partitions   map[time.Time]struct{}
+	partitionsMu sync.Mutex
+	statements   childStatements
+
+	// 连接数据库并完成表结构变更后关闭 connected, 启动时无法连接数据库时由 reconnect 在后台重试.
+	connected chan struct{}
+	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	options PostgresOptions
+	logger  log.Logger
+}
+
+// connectTimeout 连接数据库并执行表结构变更的超时时间.
+const connectTimeout = 5 * time.Second
+
+// poolConfig 返回数据库连接池配置, 不修改 WithPoolConfig 传入的配置.
+func (o PostgresOptions) poolConfig() (*pgxpool.Config, error) {
+	var cfg *pgxpool.Config
+	if o.cfg != nil {
+		cfg = o.cfg.Copy()
+	} else {
+		var err error
+		if cfg, err = pgxpool.ParseConfig(o.dsn); err != nil {
+			return nil, fmt.Errorf("无效的数据库连接配置: %w", err)
+		}
+	}
+	if o.maxConns > 0 {
+		cfg.MaxConns = o.maxConns
+	}
+	if o.healthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = o.healthCheckPeriod
+	}
+	if o.passwordFile != "" {
+		// 启动时确认密码文件可读, 之后每次新建连接时重新读取.
+		if _, err := readPasswordFile(o.passwordFile); err != nil {
+			return nil, err
+		}
+		path, beforeConnect := o.passwordFile, cfg.BeforeConnect
+		cfg.BeforeConnect = func(ctx context.Context, connCfg *pgx.ConnConfig) error {
+			if beforeConnect != nil {
+				if err := beforeConnect(ctx, connCfg); err != nil {
+					return err
+				}
+			}
+			password, err := readPasswordFile(path)
+			if err != nil {
+				return err
+			}
+			connCfg.Password = password
+			return nil
+		}
+	}
+	return cfg, nil
+}
+
+// readPasswordFile 读取密码文件, 忽略末尾的换行符.
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("无法读取数据库密码文件: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// NewPostgres 创建数据库连接池并执行尚未执行的表结构变更.
+// 无法连接数据库时直接返回错误, 设置 WithConnectRetry 时返回处于降级模式的 Postgres 并在后台重试连接.
+// 表结构变更失败时总是直接返回错误, 不进入降级模式.
+func NewPostgres(logger log.Logger, opts ...PostgresOption) (*Postgres, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultPostgresOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+	if options.layout != LayoutEAV && options.layout != LayoutJSONB {
+		return nil, fmt.Errorf("无效的存储方式: %s", options.layout)
+	}
+	if err := options.validateTimescale(); err != nil {
+		return nil, err
+	}
+	if err := options.validateTenancy(); err != nil {
+		return nil, err
+	}
+	cfg, err := options.poolConfig()
+	if err != nil {
+		return nil, err
+	}
+	// 服务自身需要访问全部租户的报警, 新建连接时将当前租户设置为 "*", 存储报警时在事务内设置为报警所属租户.
+	if options.tenancy {
+		afterConnect := cfg.AfterConnect
+		cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			if afterConnect != nil {
+				if err := afterConnect(ctx, conn); err != nil {
+					return err
+				}
+			}
+			_, err := conn.Exec(ctx, `SELECT set_config($1, '*', FALSE)`, tenantSetting)
+			return err
+		}
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建连接池: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Postgres{
+		pool:       pool,
+		partitions: make(map[time.Time]struct{}),
+		statements: plainStatements,
+		connected:  make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		options:    options,
+		logger:     logger,
+	}
+	if options.partitioned || options.timescale {
+		p.statements = partitionedStatements
+	}
+
+	if err := p.ping(); err != nil {
+		if options.connectInitialBackoff <= 0 {
+			cancel()
+			pool.Close()
+			return nil, err
+		}
+		level.Warn(logger).Log("详情", "无法连接数据库, 以降级模式启动并在后台重试连接", "错误详情", err)
+		p.wg.Add(1)
+		go p.reconnect()
+		return p, nil
+	}
+	if err := p.initSchema(); err != nil {
+		cancel()
+		pool.Close()
+		return nil, err
+	}
+	close(p.connected)
+	return p, nil
+}
+
+// ping 检查数据库连接.
+func (p *Postgres) ping() error {
+	ctx, cancel := context.WithTimeout(p.ctx, connectTimeout)
+	defer cancel()
+	if err := p.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("无法连接数据库: %w", err)
+	}
+	return nil
+}
+
+// initSchema 执行尚未执行的表结构变更.
+func (p *Postgres) initSchema() error {
+	ctx, cancel := context.WithTimeout(p.ctx, connectTimeout)
+	defer cancel()
+	if err := p.migrate(ctx); err != nil {
+		return fmt.Errorf("无法初始化数据库表结构: %w", err)
+	}
+	return nil
+}
+
+// reconnect 按退避时间重试连接数据库并执行表结构变更, 全部成功后关闭 connected, Close 时停止重试.
+// 启动后才连接上数据库时已无法使启动失败, 表结构变更失败时记录错误并继续重试, 保持降级模式.
+func (p *Postgres) reconnect() {
+	defer p.wg.Done()
+
+	b := backoff.Backoff{Initial: p.options.connectInitialBackoff, Max: p.options.connectMaxBackoff}
+	wait := b.Duration(1)
+	for attempts := 1; ; attempts++ {
+		select {
+		case <-time.After(wait):
+		case <-p.ctx.Done():
+			return
+		}
+		if err := p.ping(); err != nil {
+			wait = b.Duration(attempts + 1)
+			level.Warn(p.logger).Log("详情", "无法连接数据库, 稍后重试", "下次重试", wait, "错误详情", err)
+			continue
+		}
+		if err := p.initSchema(); err != nil {
+			wait = b.Duration(attempts + 1)
+			level.Error(p.logger).Log("详情", "已连接数据库, 但表结构变更失败, 稍后重试", "下次重试", wait, "错误详情", err)
+			continue
+		}
+		level.Info(p.logger).Log("详情", "已连接数据库, 退出降级模式")
+		close(p.connected)
+		return
+	}
+}
+
+// Connected 返回连接数据库并完成表结构变更后关闭的通道, 实现 Connector 接口.
+func (p *Postgres) Connected() <-chan struct{} {
+	return p.connected
+}
+
+// Save 逐条存储报警信息, 返回成功存储的报警信息, 存储失败的报警错误合并返回.
+func (p *Postgres) Save(ctx context.Context, alerts alert.Alerts) (alert.Alerts, error) {
+	successes := make(alert.Alerts, 0, len(alerts))
+	var errs []error
+	for _, a := range alerts {
+		if err := p.save(ctx, a); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		successes = append(successes, a)
+	}
+	return successes, errors.Join(errs...)
+}
+
+// LoadFiring 返回数据库中处于 Firing 状态的报警信息.
+func (p *Postgres) LoadFiring(ctx context.Context) (alert.Alerts, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+alertColumns+` FROM Alert a WHERE a.status = 'firing'`)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询 Firing 报警: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := make(alert.Alerts, 0)
+	for rows.Next() {
+		stored, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, stored.Alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("无法读取 Firing 报警: %w", err)
+	}
+	return alerts, nil
+}
+
+// Close 停止重试连接并关闭数据库连接池.
+func (p *Postgres) Close() error {
+	p.cancel()
+	p.wg.Wait()
+	p.pool.Close()
+	return nil
+}
+
+// save 将一条报警信息存储到数据库中.
+func (p *Postgres) save(ctx context.Context, a alert.Alert) error {
+	if p.options.partitioned {
+		if err := p.ensurePartition(ctx, a.StartsAt); err != nil {
+			level.Error(p.logger).Log("详情", "无法创建报警所在月份的分区", "startsAt", a.StartsAt, "错误详情", err)
+			return fmt.Errorf("创建分区失败: %w", err)
+		}
+	}
+
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		level.Error(p.logger).Log("详情", "无法从连接池中获取数据库连接", "错误详情", err)
+		return fmt.Errorf("无法从连接池中获取数据库连接: %w", err)
+	}
+	defer conn.Release()
+
+	// 开启事务
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		level.Error(p.logger).Log("详情", "无法开始事务", "错误详情", err)
+		return fmt.Errorf("无法开始事务: %w", err)
+	}
+	defer func() {
+		// 用 Background 确保最大可能地回滚
+		_ = tx.Rollback(context.Background())
+	}()
+
+	if err := p.setTenant(ctx, tx, a.Tenant); err != nil {
+		level.Error(p.logger).Log("详情", "无法设置当前租户", "租户", a.Tenant, "错误详情", err)
+		return err
+	}
+	if err := p.saveTx(ctx, tx, a); err != nil {
+		return err
+	}
+
+	// 提交事务
+	if err := tx.Commit(context.Background()); err != nil {
+		level.Error(p.logger).Log("详情", "无法提交事务", "错误详情", err)
+		return fmt.Errorf("无法提交事务: %w", err)
+	}
+	return nil
+}
+
+// saveTx 在 tx 中存储一条报警信息, 调用方负责设置当前租户及提交事务.
+func (p *Postgres) saveTx(ctx context.Context, tx pgx.Tx, a alert.Alert) error {
+	// 保存整体逻辑
+	// 首先检查 Alert 表中是否存在该条报警信息.
+	// 若存在则为更新, 更新只需要更新 alert, alertannotation 表即可.
+	// 若不存在则为插入.
+	id := -1
+	if err := tx.QueryRow(ctx, `SELECT id FROM Alert WHERE tenant = $1 AND fingerprint = $2 AND startsAt = $3`, a.Tenant, a.Fingerprint, a.StartsAt).Scan(&id); err != nil {
+		if err != pgx.ErrNoRows {
+			level.Error(p.logger).Log("详情", "无法查询 Alert 表中的报警 ID", "fingerprint", a.Fingerprint, "startsAt", a.StartsAt, "错误详情", err)
+			return fmt.Errorf("查询 Alert 表中的报警 ID 失败: %w", err)
+		}
+	}
+
+	if id == -1 {
+		// 插入新的报警信息
+		if err := tx.QueryRow(ctx, `
+	INSERT INTO Alert (fingerprint, status, startsAt, endsAt, generatorURL, state, silencedBy, inhibitedBy, receivers, updatedAt, labels, annotations, flapping, transitions, tenant)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	RETURNING id`, a.Fingerprint, a.Status, a.StartsAt, a.EndsAt, a.GeneratorURL,
+			nullString(a.State), a.SilencedBy, a.InhibitedBy, a.Receivers, nullTime(a.UpdatedAt),
+			p.jsonbValue(a.Labels), p.jsonbValue(a.Annotations), a.Flapping, a.Transitions, a.Tenant).Scan(&id); err != nil {
+			level.Error(p.logger).Log("详情", "无法在 Alert 表中插入报警信息", "错误详情", err)
+			return fmt.Errorf("保存报警数据失败: %w", err)
+		}
+
+		for k, v := range p.eavValues(a.Labels) {
+			if _, err := tx.Exec(ctx, p.statements.insertLabel, p.childArgs(a.StartsAt, id, k, v)...); err != nil {
+				level.Error(p.logger).Log("详情", "无法插入 AlertLabel 表中的标签", "key", k, "错误详情", err)
+				return fmt.Errorf("保存报警标签数据失败: %w", err)
+			}
+		}
+	} else {
+		// 更新现有报警信息
+		// webhook 推送的报警不包含 Alertmanager 中的状态信息, 此时保留数据库中已有的状态.
+		if _, err := tx.Exec(ctx, `
+		UPDATE Alert SET status = $1, endsAt = $2, generatorURL = $3,
+			state = COALESCE($6, state),
+			silencedBy = CASE WHEN $6::TEXT IS NULL THEN silencedBy ELSE $7 END,
+			inhibitedBy = CASE WHEN $6::TEXT IS NULL THEN inhibitedBy ELSE $8 END,
+			receivers = CASE WHEN $6::TEXT IS NULL THEN receivers ELSE $9 END,
+			updatedAt = COALESCE($10, updatedAt),
+			annotations = CASE WHEN $11::JSONB IS NULL THEN annotations ELSE COALESCE(annotations, '{}'::JSONB) || $11 END,
+			flapping = $12, transitions = $13
+		WHERE tenant = $14 AND fingerprint = $4 AND startsAt = $5`, a.Status, a.EndsAt, a.GeneratorURL, a.Fingerprint, a.StartsAt,
+			nullString(a.State), a.SilencedBy, a.InhibitedBy, a.Receivers, nullTime(a.UpdatedAt),
+			p.jsonbValue(a.Annotations), a.Flapping, a.Transitions, a.Tenant); err != nil {
+			level.Error(p.logger).Log("详情", "无法更新 Alert 表中的报警信息", "fingerprint", a.Fingerprint, "startsAt", a.StartsAt, "错误详情", err)
+			return fmt.Errorf("更新 Alert 表中的报警信息失败: %w", err)
+		}
+	}
+
+	for k, v := range p.eavValues(a.Annotations) {
+		_, err := tx.Exec(ctx, p.statements.upsertAnnotation, p.childArgs(a.StartsAt, id, k, v)...)
+		if err != nil {
+			level.Error(p.logger).Log("详情", "无法插入或更新注释", "key", k, "错误详情", err)
+			return fmt.Errorf("保存报警数据失败: %w", err)
+		}
+	}
+
+	// 关联报警与静默规则
+	for _, silenceID := range a.SilencedBy {
+		if _, err := tx.Exec(ctx, p.statements.linkSilence, p.childArgs(a.StartsAt, id, silenceID)...); err != nil {
+			level.Error(p.logger).Log("详情", "无法关联报警与静默规则", "silenceID", silenceID, "错误详情", err)
+			return fmt.Errorf("保存报警静默关联失败: %w", err)
+		}
+	}
+
+	// 写入 Outbox 表, 与报警在同一事务中提交, 由 Relay 转发到消息总线.
+	if p.options.outbox {
+		payload, err := json.Marshal(a)
+		if err != nil {
+			return fmt.Errorf("无法序列化报警信息: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO Outbox (fingerprint, startsAt, payload, tenant) VALUES ($1, $2, $3, $4)`, a.Fingerprint, a.StartsAt, payload, a.Tenant); err != nil {
+			level.Error(p.logger).Log("详情", "无法写入 Outbox 表", "fingerprint", a.Fingerprint, "startsAt", a.StartsAt, "错误详情", err)
+			return fmt.Errorf("写入 Outbox 表失败: %w", err)
+		}
+	}
+
+	// 发布报警变更通知, PostgreSQL 在事务提交后才投递通知.
+	if p.options.notifyChannel != "" {
+		payload, err := json.Marshal(notify.NewPayload(id, a))
+		if err != nil {
+			return fmt.Errorf("无法序列化报警变更通知: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, p.options.notifyChannel, string(payload)); err != nil {
+			level.Error(p.logger).Log("详情", "无法发布报警变更通知", "channel", p.options.notifyChannel, "错误详情", err)
+			return fmt.Errorf("发布报警变更通知失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// jsonbValue JSONB 模式下返回写入 Alert 表的标签或注释, EAV 模式下返回 NULL.
+func (p *Postgres) jsonbValue(m map[string]string) any {
+	if p.options.layout != LayoutJSONB {
+		return nil
+	}
+	if m == nil {
+		m = map[string]string{}
+	}
+	return m
+}
+
+// eavValues EAV 模式下返回写入 AlertLabel, AlertAnnotation 表的标签或注释, JSONB 模式下返回空.
+func (p *Postgres) eavValues(m map[string]string) map[string]string {
+	if p.options.layout != LayoutEAV {
+		return nil
+	}
+	return m
+}
+
+// nullString 将空字符串转换为数据库中的 NULL.
+func nullString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// nullTime 将零值时间转换为数据库中的 NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
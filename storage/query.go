@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// alertColumns 查询报警信息的字段, 与 scanAlert 对应; 标签及注释兼容 EAV 及 JSONB 两种存储方式.
+const alertColumns = `a.id, a.fingerprint, a.status, a.startsAt, a.endsAt, COALESCE(a.generatorURL, ''),
+	COALESCE(a.state, ''), a.silencedBy, a.inhibitedBy, a.receivers, a.updatedAt,
+	COALESCE(a.labels, (SELECT jsonb_object_agg(l.Label, l.Value) FROM AlertLabel l WHERE l.AlertID = a.id), '{}'::JSONB),
+	COALESCE(a.annotations, (SELECT jsonb_object_agg(n.Annotation, n.Value) FROM AlertAnnotation n WHERE n.AlertID = a.id), '{}'::JSONB),
+	a.flapping, a.transitions, a.tenant`
+
+// ErrAlertNotFound 数据库中不存在指定的报警.
+var ErrAlertNotFound = errors.New("报警不存在")
+
+// StoredAlert 数据库中存储的报警信息.
+type StoredAlert struct {
+	ID    int
+	Alert alert.Alert
+}
+
+// AlertQuery 报警查询条件, 零值字段不作为过滤条件.
+// 查询结果按 ID 倒序排列, After 为上一页最后一条报警的 ID, 用于分页.
+type AlertQuery struct {
+	Status      string
+	Since       time.Time // startsAt 不早于 Since
+	Until       time.Time // startsAt 早于 Until
+	Fingerprint string
+	Receiver    string
+	Matchers    matcher.Matchers
+	After       int
+	Limit       int
+}
+
+// QueryAlerts 按条件查询报警信息, ctx 中指定租户时仅返回该租户的报警.
+func (p *Postgres) QueryAlerts(ctx context.Context, q AlertQuery) ([]StoredAlert, error) {
+	var conds []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var cond string
+	if cond, args = tenantFilter(ctx, "a", args); cond != "" {
+		conds = append(conds, cond)
+	}
+	if q.Status != "" {
+		conds = append(conds, "a.status = "+arg(q.Status))
+	}
+	if !q.Since.IsZero() {
+		conds = append(conds, "a.startsAt >= "+arg(q.Since))
+	}
+	if !q.Until.IsZero() {
+		conds = append(conds, "a.startsAt < "+arg(q.Until))
+	}
+	if q.Fingerprint != "" {
+		conds = append(conds, "a.fingerprint = "+arg(q.Fingerprint))
+	}
+	if q.Receiver != "" {
+		conds = append(conds, arg(q.Receiver)+" = ANY(a.receivers)")
+	}
+	if len(q.Matchers) > 0 {
+		cond, args = q.Matchers.SQL(p.matcherLayout(), "a", args)
+		conds = append(conds, cond)
+	}
+	if q.After > 0 {
+		conds = append(conds, "a.id < "+arg(q.After))
+	}
+
+	sql := `SELECT ` + alertColumns + ` FROM Alert a`
+	if len(conds) > 0 {
+		sql += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	sql += ` ORDER BY a.id DESC`
+	if q.Limit > 0 {
+		sql += ` LIMIT ` + arg(q.Limit)
+	}
+
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询报警: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := make([]StoredAlert, 0)
+	for rows.Next() {
+		stored, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, stored)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("无法读取报警: %w", err)
+	}
+	return alerts, nil
+}
+
+// GetAlert 返回指定 ID 的报警信息, ctx 中指定租户时其他租户的报警视为不存在.
+func (p *Postgres) GetAlert(ctx context.Context, id int) (StoredAlert, error) {
+	sql := `SELECT ` + alertColumns + ` FROM Alert a WHERE a.id = $1`
+	cond, args := tenantFilter(ctx, "a", []any{id})
+	if cond != "" {
+		sql += ` AND ` + cond
+	}
+	stored, err := scanAlert(p.pool.QueryRow(ctx, sql, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return stored, ErrAlertNotFound
+	}
+	return stored, err
+}
+
+// matcherLayout 返回标签匹配条件对应的标签存储方式.
+func (p *Postgres) matcherLayout() matcher.Layout {
+	if p.options.layout == LayoutJSONB {
+		return matcher.LayoutJSONB
+	}
+	return matcher.LayoutEAV
+}
+
+// scanAlert 读取一行 alertColumns 字段.
+func scanAlert(row pgx.Row) (StoredAlert, error) {
+	var stored StoredAlert
+	a := alert.DefaultAlert()
+	var endsAt, updatedAt *time.Time
+	if err := row.Scan(&stored.ID, &a.Fingerprint, &a.Status, &a.StartsAt, &endsAt, &a.GeneratorURL,
+		&a.State, &a.SilencedBy, &a.InhibitedBy, &a.Receivers, &updatedAt, &a.Labels, &a.Annotations, &a.Flapping, &a.Transitions, &a.Tenant); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return stored, err
+		}
+		return stored, fmt.Errorf("无法读取报警: %w", err)
+	}
+	if endsAt != nil {
+		a.EndsAt = *endsAt
+	}
+	if updatedAt != nil {
+		a.UpdatedAt = *updatedAt
+	}
+	stored.Alert = a
+	return stored, nil
+}
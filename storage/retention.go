@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Retention 负责定期清理超出保留时长的 Resolved 报警.
+// 清理按批次执行, 每个批次使用独立事务, 避免长时间锁表.
+type Retention struct {
+	postgres *Postgres
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	options RetentionOptions
+	logger  log.Logger
+
+	prunedAlertsCounter    *prometheus.CounterVec
+	pruneDurationHistogram prometheus.Histogram
+}
+
+// RetentionReport 保留规则的清理统计, Rule 为 nil 时表示默认保留时长.
+type RetentionReport struct {
+	Rule   *RetentionRule
+	MaxAge time.Duration
+	Alerts int64
+}
+
+func NewRetention(postgres *Postgres, logger log.Logger, opts ...RetentionOption) (*Retention, error) {
+	if postgres == nil {
+		return nil, fmt.Errorf("空指针: postgres")
+	}
+	if postgres.options.timescale {
+		return nil, fmt.Errorf("TimescaleDB 模式下使用 TimescaleDB 保留策略清理报警")
+	}
+
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultRetentionOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+	if options.batchSize <= 0 {
+		return nil, fmt.Errorf("无效的批次大小: %d", options.batchSize)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Retention{
+		postgres: postgres,
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		options:  options,
+		logger:   logger,
+		prunedAlertsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "retention", Name: "pruned_alerts_total", Help: "Total number of pruned alerts"},
+			[]string{"action"},
+		),
+		pruneDurationHistogram: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "alert2pg",
+			Subsystem: "retention",
+			Name:      "prune_duration_seconds",
+			Help:      "Histogram of retention prune duration",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}, nil
+}
+
+// Run 启动定期清理任务.
+func (r *Retention) Run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.options.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := r.Prune(r.ctx); err != nil {
+				level.Error(r.logger).Log("描述", "清理过期报警失败", "err", err)
+			}
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop 停止清理任务, 正在执行的批次会被取消并回滚.
+func (r *Retention) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Prune 按批次清理超出保留时长的报警, 返回清理的报警数量.
+func (r *Retention) Prune(ctx context.Context) (int64, error) {
+	start := time.Now()
+	defer func() {
+		r.pruneDurationHistogram.Observe(time.Since(start).Seconds())
+	}()
+
+	action := "deleted"
+	if r.options.archive {
+		action = "archived"
+	}
+
+	var total int64
+	for {
+		n, err := r.pruneBatch(ctx, start)
+		total += n
+		r.prunedAlertsCounter.WithLabelValues(action).Add(float64(n))
+		if err != nil {
+			return total, err
+		}
+		if n < int64(r.options.batchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		level.Info(r.logger).Log("消息", "清理过期报警完成", "数量", total, "操作", action, "耗时", time.Since(start))
+	}
+	return total, nil
+}
+
+// DryRun 统计各保留规则下将被清理的报警数量, 不修改数据库.
+func (r *Retention) DryRun(ctx context.Context) ([]RetentionReport, error) {
+	ruleExpr, args := r.predicate(time.Now())
+	sql := fmt.Sprintf(`
+	SELECT rule, count(*) FROM (
+		SELECT %s AS rule, a.endsAt FROM Alert a
+		WHERE a.status = 'resolved' AND a.endsAt < $2
+	) t
+	WHERE t.endsAt < ($1::TIMESTAMPTZ[])[t.rule]
+	GROUP BY rule`, ruleExpr)
+
+	reports := make([]RetentionReport, len(r.options.rules)+1)
+	reports[0] = RetentionReport{MaxAge: r.options.maxAge}
+	for i := range r.options.rules {
+		reports[i+1] = RetentionReport{Rule: &r.options.rules[i], MaxAge: r.options.rules[i].MaxAge}
+	}
+
+	rows, err := r.postgres.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("无法统计过期报警: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rule int
+		var count int64
+		if err := rows.Scan(&rule, &count); err != nil {
+			return nil, fmt.Errorf("无法读取过期报警统计: %w", err)
+		}
+		reports[rule-1].Alerts = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("无法读取过期报警统计: %w", err)
+	}
+	return reports, nil
+}
+
+// pruneBatch 在一个事务中清理一个批次的过期报警.
+func (r *Retention) pruneBatch(ctx context.Context, now time.Time) (int64, error) {
+	ruleExpr, args := r.predicate(now)
+	args = append(args, r.options.batchSize)
+	candidates := fmt.Sprintf(`
+	candidates AS (
+		SELECT a.id FROM Alert a
+		WHERE a.status = 'resolved' AND a.endsAt < $2
+			AND a.endsAt < ($1::TIMESTAMPTZ[])[%s]
+		ORDER BY a.id
+		LIMIT $%d
+		FOR UPDATE SKIP LOCKED
+	)`, ruleExpr, len(args))
+
+	var sql string
+	if r.options.archive {
+		sql = `
+	WITH` + candidates + `,
+	archived AS (
+		INSERT INTO AlertArchive (id, fingerprint, status, startsAt, endsAt, generatorURL, state, silencedBy, inhibitedBy, receivers, updatedAt, labels, annotations, flapping, transitions, tenant)
+		SELECT a.id, a.fingerprint, a.status, a.startsAt, a.endsAt, a.generatorURL, a.state, a.silencedBy, a.inhibitedBy, a.receivers, a.updatedAt,
+			COALESCE(a.labels, (SELECT jsonb_object_agg(l.Label, l.Value) FROM AlertLabel l WHERE l.AlertID = a.id), '{}'::JSONB),
+			COALESCE(a.annotations, (SELECT jsonb_object_agg(n.Annotation, n.Value) FROM AlertAnnotation n WHERE n.AlertID = a.id), '{}'::JSONB),
+			a.flapping, a.transitions, a.tenant
+		FROM Alert a WHERE a.id IN (SELECT id FROM candidates)
+		ON CONFLICT (id) DO NOTHING
+	)
+	DELETE FROM Alert WHERE id IN (SELECT id FROM candidates)`
+	} else {
+		sql = `
+	WITH` + candidates + `
+	DELETE FROM Alert WHERE id IN (SELECT id FROM candidates)`
+	}
+
+	var n int64
+	if err := pgx.BeginFunc(ctx, r.postgres.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+		n = tag.RowsAffected()
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("无法清理过期报警: %w", err)
+	}
+	return n, nil
+}
+
+// predicate 生成计算报警所属保留规则的 SQL 表达式及参数.
+// 表达式的值为 $1 截止时间数组的下标: 1 为默认保留时长, i+2 为第 i 条规则; $2 为最晚的截止时间, 用于索引过滤.
+func (r *Retention) predicate(now time.Time) (string, []any) {
+	cutoffs := make([]time.Time, 0, len(r.options.rules)+1)
+	cutoffs = append(cutoffs, now.Add(-r.options.maxAge))
+	for _, rule := range r.options.rules {
+		cutoffs = append(cutoffs, now.Add(-rule.MaxAge))
+	}
+	latest := cutoffs[0]
+	for _, cutoff := range cutoffs[1:] {
+		if cutoff.After(latest) {
+			latest = cutoff
+		}
+	}
+
+	args := []any{cutoffs, latest}
+	if len(r.options.rules) == 0 {
+		return "1", args
+	}
+
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i, rule := range r.options.rules {
+		var cond string
+		cond, args = rule.Matchers.SQL(r.postgres.matcherLayout(), "a", args)
+		fmt.Fprintf(&b, " WHEN %s THEN %d", cond, i+2)
+	}
+	b.WriteString(" ELSE 1 END")
+	return b.String(), args
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (r *Retention) Describe(ch chan<- *prometheus.Desc) {
+	r.prunedAlertsCounter.Describe(ch)
+	r.pruneDurationHistogram.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (r *Retention) Collect(ch chan<- prometheus.Metric) {
+	r.prunedAlertsCounter.Collect(ch)
+	r.pruneDurationHistogram.Collect(ch)
+}
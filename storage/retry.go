@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/backoff"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// retryState 报警的重试状态.
+type retryState struct {
+	attempts    int
+	nextAttempt time.Time
+	lastErr     error
+}
+
+// retryQueue 记录存储失败报警的重试状态, 使用指数退避控制重试频率, 避免失败的报警每次循环都被重试.
+type retryQueue struct {
+	mu     sync.Mutex
+	states map[string]*retryState
+
+	maxAttempts int
+	backoff     backoff.Backoff
+}
+
+func newRetryQueue(maxAttempts int, initialBackoff, maxBackoff time.Duration) *retryQueue {
+	return &retryQueue{
+		states:      make(map[string]*retryState),
+		maxAttempts: maxAttempts,
+		backoff:     backoff.Backoff{Initial: initialBackoff, Max: maxBackoff},
+	}
+}
+
+// due 过滤出已到达重试时间的报警, 同时清理已不在待存储列表中的重试状态.
+func (q *retryQueue) due(alerts alert.Alerts, now time.Time) alert.Alerts {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	set := make(map[string]struct{}, len(alerts))
+	rlt := make(alert.Alerts, 0, len(alerts))
+	for _, a := range alerts {
+		set[a.Key()] = struct{}{}
+		if state, ok := q.states[a.Key()]; ok && now.Before(state.nextAttempt) {
+			continue
+		}
+		rlt = append(rlt, a)
+	}
+	for key := range q.states {
+		if _, ok := set[key]; !ok {
+			delete(q.states, key)
+		}
+	}
+	return rlt
+}
+
+// succeeded 清除存储成功报警的重试状态.
+func (q *retryQueue) succeeded(a alert.Alert) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.states, a.Key())
+}
+
+// failed 记录报警存储失败并计算下一次重试时间, 返回当前重试状态.
+// 永久性错误达到最大尝试次数时 dead 为 true, 报警应写入死信表, 暂时性错误会一直重试.
+func (q *retryQueue) failed(a alert.Alert, err error, now time.Time) (state retryState, dead bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s, ok := q.states[a.Key()]
+	if !ok {
+		s = &retryState{}
+		q.states[a.Key()] = s
+	}
+	s.attempts++
+	s.lastErr = err
+	s.nextAttempt = now.Add(q.backoff.Duration(s.attempts))
+	return *s, !isRetryable(err) && s.attempts >= q.maxAttempts
+}
+
+// next 返回最早的重试时间, 没有处于重试状态的报警时返回零值.
+func (q *retryQueue) next() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var rlt time.Time
+	for _, s := range q.states {
+		if rlt.IsZero() || s.nextAttempt.Before(rlt) {
+			rlt = s.nextAttempt
+		}
+	}
+	return rlt
+}
+
+// len 返回处于重试状态的报警数量.
+func (q *retryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.states)
+}
+
+// isRetryable 判断存储错误是否为暂时性错误: 连接, 超时, 事务序列化冲突及数据库资源不足等.
+// 数据异常, 约束冲突, JSON 编码失败等永久性错误重试无法成功, 无法识别的错误同样视为永久性错误,
+// 达到最大尝试次数后写入死信表, 避免一直重试.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || pgconn.Timeout(err) {
+		return true
+	}
+
+	var (
+		marshalerErr   *json.MarshalerError
+		unsupportedErr *json.UnsupportedTypeError
+		valueErr       *json.UnsupportedValueError
+	)
+	if errors.As(err, &marshalerErr) || errors.As(err, &unsupportedErr) || errors.As(err, &valueErr) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 错误码不足两位时无法判断错误类别, 按永久性错误处理.
+		if len(pgErr.Code) < 2 {
+			return false
+		}
+		switch pgErr.Code[:2] {
+		case "08", // connection exception
+			"40", // transaction rollback: serialization failure, deadlock
+			"53", // insufficient resources
+			"57", // operator intervention: admin shutdown, query canceled
+			"58": // system error
+			return true
+		default:
+			return false
+		}
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// 扩展错误码的低 8 位为主错误码.
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_NOMEM, sqlite3.SQLITE_IOERR,
+			sqlite3.SQLITE_FULL, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_PROTOCOL:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// 网络错误, 连接断开及建立连接失败.
+	var (
+		netErr     net.Error
+		connectErr *pgconn.ConnectError
+	)
+	if errors.As(err, &netErr) || errors.As(err, &connectErr) || pgconn.SafeToRetry(err) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	return false
+}
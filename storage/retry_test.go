@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	_, marshalErr := json.Marshal(math.Inf(1))
+	require.Error(t, marshalErr)
+
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO t (id) VALUES (1), (1)`)
+	require.Error(t, err)
+	sqliteConstraintErr := err
+	_, sqliteSyntaxErr := db.Exec(`INSERT INTO`)
+	require.Error(t, sqliteSyntaxErr)
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"超时", context.DeadlineExceeded, true},
+		{"取消", fmt.Errorf("保存报警失败: %w", context.Canceled), true},
+		{"08 连接异常", &pgconn.PgError{Code: "08006"}, true},
+		{"40 序列化冲突", &pgconn.PgError{Code: "40001"}, true},
+		{"40 死锁", &pgconn.PgError{Code: "40P01"}, true},
+		{"53 资源不足", &pgconn.PgError{Code: "53300"}, true},
+		{"57 管理员关闭", &pgconn.PgError{Code: "57P01"}, true},
+		{"58 系统错误", &pgconn.PgError{Code: "58030"}, true},
+		{"22 数据异常", &pgconn.PgError{Code: "22001"}, false},
+		{"23 约束冲突", fmt.Errorf("保存报警失败: %w", &pgconn.PgError{Code: "23505"}), false},
+		{"42 语法错误", &pgconn.PgError{Code: "42601"}, false},
+		{"缺少错误码", &pgconn.PgError{Message: "未知错误"}, false},
+		{"错误码不完整", &pgconn.PgError{Code: "0"}, false},
+		{"网络错误", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"连接关闭", net.ErrClosed, true},
+		{"连接断开", io.ErrUnexpectedEOF, true},
+		{"连接失效", sql.ErrConnDone, true},
+		{"JSON 编码失败", marshalErr, false},
+		{"SQLite 约束冲突", sqliteConstraintErr, false},
+		{"SQLite 语法错误", sqliteSyntaxErr, false},
+		{"未知错误", errors.New("未知错误"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isRetryable(tt.err))
+		})
+	}
+}
+
+func TestRetryQueue_Backoff(t *testing.T) {
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	a := newTestAlert("a")
+	q := newRetryQueue(5, time.Second, 10*time.Second)
+	// 第 n 次失败后的退避时间, 超过最大退避时间后不再增长.
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		state, _ := q.failed(a, errors.New("未知错误"), now)
+		d := state.nextAttempt.Sub(now)
+		require.GreaterOrEqual(t, d, want, "attempts %d", state.attempts)
+		require.LessOrEqual(t, d, want+want/5, "attempts %d", state.attempts)
+	}
+
+	// 未设置退避时间时立即重试.
+	state, _ := newRetryQueue(5, 0, 0).failed(a, errors.New("未知错误"), now)
+	require.Equal(t, now, state.nextAttempt)
+}
+
+func TestRetryQueue_Failed(t *testing.T) {
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	permanent := &pgconn.PgError{Code: "23505"}
+	transient := &pgconn.PgError{Code: "08006"}
+	a, b := newTestAlert("a"), newTestAlert("b")
+
+	// 永久性错误达到最大尝试次数时写入死信表.
+	q := newRetryQueue(3, time.Second, time.Minute)
+	for attempts := 1; attempts <= 3; attempts++ {
+		state, dead := q.failed(a, permanent, now)
+		require.Equal(t, attempts, state.attempts)
+		require.Equal(t, permanent, state.lastErr)
+		require.Equal(t, attempts == 3, dead, "attempts %d", attempts)
+	}
+
+	// 暂时性错误一直重试.
+	for range 10 {
+		_, dead := q.failed(b, transient, now)
+		require.False(t, dead)
+	}
+	require.Equal(t, 2, q.len())
+
+	// 存储成功后清除重试状态, 再次失败时重新计数.
+	q.succeeded(a)
+	require.Equal(t, 1, q.len())
+	state, dead := q.failed(a, permanent, now)
+	require.Equal(t, 1, state.attempts)
+	require.False(t, dead)
+}
+
+func TestRetryQueue_Due(t *testing.T) {
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	a, b, c := newTestAlert("a"), newTestAlert("b"), newTestAlert("c")
+	q := newRetryQueue(5, time.Second, time.Second)
+	require.True(t, q.next().IsZero())
+
+	state, _ := q.failed(a, errors.New("未知错误"), now)
+	require.Equal(t, state.nextAttempt, q.next())
+
+	// 未到重试时间的报警不存储.
+	require.Equal(t, alert.Alerts{b, c}, q.due(alert.Alerts{a, b, c}, now))
+	require.Equal(t, alert.Alerts{a, b, c}, q.due(alert.Alerts{a, b, c}, state.nextAttempt))
+
+	// 不在待存储列表中的报警清除重试状态.
+	require.Equal(t, alert.Alerts{b}, q.due(alert.Alerts{b}, now))
+	require.Zero(t, q.len())
+	require.True(t, q.next().IsZero())
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveSilences 将静默规则持久化到数据库中, 返回成功持久化到数据库中的静默规则.
+func (p *Postgres) SaveSilences(ctx context.Context, silences alert.Silences) (alert.Silences, error) {
+	successes := make(alert.Silences, 0, len(silences))
+	var errs int
+	for _, silence := range silences {
+		if err := p.saveSilence(ctx, silence); err != nil {
+			level.Error(p.logger).Log("详情", "无法保存静默规则", "id", silence.ID, "错误详情", err)
+			errs++
+			continue
+		}
+		successes = append(successes, silence)
+	}
+	if errs > 0 {
+		return successes, fmt.Errorf("%d 条静默规则保存失败", errs)
+	}
+	return successes, nil
+}
+
+// saveSilence 将一条静默规则存储到数据库中, 静默规则首次过期时记录过期时间.
+func (p *Postgres) saveSilence(ctx context.Context, silence alert.Silence) error {
+	ctx, cancel := context.WithTimeout(ctx, p.options.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+		INSERT INTO Silence (id, createdBy, comment, startsAt, endsAt, updatedAt, state, expiredAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $7 = $8 THEN now() END)
+		ON CONFLICT (id) DO UPDATE
+		SET createdBy = EXCLUDED.createdBy,
+			comment = EXCLUDED.comment,
+			startsAt = EXCLUDED.startsAt,
+			endsAt = EXCLUDED.endsAt,
+			updatedAt = EXCLUDED.updatedAt,
+			state = EXCLUDED.state,
+			expiredAt = COALESCE(Silence.expiredAt, EXCLUDED.expiredAt)`,
+			silence.ID, silence.CreatedBy, silence.Comment, silence.StartsAt, silence.EndsAt, silence.UpdatedAt, silence.State, alert.SilenceExpired); err != nil {
+			return fmt.Errorf("保存静默规则失败: %w", err)
+		}
+
+		// 静默规则的匹配条件仅能整体替换.
+		if _, err := tx.Exec(ctx, `DELETE FROM SilenceMatcher WHERE SilenceID = $1`, silence.ID); err != nil {
+			return fmt.Errorf("清理静默规则匹配条件失败: %w", err)
+		}
+		for _, m := range silence.Matchers {
+			if _, err := tx.Exec(ctx, `
+			INSERT INTO SilenceMatcher (SilenceID, Name, Value, IsRegex, IsEqual)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT DO NOTHING`, silence.ID, m.Name, m.Value, m.IsRegex, m.IsEqual); err != nil {
+				return fmt.Errorf("保存静默规则匹配条件失败: %w", err)
+			}
+		}
+		return nil
+	})
+}
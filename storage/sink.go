@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+)
+
+// Sink 报警信息的持久化后端, Storage 负责调度, 重试及监控, Sink 负责具体的存储实现.
+// 同一报警(fingerprint, startsAt)多次存储时应更新已存储的报警, 报警不包含 Alertmanager 状态信息时保留已存储的状态.
+type Sink interface {
+	// Save 存储报警信息, 返回成功存储的报警信息, 部分报警存储失败时同时返回错误.
+	Save(ctx context.Context, alerts alert.Alerts) (alert.Alerts, error)
+	// LoadFiring 返回已存储的处于 Firing 状态的报警信息, 用于服务启动时恢复 Buffer.
+	LoadFiring(ctx context.Context) (alert.Alerts, error)
+	// Close 释放 Sink 持有的资源, 可以重复调用.
+	Close() error
+}
+
+// Connector 启动时可能尚未连接的 Sink, 连接成功前 Storage 不存储报警, 报警保留在 Buffer 中.
+// 未实现该接口的 Sink 视为已连接.
+type Connector interface {
+	// Connected 返回连接成功后关闭的通道.
+	Connected() <-chan struct{}
+}
+
+// DeadLetterer 支持死信表的 Sink, 多次存储失败的报警写入死信表后不再重试.
+// 未实现该接口的 Sink 中存储失败的报警会一直按退避时间重试.
+type DeadLetterer interface {
+	DeadLetter(ctx context.Context, a alert.Alert, attempts int, lastErr error) error
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/require"
+)
+
+// testSink 对 Sink 实现执行一致性测试.
+func testSink(t *testing.T, sink Sink) {
+	ctx := context.Background()
+	startsAt := time.Date(2025, 7, 2, 22, 23, 18, 268000000, time.UTC)
+	firing := alert.Alert{
+		Status:       alert.Firing,
+		Labels:       map[string]string{"alertname": "clusterAvailabilityLow", "severity": "INFO"},
+		Annotations:  map[string]string{"summary": "节点可用率低于90%"},
+		StartsAt:     startsAt,
+		GeneratorURL: "/graph",
+		Fingerprint:  "077bf4e884599215",
+		State:        alert.StateSuppressed,
+		SilencedBy:   []string{"silence-1"},
+		Receivers:    []string{"default"},
+		UpdatedAt:    startsAt.Add(time.Minute),
+		Flapping:     true,
+		Transitions:  5,
+	}
+	resolved := alert.Alert{
+		Status:      alert.Resolved,
+		Labels:      map[string]string{"alertname": "MyAlertName"},
+		Annotations: map[string]string{"summary": "Non ephemeral host is DOWN"},
+		StartsAt:    startsAt,
+		EndsAt:      startsAt.Add(5 * time.Minute),
+		Fingerprint: "dd19ae3d4e06ac55",
+	}
+
+	successes, err := sink.Save(ctx, alert.Alerts{firing, resolved})
+	require.NoError(t, err)
+	require.Len(t, successes, 2)
+
+	loaded, err := sink.LoadFiring(ctx)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	if diff := cmp.Diff(firing, loaded[0], cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Errorf("LoadFiring() mismatch (-want +got):\n%s", diff)
+	}
+
+	// webhook 推送的更新不包含状态信息, 保留已存储的状态并合并注释.
+	update := alert.Alert{
+		Status:      alert.Firing,
+		Labels:      firing.Labels,
+		Annotations: map[string]string{"description": "cluster test"},
+		StartsAt:    startsAt,
+		Fingerprint: firing.Fingerprint,
+	}
+	_, err = sink.Save(ctx, alert.Alerts{update})
+	require.NoError(t, err)
+
+	loaded, err = sink.LoadFiring(ctx)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	want := firing
+	want.GeneratorURL = ""
+	want.Flapping, want.Transitions = false, 0
+	want.Annotations = map[string]string{"summary": "节点可用率低于90%", "description": "cluster test"}
+	if diff := cmp.Diff(want, loaded[0], cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Errorf("LoadFiring() after update mismatch (-want +got):\n%s", diff)
+	}
+
+	// 报警恢复后不再作为 Firing 报警加载.
+	update.Status = alert.Resolved
+	update.EndsAt = startsAt.Add(time.Hour)
+	_, err = sink.Save(ctx, alert.Alerts{update})
+	require.NoError(t, err)
+
+	loaded, err = sink.LoadFiring(ctx)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+
+	require.NoError(t, sink.Close())
+}
+
+func TestMemory(t *testing.T) {
+	testSink(t, NewMemory())
+}
+
+func TestMemory_Alerts(t *testing.T) {
+	m := NewMemory()
+	a := alert.Alert{Status: alert.Resolved, Fingerprint: "a", StartsAt: time.Now(), Labels: map[string]string{"alertname": "a"}}
+	b := alert.Alert{Status: alert.Firing, Fingerprint: "b", StartsAt: time.Now(), Labels: map[string]string{"alertname": "b"}}
+	_, err := m.Save(context.Background(), alert.Alerts{b, a})
+	require.NoError(t, err)
+
+	alerts := m.Alerts()
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Fingerprint < alerts[j].Fingerprint })
+	require.Equal(t, []string{"a", "b"}, []string{alerts[0].Fingerprint, alerts[1].Fingerprint})
+
+	// 返回的报警为副本, 修改不影响已存储的报警.
+	alerts[0].Labels["alertname"] = "changed"
+	require.Equal(t, "a", m.alerts[a.Key()].Labels["alertname"])
+}
+
+func TestSQLite(t *testing.T) {
+	sink, err := NewSQLite(filepath.Join(t.TempDir(), "alert2pg.db"), nil)
+	require.NoError(t, err)
+	testSink(t, sink)
+}
+
+func TestSQLite_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alert2pg.db")
+	a := alert.Alert{Status: alert.Firing, Fingerprint: "a", StartsAt: time.Now(), Labels: map[string]string{"alertname": "a"}}
+
+	sink, err := NewSQLite(path, nil)
+	require.NoError(t, err)
+	_, err = sink.Save(context.Background(), alert.Alerts{a})
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	sink, err = NewSQLite(path, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+	loaded, err := sink.LoadFiring(context.Background())
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	require.Equal(t, a.Key(), loaded[0].Key())
+}
+
+// TestSQLite_Upgrade 打开缺少新增字段的数据库时自动补充字段.
+func TestSQLite_Upgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alert2pg.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	require.NoError(t, err)
+	for _, stmt := range sqliteSchema {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	_, err = db.Exec(`INSERT INTO Alert (fingerprint, status, startsAt, labels, annotations) VALUES ('a', 'firing', ?, '{}', '{}')`, sqliteTime(time.Now()))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	sink, err := NewSQLite(path, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+	loaded, err := sink.LoadFiring(context.Background())
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	require.False(t, loaded[0].Flapping)
+
+	loaded[0].Flapping, loaded[0].Transitions = true, 4
+	_, err = sink.Save(context.Background(), loaded)
+	require.NoError(t, err)
+	loaded, err = sink.LoadFiring(context.Background())
+	require.NoError(t, err)
+	require.True(t, loaded[0].Flapping)
+	require.Equal(t, 4, loaded[0].Transitions)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// drainInterval 停止时剩余报警存储失败后的重试间隔.
+const drainInterval = 1 * time.Second
+
+// spill 将停止时仍未存储的报警写入溢出文件, 没有剩余报警时删除上次的溢出文件.
+// 先写入临时文件再重命名, 避免写入中断导致溢出文件损坏.
+func (s *Storage) spill(alerts alert.Alerts) error {
+	path := s.opts().spillFile
+	if path == "" {
+		if len(alerts) > 0 {
+			return fmt.Errorf("未配置溢出文件")
+		}
+		return nil
+	}
+	if len(alerts) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("无法删除溢出文件: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(alerts)
+	if err != nil {
+		return fmt.Errorf("无法序列化报警信息: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("无法创建溢出文件: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("无法写入溢出文件: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("无法写入溢出文件: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("无法写入溢出文件: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("无法写入溢出文件: %w", err)
+	}
+	return nil
+}
+
+// LoadSpill 读取上次停止时写入溢出文件的报警, 文件不存在时返回空.
+// 读取后不删除溢出文件, 报警重新加载到 Buffer 后由下次停止时的存储结果决定删除或覆盖, 避免再次异常退出时丢失.
+func LoadSpill(path string) (alert.Alerts, error) {
+	alerts := make(alert.Alerts, 0)
+	if path == "" {
+		return alerts, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return alerts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取溢出文件: %w", err)
+	}
+	if err := json.Unmarshal(data, &alerts); err != nil {
+		return nil, fmt.Errorf("无效的溢出文件 %s: %w", path, err)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"alert2pg/buffer"
+	"alert2pg/pkg/alert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Spill(t *testing.T) {
+	spillFile := filepath.Join(t.TempDir(), "alert2pg.spill.json")
+	s, err := New(buffer.New(nil), NewMemory(), nil, WithSpillFile(spillFile))
+	require.NoError(t, err)
+
+	// 溢出文件不存在时返回空.
+	spilled, err := LoadSpill(spillFile)
+	require.NoError(t, err)
+	require.Empty(t, spilled)
+
+	a := alert.DefaultAlert()
+	a.Fingerprint = "a"
+	a.Status = alert.Firing
+	a.StartsAt = time.Now().Truncate(time.Second)
+	a.Labels = map[string]string{"alertname": "a"}
+	require.NoError(t, s.spill(alert.Alerts{a}))
+	spilled, err = LoadSpill(spillFile)
+	require.NoError(t, err)
+	require.Len(t, spilled, 1)
+	require.Equal(t, a.Fingerprint, spilled[0].Fingerprint)
+	require.True(t, a.StartsAt.Equal(spilled[0].StartsAt))
+	require.Equal(t, a.Labels, spilled[0].Labels)
+
+	// 没有剩余报警时删除溢出文件.
+	require.NoError(t, s.spill(nil))
+	_, err = os.Stat(spillFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// 溢出文件内容无效时返回错误.
+	require.NoError(t, os.WriteFile(spillFile, []byte("{"), 0o600))
+	_, err = LoadSpill(spillFile)
+	require.Error(t, err)
+}
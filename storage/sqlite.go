@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"alert2pg/pkg/alert"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/log"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema SQLite 表结构, 标签, 注释及 Alertmanager 状态信息以 JSON 文本存储, 时间以 RFC3339 格式存储.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS Alert (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		fingerprint  TEXT NOT NULL,
+		status       TEXT NOT NULL,
+		startsAt     TEXT NOT NULL,
+		endsAt       TEXT,
+		generatorURL TEXT,
+		state        TEXT,
+		silencedBy   TEXT,
+		inhibitedBy  TEXT,
+		receivers    TEXT,
+		updatedAt    TEXT,
+		labels       TEXT NOT NULL,
+		annotations  TEXT NOT NULL,
+		UNIQUE (fingerprint, startsAt)
+	)`,
+	`CREATE INDEX IF NOT EXISTS alert_status_idx ON Alert (status)`,
+}
+
+// sqliteColumns 在 Alert 表创建之后新增的字段, 打开已有数据库时补充缺少的字段.
+var sqliteColumns = []struct {
+	name       string
+	definition string
+}{
+	{name: "flapping", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "transitions", definition: "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// SQLite 基于 SQLite 的 Sink 实现, 适用于单机部署或无 PostgreSQL 的开发测试环境.
+type SQLite struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+// NewSQLite 打开 path 指定的 SQLite 数据库并初始化表结构, path 为 :memory: 时使用内存数据库.
+func NewSQLite(path string, logger log.Logger) (*SQLite, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SQLite 数据库路径不能为空")
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+url.Values{"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)"}}.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 SQLite 数据库: %w", err)
+	}
+	// SQLite 同一时间仅允许一个写入者, 使用单个连接避免锁冲突, 同时保证内存数据库在连接间共享.
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, stmt := range sqliteSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("无法初始化 SQLite 表结构: %w", err)
+		}
+	}
+	for _, column := range sqliteColumns {
+		var exists bool
+		if err := db.QueryRowContext(ctx, `SELECT count(*) > 0 FROM pragma_table_info('Alert') WHERE name = ?`, column.name).Scan(&exists); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("无法查询 SQLite 表结构: %w", err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE Alert ADD COLUMN %s %s`, column.name, column.definition)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("无法升级 SQLite 表结构: %w", err)
+		}
+	}
+	return &SQLite{db: db, logger: logger}, nil
+}
+
+// Save 逐条存储报警信息, 返回成功存储的报警信息, 存储失败的报警错误合并返回.
+func (s *SQLite) Save(ctx context.Context, alerts alert.Alerts) (alert.Alerts, error) {
+	successes := make(alert.Alerts, 0, len(alerts))
+	var errs []error
+	for _, a := range alerts {
+		if err := s.save(ctx, a); err != nil {
+			errs = append(errs, fmt.Errorf("保存报警 %s 失败: %w", a.Key(), err))
+			continue
+		}
+		successes = append(successes, a)
+	}
+	return successes, errors.Join(errs...)
+}
+
+// save 插入或更新一条报警信息, 与 PostgreSQL 实现保持一致: 标签不更新, 注释合并, 不含状态信息时保留已有状态.
+func (s *SQLite) save(ctx context.Context, a alert.Alert) error {
+	labels, err := json.Marshal(nonNilMap(a.Labels))
+	if err != nil {
+		return err
+	}
+	annotations, err := json.Marshal(nonNilMap(a.Annotations))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+	INSERT INTO Alert (fingerprint, status, startsAt, endsAt, generatorURL, state, silencedBy, inhibitedBy, receivers, updatedAt, labels, annotations, flapping, transitions)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (fingerprint, startsAt) DO UPDATE SET
+		status = excluded.status,
+		endsAt = excluded.endsAt,
+		generatorURL = excluded.generatorURL,
+		state = COALESCE(excluded.state, Alert.state),
+		silencedBy = CASE WHEN excluded.state IS NULL THEN Alert.silencedBy ELSE excluded.silencedBy END,
+		inhibitedBy = CASE WHEN excluded.state IS NULL THEN Alert.inhibitedBy ELSE excluded.inhibitedBy END,
+		receivers = CASE WHEN excluded.state IS NULL THEN Alert.receivers ELSE excluded.receivers END,
+		updatedAt = COALESCE(excluded.updatedAt, Alert.updatedAt),
+		annotations = json_patch(Alert.annotations, excluded.annotations),
+		flapping = excluded.flapping,
+		transitions = excluded.transitions`,
+		a.Fingerprint, a.Status, sqliteTime(a.StartsAt), sqliteNullTime(a.EndsAt), a.GeneratorURL,
+		nullString(a.State), sqliteJSON(a.SilencedBy), sqliteJSON(a.InhibitedBy), sqliteJSON(a.Receivers), sqliteNullTime(a.UpdatedAt),
+		string(labels), string(annotations), a.Flapping, a.Transitions)
+	return err
+}
+
+// LoadFiring 返回数据库中处于 Firing 状态的报警信息.
+func (s *SQLite) LoadFiring(ctx context.Context) (alert.Alerts, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT fingerprint, status, startsAt, endsAt, COALESCE(generatorURL, ''), COALESCE(state, ''),
+		silencedBy, inhibitedBy, receivers, updatedAt, labels, annotations, flapping, transitions
+	FROM Alert WHERE status = 'firing'`)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询 Firing 报警: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := make(alert.Alerts, 0)
+	for rows.Next() {
+		var a alert.Alert
+		var startsAt string
+		var endsAt, silencedBy, inhibitedBy, receivers, updatedAt sql.NullString
+		var labels, annotations string
+		if err := rows.Scan(&a.Fingerprint, &a.Status, &startsAt, &endsAt, &a.GeneratorURL, &a.State,
+			&silencedBy, &inhibitedBy, &receivers, &updatedAt, &labels, &annotations, &a.Flapping, &a.Transitions); err != nil {
+			return nil, fmt.Errorf("无法读取 Firing 报警: %w", err)
+		}
+		if a.StartsAt, err = time.Parse(time.RFC3339Nano, startsAt); err != nil {
+			return nil, fmt.Errorf("无法解析报警开始时间: %w", err)
+		}
+		for _, t := range []struct {
+			src sql.NullString
+			dst *time.Time
+		}{{endsAt, &a.EndsAt}, {updatedAt, &a.UpdatedAt}} {
+			if !t.src.Valid {
+				continue
+			}
+			if *t.dst, err = time.Parse(time.RFC3339Nano, t.src.String); err != nil {
+				return nil, fmt.Errorf("无法解析报警时间: %w", err)
+			}
+		}
+		for _, v := range []struct {
+			src string
+			dst any
+		}{{silencedBy.String, &a.SilencedBy}, {inhibitedBy.String, &a.InhibitedBy}, {receivers.String, &a.Receivers}, {labels, &a.Labels}, {annotations, &a.Annotations}} {
+			if v.src == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(v.src), v.dst); err != nil {
+				return nil, fmt.Errorf("无法解析报警信息: %w", err)
+			}
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("无法读取 Firing 报警: %w", err)
+	}
+	return alerts, nil
+}
+
+// Close 关闭数据库.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// sqliteTime 将时间转换为 UTC 的 RFC3339 格式, 保证同一时间的文本表示唯一.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// sqliteNullTime 将零值时间转换为数据库中的 NULL.
+func sqliteNullTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	v := sqliteTime(t)
+	return &v
+}
+
+// sqliteJSON 将字符串数组转换为 JSON 文本, 空数组转换为数据库中的 NULL.
+func sqliteJSON(v []string) *string {
+	if len(v) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(v)
+	s := string(b)
+	return &s
+}
+
+// nonNilMap 将 nil 转换为空 map, 保证序列化结果为 {}.
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
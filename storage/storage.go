@@ -1,4 +1,4 @@
-// Package storage 负责将 Buffer 中的报警数据高效的持久化到数据库中.
+// Package storage 负责将 Buffer 中的报警数据高效的持久化到数据库中, 具体的存储后端由 Sink 实现.
 package storage
 
 import (
@@ -6,35 +6,54 @@ import (
 	"alert2pg/pkg/alert"
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// loadTimeout 启动时读取已存储的 Firing 报警的超时时间.
+	loadTimeout = 30 * time.Second
+	// loadInterval 读取 Firing 报警失败后的重试间隔.
+	loadInterval = 5 * time.Second
 )
 
 type Storage struct {
 	buffer *buffer.Buffer
+	sink   Sink
+
+	retry *retryQueue
 
-	pool *pgxpool.Pool
+	// 存储后端已连接并加载 Firing 报警到 Buffer 中.
+	ready atomic.Bool
 
 	done   chan struct{}
 	ctx    context.Context
 	cancel func()
 
+	// options 可由 Reload 在运行时修改.
+	optionsMu                          sync.RWMutex
 	options                            Options
 	logger                             log.Logger
 	unloadAlertsGauge                  prometheus.Gauge
 	successStorageCounter              prometheus.Counter
 	failedStorageCounter               prometheus.Counter
+	retryAlertsGauge                   prometheus.Gauge
+	deadLetterCounter                  prometheus.Counter
+	readyGauge                         prometheus.Gauge
 	storageAlertBatchDurationHistogram prometheus.Histogram
 	storageAlertDurationHistogram      prometheus.Histogram
 }
 
-func New(buffer *buffer.Buffer, logger log.Logger, opts ...optionFunc) (*Storage, error) {
-	ctx, cancel := context.WithCancel(context.Background())
+func New(buffer *buffer.Buffer, sink Sink, logger log.Logger, opts ...optionFunc) (*Storage, error) {
+	if sink == nil {
+		return nil, fmt.Errorf("空指针: sink")
+	}
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
@@ -44,21 +63,11 @@ func New(buffer *buffer.Buffer, logger log.Logger, opts ...optionFunc) (*Storage
 		opt(&options)
 	}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), &options.cfg)
-	if err != nil {
-		return nil, fmt.Errorf("无法创建连接池: %w", err)
-	}
-	{
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
-		if err := pool.Ping(ctx); err != nil {
-			return nil, fmt.Errorf("无法连接数据库: %w", err)
-		}
-	}
-
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Storage{
 		buffer:                buffer,
-		pool:                  pool,
+		sink:                  sink,
+		retry:                 newRetryQueue(options.maxAttempts, options.initialBackoff, options.maxBackoff),
 		done:                  make(chan struct{}),
 		ctx:                   ctx,
 		cancel:                cancel,
@@ -67,6 +76,9 @@ func New(buffer *buffer.Buffer, logger log.Logger, opts ...optionFunc) (*Storage
 		unloadAlertsGauge:     prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "storage", Name: "unload_alerts_total", Help: "Total number of unloaded alerts"}),
 		successStorageCounter: prometheus.NewCounter(prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "storage", Name: "success_alerts_total", Help: "Total number of successful alerts"}),
 		failedStorageCounter:  prometheus.NewCounter(prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "storage", Name: "failed_alerts_total", Help: "Total number of failed alerts"}),
+		retryAlertsGauge:      prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "storage", Name: "retry_alerts", Help: "Number of alerts waiting for retry"}),
+		deadLetterCounter:     prometheus.NewCounter(prometheus.CounterOpts{Namespace: "alert2pg", Subsystem: "storage", Name: "dead_letter_alerts_total", Help: "Total number of alerts moved to the dead letter table"}),
+		readyGauge:            prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "alert2pg", Subsystem: "storage", Name: "ready", Help: "Whether the storage backend is connected and firing alerts are loaded"}),
 		storageAlertBatchDurationHistogram: prometheus.NewHistogram(prometheus.HistogramOpts{
 			Namespace: "alert2pg",
 			Subsystem: "storage",
@@ -84,156 +96,289 @@ func New(buffer *buffer.Buffer, logger log.Logger, opts ...optionFunc) (*Storage
 	}, nil
 }
 
+// Reload 在运行时修改存储配置, 仅超时时间, 并发数量及最小批次间隔生效, 下一批次存储时使用新的配置.
+func (s *Storage) Reload(opts ...optionFunc) {
+	s.optionsMu.Lock()
+	defer s.optionsMu.Unlock()
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+}
+
+// opts 返回当前配置.
+func (s *Storage) opts() Options {
+	s.optionsMu.RLock()
+	defer s.optionsMu.RUnlock()
+	return s.options
+}
+
+// LoadFiring 从 Sink 中读取 Firing 报警, 用于服务启动时恢复 Buffer.
+func (s *Storage) LoadFiring(ctx context.Context) (alert.Alerts, error) {
+	return s.sink.LoadFiring(ctx)
+}
+
+// Ready 返回存储后端是否已连接并完成 Firing 报警的加载, 未就绪时报警保留在 Buffer 中.
+func (s *Storage) Ready() bool {
+	return s.ready.Load()
+}
+
+// connected 返回存储后端是否已连接.
+func (s *Storage) connected() bool {
+	c, ok := s.sink.(Connector)
+	if !ok {
+		return true
+	}
+	select {
+	case <-c.Connected():
+		return true
+	default:
+		return false
+	}
+}
+
+// start 等待存储后端连接成功后将已存储的 Firing 报警加载到 Buffer 中, 加载失败时按 loadInterval 重试.
+// Buffer 中已存在的报警比数据库中的报警更新, 加载时不覆盖. Storage 停止时返回 false.
+func (s *Storage) start() bool {
+	if c, ok := s.sink.(Connector); ok {
+		select {
+		case <-c.Connected():
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+	for {
+		ctx, cancel := context.WithTimeout(s.ctx, loadTimeout)
+		alerts, err := s.sink.LoadFiring(ctx)
+		cancel()
+		if err == nil {
+			s.buffer.Load(alerts)
+			s.ready.Store(true)
+			s.readyGauge.Set(1)
+			level.Info(s.logger).Log("详情", "已加载数据库中的 firing 报警", "数量", len(alerts))
+			return true
+		}
+		level.Error(s.logger).Log("详情", "无法读取数据库中的 firing 报警, 稍后重试", "错误详情", err)
+		select {
+		case <-time.After(loadInterval):
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+}
+
+// Run 等待存储后端就绪后, 在 Buffer 中出现未存储的报警或到达重试时间时存储报警, 两次存储间隔不小于 minBatchInterval.
 func (s *Storage) Run() {
-	defer func() {
-		close(s.done)
-	}()
+	defer close(s.done)
+
+	if !s.start() {
+		return
+	}
 
+	// 启动时立即存储一次, 存储从溢出文件恢复的报警.
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	var last time.Time
 	for {
 		select {
+		case <-s.buffer.Unloaded():
+		case <-retry.C:
 		case <-s.ctx.Done():
 			return
-		default:
+		}
+		// 等待期间的报警变更合并到同一批次.
+		if wait := s.opts().minBatchInterval - time.Since(last); wait > 0 {
 			select {
+			case <-time.After(wait):
 			case <-s.ctx.Done():
 				return
-			default:
 			}
 		}
-		start := time.Now()
-		alerts := s.buffer.GetUnloads()
-		s.unloadAlertsGauge.Set(float64(len(alerts)))
-		successes := s.Save(alerts)
-		s.buffer.SetLoads(successes)
-		s.storageAlertDurationHistogram.Observe(time.Since(start).Seconds())
-		time.Sleep(1 * time.Second)
+		last = time.Now()
+		s.flush(last)
+		if next := s.retry.next(); !next.IsZero() {
+			retry.Reset(time.Until(next))
+		} else {
+			retry.Stop()
+		}
 	}
 }
 
-func (s *Storage) Stop() {
-	s.cancel()
-	<-s.done
-	// 退出前完成一次存储.
-	start := time.Now()
+// flush 存储 Buffer 中未存储且已到达重试时间的报警.
+func (s *Storage) flush(now time.Time) {
 	alerts := s.buffer.GetUnloads()
 	s.unloadAlertsGauge.Set(float64(len(alerts)))
-	successes := s.Save(alerts)
+	successes := s.store(s.ctx, s.retry.due(alerts, now))
 	s.buffer.SetLoads(successes)
-	s.storageAlertDurationHistogram.Observe(time.Since(start).Seconds())
-	s.pool.Close()
-}
-
-// Save 将报警信息持久化到数据库中, 返回成功持久化到数据库中的报警信息.
-func (s *Storage) Save(alerts alert.Alerts) alert.Alerts {
-	successAlerts := make(alert.Alerts, 0)
-	intermediate := make(chan alert.Alert)
-	successesChan := make(chan alert.Alert)
-	errChan := make(chan error)
-	for i := 0; i < s.options.parallelism; i++ {
-		go func() {
-			for a := range intermediate {
-				start := time.Now()
-				if err := s.save(a); err != nil {
-					level.Error(s.logger).Log("详情", "无法保存报警信息", "fingerprint", a.Fingerprint, "startsAt", a.StartsAt, "错误详情", err)
-					errChan <- err
-				} else {
-					successesChan <- a
-				}
-				s.storageAlertDurationHistogram.Observe(time.Since(start).Seconds())
-			}
-		}()
+	s.retryAlertsGauge.Set(float64(s.retry.len()))
+	s.storageAlertBatchDurationHistogram.Observe(time.Since(now).Seconds())
+}
+
+// Stop 停止存储任务, 在 drainTimeout 内完成剩余报警的存储.
+func (s *Storage) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts().drainTimeout)
+	defer cancel()
+	s.Shutdown(ctx)
+}
+
+// Shutdown 停止存储任务, 在 ctx 结束前持续存储 Buffer 中未存储的报警, 存储失败时按 drainInterval 重试.
+// 仍未存储的报警写入溢出文件, 全部存储成功时删除上次的溢出文件. 最后关闭存储后端.
+// 存储后端尚未连接时不再尝试存储, 直接写入溢出文件.
+func (s *Storage) Shutdown(ctx context.Context) {
+	s.cancel()
+	<-s.done
+
+	flushed := 0
+	if s.connected() {
+		flushed = s.drain(ctx)
 	}
 
-	for range len(alerts) {
+	remaining := s.buffer.GetUnloads()
+	if err := s.spill(remaining); err != nil {
+		level.Error(s.logger).Log("详情", "无法写入溢出文件, 未存储的报警将丢失", "文件", s.opts().spillFile, "数量", len(remaining), "错误详情", err)
+	}
+	level.Info(s.logger).Log("详情", "storage 服务已停止", "已存储", flushed, "已溢出", len(remaining))
+
+	if err := s.sink.Close(); err != nil {
+		level.Error(s.logger).Log("详情", "无法关闭存储后端", "错误详情", err)
+	}
+}
+
+// drain 在 ctx 结束前持续存储 Buffer 中未存储的报警, 返回存储成功的报警数量.
+func (s *Storage) drain(ctx context.Context) int {
+	flushed := 0
+	for {
+		alerts := s.buffer.GetUnloads()
+		s.unloadAlertsGauge.Set(float64(len(alerts)))
+		if len(alerts) == 0 {
+			return flushed
+		}
+		start := time.Now()
+		successes := s.store(ctx, alerts)
+		s.buffer.SetLoads(successes)
+		s.storageAlertBatchDurationHistogram.Observe(time.Since(start).Seconds())
+		flushed += len(successes)
+		if len(successes) == len(alerts) {
+			continue
+		}
 		select {
-		case a := <-successesChan:
-			s.successStorageCounter.Inc()
-			successAlerts = append(successAlerts, a)
-		case <-errChan:
-			s.failedStorageCounter.Inc()
+		case <-time.After(drainInterval):
+		case <-ctx.Done():
+			return flushed
 		}
 	}
+}
 
-	return successAlerts
+// Result 一条报警的存储结果.
+type Result struct {
+	Alert alert.Alert
+	// Err 为 nil 时存储成功.
+	Err error
+	// Retryable 存储失败的原因是否为暂时性错误, 暂时性错误会一直重试, 永久性错误达到最大尝试次数后写入死信表.
+	Retryable bool
 }
 
-// save 将一条报警信息存储到数据库中.
-func (s *Storage) save(a alert.Alert) error {
-	ctx, cancel := context.WithTimeout(s.ctx, s.options.timeout)
-	defer cancel()
+// Save 使用至多 parallelism 个协程将报警信息持久化到 Sink 中, 按传入顺序返回每条报警的存储结果.
+// 存储每条报警的超时时间不超过 ctx 的截止时间, ctx 结束后未开始存储的报警直接返回 ctx 的错误.
+func (s *Storage) Save(ctx context.Context, alerts alert.Alerts) []Result {
+	results := make([]Result, len(alerts))
+	parallelism := s.opts().parallelism
+	if parallelism <= 0 {
+		parallelism = defaultOptions.parallelism
+	}
 
-	conn, err := s.pool.Acquire(ctx)
-	if err != nil {
-		level.Error(s.logger).Log("详情", "无法从连接池中获取数据库连接", "错误详情", err)
-		return fmt.Errorf("无法从连接池中获取数据库连接: %w", err)
-	}
-	defer conn.Release()
-
-	// 开启事务
-	tx, err := conn.Begin(ctx)
-	if err != nil {
-		level.Error(s.logger).Log("详情", "无法开始事务", "错误详情", err)
-		return fmt.Errorf("无法开始事务: %w", err)
-	}
-	defer func() {
-		// 用 Background 确保最大可能地回滚
-		_ = tx.Rollback(context.Background())
-	}()
-
-	// 保存整体逻辑
-	// 首先检查 Alert 表中是否存在该条报警信息.
-	// 若存在则为更新, 更新只需要更新 alert, alertannotation 表即可.
-	// 若不存在则为插入.
-	id := -1
-	if err := tx.QueryRow(ctx, `SELECT id FROM Alert WHERE fingerprint = $1 AND startsAt = $2`, a.Fingerprint, a.StartsAt).Scan(&id); err != nil {
-		if err != pgx.ErrNoRows {
-			level.Error(s.logger).Log("详情", "无法查询 Alert 表中的报警 ID", "fingerprint", a.Fingerprint, "startsAt", a.StartsAt, "错误详情", err)
-			return fmt.Errorf("查询 Alert 表中的报警 ID 失败: %w", err)
+	var g errgroup.Group
+	g.SetLimit(parallelism)
+	for i, a := range alerts {
+		results[i].Alert = a
+		if err := ctx.Err(); err != nil {
+			results[i].Err, results[i].Retryable = err, true
+			continue
 		}
+		g.Go(func() error {
+			start := time.Now()
+			err := s.save(ctx, a)
+			s.storageAlertDurationHistogram.Observe(time.Since(start).Seconds())
+			results[i].Err, results[i].Retryable = err, isRetryable(err)
+			return nil
+		})
 	}
+	g.Wait()
+	return results
+}
 
-	if id == -1 {
-		// 插入新的报警信息
-		if err := tx.QueryRow(ctx, `
-	INSERT INTO Alert (fingerprint, status, startsAt, endsAt, generatorURL)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id`, a.Fingerprint, a.Status, a.StartsAt, a.EndsAt, a.GeneratorURL).Scan(&id); err != nil {
-			level.Error(s.logger).Log("详情", "无法在 Alert 表中插入报警信息", "错误详情", err)
-			return fmt.Errorf("保存报警数据失败: %w", err)
+// store 存储报警信息并记录重试状态, 返回成功持久化的报警信息.
+// 多次存储失败并写入死信表的报警同样视为已持久化, 不再重试.
+func (s *Storage) store(ctx context.Context, alerts alert.Alerts) alert.Alerts {
+	successAlerts := make(alert.Alerts, 0, len(alerts))
+	for _, r := range s.Save(ctx, alerts) {
+		if r.Err == nil {
+			s.successStorageCounter.Inc()
+			s.retry.succeeded(r.Alert)
+			successAlerts = append(successAlerts, r.Alert)
+			continue
 		}
 
-		for k, v := range a.Labels {
-			if _, err := tx.Exec(ctx, `INSERT INTO AlertLabel (AlertID, Label, Value)
-			VALUES ($1, $2, $3)`, id, k, v); err != nil {
-				level.Error(s.logger).Log("详情", "无法插入 AlertLabel 表中的标签", "key", k, "错误详情", err)
-				return fmt.Errorf("保存报警标签数据失败: %w", err)
-			}
+		s.failedStorageCounter.Inc()
+		state, dead := s.retry.failed(r.Alert, r.Err, time.Now())
+		if !dead {
+			level.Error(s.logger).Log("详情", "无法保存报警信息", "fingerprint", r.Alert.Fingerprint, "startsAt", r.Alert.StartsAt,
+				"尝试次数", state.attempts, "下次重试", state.nextAttempt, "暂时性错误", r.Retryable, "错误详情", r.Err)
+			continue
 		}
-	} else {
-		// 更新现有报警信息
-		if _, err := tx.Exec(ctx, `UPDATE Alert SET status = $1, endsAt = $2, generatorURL = $3 WHERE fingerprint = $4 and startsat = $5 `, a.Status, a.EndsAt, a.GeneratorURL, a.Fingerprint, a.StartsAt); err != nil {
-			level.Error(s.logger).Log("详情", "无法更新 Alert 表中的报警信息", "fingerprint", a.Fingerprint, "startsAt", a.StartsAt, "错误详情", err)
-			return fmt.Errorf("更新 Alert 表中的报警信息失败: %w", err)
+		letterer, ok := s.sink.(DeadLetterer)
+		if !ok {
+			level.Error(s.logger).Log("详情", "无法保存报警信息, 存储后端不支持死信表, 将继续重试", "fingerprint", r.Alert.Fingerprint, "startsAt", r.Alert.StartsAt,
+				"尝试次数", state.attempts, "错误详情", r.Err)
+			continue
 		}
-	}
-
-	for k, v := range a.Annotations {
-		_, err := tx.Exec(ctx, `
-		INSERT INTO AlertAnnotation (AlertID, Annotation, Value)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (AlertID, Annotation) DO UPDATE
-		SET Value = EXCLUDED.Value`,
-			id, k, v)
-		if err != nil {
-			level.Error(s.logger).Log("详情", "无法插入或更新注释", "key", k, "错误详情", err)
-			return fmt.Errorf("保存报警数据失败: %w", err)
+		if err := s.deadLetter(ctx, letterer, r.Alert, state); err != nil {
+			level.Error(s.logger).Log("详情", "无法写入死信表", "fingerprint", r.Alert.Fingerprint, "startsAt", r.Alert.StartsAt, "错误详情", err)
+			continue
 		}
+		s.deadLetterCounter.Inc()
+		s.retry.succeeded(r.Alert)
+		successAlerts = append(successAlerts, r.Alert)
 	}
+	return successAlerts
+}
 
-	// 提交事务
-	if err := tx.Commit(context.Background()); err != nil {
-		level.Error(s.logger).Log("详情", "无法提交事务", "错误详情", err)
-		return fmt.Errorf("无法提交事务: %w", err)
-	}
-	return nil
+// save 将一条报警信息存储到 Sink 中.
+func (s *Storage) save(ctx context.Context, a alert.Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, s.opts().timeout)
+	defer cancel()
+
+	_, err := s.sink.Save(ctx, alert.Alerts{a})
+	return err
+}
+
+// deadLetter 将多次存储失败的报警写入死信表.
+func (s *Storage) deadLetter(ctx context.Context, letterer DeadLetterer, a alert.Alert, state retryState) error {
+	ctx, cancel := context.WithTimeout(ctx, s.opts().timeout)
+	defer cancel()
+
+	return letterer.DeadLetter(ctx, a, state.attempts, state.lastErr)
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (s *Storage) Describe(ch chan<- *prometheus.Desc) {
+	s.unloadAlertsGauge.Describe(ch)
+	s.successStorageCounter.Describe(ch)
+	s.failedStorageCounter.Describe(ch)
+	s.retryAlertsGauge.Describe(ch)
+	s.deadLetterCounter.Describe(ch)
+	s.readyGauge.Describe(ch)
+	s.storageAlertBatchDurationHistogram.Describe(ch)
+	s.storageAlertDurationHistogram.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (s *Storage) Collect(ch chan<- prometheus.Metric) {
+	s.unloadAlertsGauge.Collect(ch)
+	s.successStorageCounter.Collect(ch)
+	s.failedStorageCounter.Collect(ch)
+	s.retryAlertsGauge.Collect(ch)
+	s.deadLetterCounter.Collect(ch)
+	s.readyGauge.Collect(ch)
+	s.storageAlertBatchDurationHistogram.Collect(ch)
+	s.storageAlertDurationHistogram.Collect(ch)
 }
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"alert2pg/buffer"
+	"alert2pg/pkg/alert"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// slowSink 记录并发存储数量, 每次存储耗时 delay.
+type slowSink struct {
+	*Memory
+	delay    time.Duration
+	inflight atomic.Int32
+	max      atomic.Int32
+}
+
+func (s *slowSink) Save(ctx context.Context, alerts alert.Alerts) (alert.Alerts, error) {
+	n := s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	for {
+		m := s.max.Load()
+		if n <= m || s.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.Memory.Save(ctx, alerts)
+}
+
+// connectorSink 在 connected 关闭前处于未连接状态.
+type connectorSink struct {
+	*Memory
+	connected chan struct{}
+}
+
+func (s *connectorSink) Connected() <-chan struct{} {
+	return s.connected
+}
+
+func newTestAlert(fingerprint string) alert.Alert {
+	a := alert.DefaultAlert()
+	a.Fingerprint = fingerprint
+	a.Status = alert.Firing
+	a.StartsAt = time.Now().Truncate(time.Second)
+	a.Labels = map[string]string{"alertname": fingerprint}
+	return a
+}
+
+// sampleCount 返回 Storage 中名为 name 的直方图的样本数量.
+func sampleCount(t *testing.T, s *Storage, name string) uint64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(s))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	t.Fatalf("未找到指标 %s", name)
+	return 0
+}
+
+func TestStorage_Save(t *testing.T) {
+	sink := &slowSink{Memory: NewMemory(), delay: 10 * time.Millisecond}
+	sink.fail = func(a alert.Alert) error {
+		switch a.Fingerprint {
+		case "a3":
+			return fmt.Errorf("连接已关闭: %w", net.ErrClosed)
+		case "a5":
+			return &pgconn.PgError{Code: "23505"}
+		}
+		return nil
+	}
+	s, err := New(buffer.New(nil), sink, nil, WithParallelism(3))
+	require.NoError(t, err)
+
+	alerts := make(alert.Alerts, 0, 10)
+	for i := range 10 {
+		alerts = append(alerts, newTestAlert(fmt.Sprintf("a%d", i)))
+	}
+	results := s.Save(context.Background(), alerts)
+	require.Len(t, results, 10)
+	for i, r := range results {
+		require.Equal(t, alerts[i].Fingerprint, r.Alert.Fingerprint)
+		switch r.Alert.Fingerprint {
+		case "a3":
+			require.Error(t, r.Err)
+			require.True(t, r.Retryable)
+		case "a5":
+			require.Error(t, r.Err)
+			require.False(t, r.Retryable)
+		default:
+			require.NoError(t, r.Err)
+		}
+	}
+	require.Len(t, sink.Alerts(), 8)
+	require.Equal(t, int32(3), sink.max.Load())
+	require.Zero(t, sink.inflight.Load())
+}
+
+func TestStorage_SaveCanceled(t *testing.T) {
+	sink := &slowSink{Memory: NewMemory(), delay: time.Second}
+	// 未设置并发数量时使用默认值.
+	s, err := New(buffer.New(nil), sink, nil)
+	require.NoError(t, err)
+
+	alerts := make(alert.Alerts, 0, 10)
+	for i := range 10 {
+		alerts = append(alerts, newTestAlert(fmt.Sprintf("a%d", i)))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results := s.Save(ctx, alerts)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	for _, r := range results {
+		require.ErrorIs(t, r.Err, context.DeadlineExceeded)
+		require.True(t, r.Retryable)
+	}
+	require.Equal(t, int32(defaultOptions.parallelism), sink.max.Load())
+	require.Empty(t, sink.Alerts())
+}
+
+func TestStorage_Run(t *testing.T) {
+	b := buffer.New(nil)
+	sink := NewMemory()
+	s, err := New(b, sink, nil, WithParallelism(2), WithRetry(5, 20*time.Millisecond, 20*time.Millisecond))
+	require.NoError(t, err)
+	go s.Run()
+	defer s.Stop()
+
+	// Buffer 中出现未存储的报警时立即存储, 不等待轮询.
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newTestAlert("a")}))
+	require.Eventually(t, func() bool {
+		return len(sink.Alerts()) == 1
+	}, 200*time.Millisecond, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return len(b.GetUnloads()) == 0
+	}, 200*time.Millisecond, 5*time.Millisecond)
+
+	// 存储失败的报警按退避时间重试.
+	var failures atomic.Int32
+	sink.mu.Lock()
+	sink.fail = func(alert.Alert) error {
+		if failures.Add(1) == 1 {
+			return errors.New("数据库不可用")
+		}
+		return nil
+	}
+	sink.mu.Unlock()
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newTestAlert("b")}))
+	require.Eventually(t, func() bool {
+		return len(sink.Alerts()) == 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestStorage_FlushMetrics(t *testing.T) {
+	b := buffer.New(nil)
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newTestAlert("a"), newTestAlert("b")}))
+	sink := NewMemory()
+	s, err := New(b, sink, nil, WithParallelism(2))
+	require.NoError(t, err)
+
+	// 每次存储记录一次批次耗时, 每条报警记录一次存储耗时.
+	s.flush(time.Now())
+	require.Len(t, sink.Alerts(), 2)
+	require.Equal(t, uint64(1), sampleCount(t, s, "alert2pg_storage_alert_batch_duration_seconds"))
+	require.Equal(t, uint64(2), sampleCount(t, s, "alert2pg_storage_alert_duration_seconds"))
+}
+
+func TestStorage_Degraded(t *testing.T) {
+	b := buffer.New(nil)
+	sink := &connectorSink{Memory: NewMemory(), connected: make(chan struct{})}
+	_, err := sink.Save(context.Background(), alert.Alerts{newTestAlert("stored")})
+	require.NoError(t, err)
+	s, err := New(b, sink, nil)
+	require.NoError(t, err)
+	go s.Run()
+	defer s.Stop()
+
+	// 未连接时报警保留在 Buffer 中.
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newTestAlert("a")}))
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, s.Ready())
+	require.Len(t, sink.Alerts(), 1)
+	require.Len(t, b.GetUnloads(), 1)
+
+	// 连接成功后加载已存储的 Firing 报警并存储 Buffer 中的报警.
+	close(sink.connected)
+	require.Eventually(t, func() bool {
+		return s.Ready() && len(sink.Alerts()) == 2
+	}, time.Second, 5*time.Millisecond)
+	require.Len(t, b.DeepCopy(), 2)
+}
+
+func TestStorage_ShutdownDisconnected(t *testing.T) {
+	spillFile := filepath.Join(t.TempDir(), "alert2pg.spill.json")
+
+	// 存储后端未连接时不等待截止时间, 直接写入溢出文件.
+	b := buffer.New(nil)
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newTestAlert("a")}))
+	sink := &connectorSink{Memory: NewMemory(), connected: make(chan struct{})}
+	s, err := New(b, sink, nil, WithSpillFile(spillFile))
+	require.NoError(t, err)
+	go s.Run()
+	start := time.Now()
+	s.Stop()
+	require.Less(t, time.Since(start), time.Second)
+	require.Empty(t, sink.Alerts())
+
+	spilled, err := LoadSpill(spillFile)
+	require.NoError(t, err)
+	require.Len(t, spilled, 1)
+}
+
+func TestStorage_DrainMetrics(t *testing.T) {
+	b := buffer.New(nil)
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newTestAlert("a"), newTestAlert("b"), newTestAlert("c")}))
+	s, err := New(b, NewMemory(), nil, WithParallelism(2))
+	require.NoError(t, err)
+
+	// 每批报警记录一次批次耗时, 每条报警记录一次存储耗时.
+	require.Equal(t, 3, s.drain(context.Background()))
+	require.Equal(t, uint64(1), sampleCount(t, s, "alert2pg_storage_alert_batch_duration_seconds"))
+	require.Equal(t, uint64(3), sampleCount(t, s, "alert2pg_storage_alert_duration_seconds"))
+}
+
+func TestStorage_ShutdownSpill(t *testing.T) {
+	spillFile := filepath.Join(t.TempDir(), "alert2pg.spill.json")
+
+	// 存储后端不可用时, 截止时间后未存储的报警写入溢出文件.
+	b := buffer.New(nil)
+	require.NoError(t, b.Update(context.Background(), alert.Alerts{newTestAlert("a"), newTestAlert("b")}))
+	sink := NewMemory()
+	sink.fail = func(alert.Alert) error { return errors.New("数据库不可用") }
+	s, err := New(b, sink, nil, WithParallelism(2), WithSpillFile(spillFile))
+	require.NoError(t, err)
+	go s.Run()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.Shutdown(ctx)
+	require.Empty(t, sink.Alerts())
+
+	spilled, err := LoadSpill(spillFile)
+	require.NoError(t, err)
+	require.Len(t, spilled, 2)
+
+	// 下次启动时重新加载溢出的报警, 全部存储后删除溢出文件.
+	b = buffer.New(nil)
+	b.Restore(spilled)
+	sink = NewMemory()
+	s, err = New(b, sink, nil, WithParallelism(2), WithSpillFile(spillFile))
+	require.NoError(t, err)
+	go s.Run()
+	s.Stop()
+	require.Len(t, sink.Alerts(), 2)
+	require.Empty(t, b.GetUnloads())
+	spilled, err = LoadSpill(spillFile)
+	require.NoError(t, err)
+	require.Empty(t, spilled)
+}
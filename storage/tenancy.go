@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"alert2pg/pkg/tenant"
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+)
+
+// tenantSetting 行级安全策略使用的会话参数, 值为当前租户, "*" 表示可访问全部租户.
+// 其他数据库用户(如 Grafana)可通过 SET alert2pg.tenant = '<租户>' 仅查询该租户的报警.
+const tenantSetting = "alert2pg.tenant"
+
+// tenantPolicies 各表的租户行级安全策略: 包含 tenant 字段的表按租户过滤,
+// 子表通过 Alert 表的行级安全策略判断报警是否可见.
+var tenantPolicies = []struct {
+	table  string
+	policy string
+}{
+	{"Alert", tenantPolicy},
+	{"AlertArchive", tenantPolicy},
+	{"DeadLetter", tenantPolicy},
+	{"Outbox", tenantPolicy},
+	{"AlertLabel", childPolicy},
+	{"AlertAnnotation", childPolicy},
+	{"AlertSilence", childPolicy},
+}
+
+const (
+	tenantPolicy = `tenant = current_setting('alert2pg.tenant', TRUE) OR current_setting('alert2pg.tenant', TRUE) = '*'`
+	childPolicy  = `EXISTS (SELECT 1 FROM Alert a WHERE a.id = AlertID)`
+)
+
+// validateTenancy 校验多租户模式的选项.
+func (o PostgresOptions) validateTenancy() error {
+	if o.tenancy && o.timescale {
+		return fmt.Errorf("TimescaleDB 模式不支持多租户")
+	}
+	return nil
+}
+
+// applyTenancyPolicies 按配置启用或关闭租户行级安全策略, 每次启动时执行.
+// 表的所有者默认不受行级安全策略限制, 因此启用时同时设置 FORCE ROW LEVEL SECURITY.
+func (p *Postgres) applyTenancyPolicies(ctx context.Context) error {
+	if !p.options.tenancy {
+		var enabled bool
+		if err := p.pool.QueryRow(ctx, `SELECT relrowsecurity FROM pg_class WHERE relname = 'alert' AND pg_table_is_visible(oid)`).Scan(&enabled); err != nil {
+			return fmt.Errorf("无法查询 Alert 表行级安全策略状态: %w", err)
+		}
+		if !enabled {
+			return nil
+		}
+	}
+
+	if err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		for _, t := range tenantPolicies {
+			table := t.table
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP POLICY IF EXISTS alert2pg_tenant ON %s`, table)); err != nil {
+				return fmt.Errorf("删除 %s 租户策略失败: %w", table, err)
+			}
+			if !p.options.tenancy {
+				if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s NO FORCE ROW LEVEL SECURITY, DISABLE ROW LEVEL SECURITY`, table)); err != nil {
+					return fmt.Errorf("关闭 %s 行级安全策略失败: %w", table, err)
+				}
+				continue
+			}
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE POLICY alert2pg_tenant ON %s USING (%s) WITH CHECK (%s)`, table, t.policy, t.policy)); err != nil {
+				return fmt.Errorf("创建 %s 租户策略失败: %w", table, err)
+			}
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ENABLE ROW LEVEL SECURITY, FORCE ROW LEVEL SECURITY`, table)); err != nil {
+				return fmt.Errorf("启用 %s 行级安全策略失败: %w", table, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("无法更新租户行级安全策略: %w", err)
+	}
+
+	level.Info(p.logger).Log("消息", "租户行级安全策略更新完成", "启用", p.options.tenancy)
+	return nil
+}
+
+// setTenant 设置事务内的当前租户, 行级安全策略仅允许写入该租户的报警.
+func (p *Postgres) setTenant(ctx context.Context, tx pgx.Tx, id string) error {
+	if !p.options.tenancy {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `SELECT set_config($1, $2, TRUE)`, tenantSetting, id); err != nil {
+		return fmt.Errorf("无法设置当前租户: %w", err)
+	}
+	return nil
+}
+
+// tenantFilter 返回 ctx 中租户的查询条件, 未指定租户时返回空.
+func tenantFilter(ctx context.Context, alias string, args []any) (string, []any) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", args
+	}
+	args = append(args, id)
+	return fmt.Sprintf("%s.tenant = $%d", alias, len(args)), args
+}
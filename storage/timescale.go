@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/jackc/pgx/v5"
+)
+
+// timescaleAggregateWindow 连续聚合 AlertHourly 的刷新窗口, 保留时长必须大于该窗口, 避免刷新已删除的分块清空聚合结果.
+const timescaleAggregateWindow = 3 * 24 * time.Hour
+
+// timescaleTables TimescaleDB 模式下的超表, 使用相同的分块跨度及保留任务.
+var timescaleTables = []string{"alert", "alertsilence"}
+
+// validateTimescale 校验 TimescaleDB 模式的选项.
+func (o PostgresOptions) validateTimescale() error {
+	if !o.timescale {
+		return nil
+	}
+	if o.partitioned {
+		return fmt.Errorf("TimescaleDB 模式与分区模式不能同时启用")
+	}
+	// 连续聚合按 labels 中的 alertname, severity 统计.
+	if o.layout != LayoutJSONB {
+		return fmt.Errorf("TimescaleDB 模式仅支持 %s 存储方式", LayoutJSONB)
+	}
+	if o.timescaleChunkInterval <= 0 || o.timescaleCompressAfter < 0 || o.timescaleRetention < 0 {
+		return fmt.Errorf("TimescaleDB 分块跨度必须大于 0, 压缩及保留时长不能小于 0")
+	}
+	if o.timescaleRetention > 0 && o.timescaleRetention <= timescaleAggregateWindow {
+		return fmt.Errorf("TimescaleDB 保留时长必须大于连续聚合刷新窗口 %s", timescaleAggregateWindow)
+	}
+	return nil
+}
+
+// isHypertable 判断表是否为 TimescaleDB 超表.
+func (p *Postgres) isHypertable(ctx context.Context, table string) (bool, error) {
+	var hypertable bool
+	if err := p.pool.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')
+		AND EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = $1)`, table).Scan(&hypertable); err != nil {
+		return false, fmt.Errorf("无法查询 %s 表是否为 TimescaleDB 超表: %w", table, err)
+	}
+	return hypertable, nil
+}
+
+// timescalePolicy 更新 TimescaleDB 策略的一条语句.
+type timescalePolicy struct {
+	desc string // 执行失败时的错误描述
+	sql  string
+	args []any
+}
+
+// timescalePolicies 按配置生成更新超表分块跨度, 保留任务及压缩任务的语句, 先删除已有的策略及任务再按配置添加.
+// 不使用内置的保留策略, 由保留任务仅删除不包含 Firing 报警的分块, 旧版本添加的内置保留策略同样需要删除.
+func (o PostgresOptions) timescalePolicies() []timescalePolicy {
+	policies := make([]timescalePolicy, 0, 2*len(timescaleTables)+4)
+	for _, table := range timescaleTables {
+		policies = append(policies,
+			timescalePolicy{
+				desc: fmt.Sprintf("设置 %s 分块跨度", table),
+				sql:  `SELECT set_chunk_time_interval($1::TEXT::REGCLASS, $2::TEXT::INTERVAL)`,
+				args: []any{table, interval(o.timescaleChunkInterval)},
+			},
+			timescalePolicy{
+				desc: fmt.Sprintf("删除 %s 保留策略", table),
+				sql:  `SELECT remove_retention_policy($1::TEXT::REGCLASS, if_exists => TRUE)`,
+				args: []any{table},
+			},
+		)
+	}
+
+	policies = append(policies, timescalePolicy{
+		desc: "删除保留任务",
+		sql: `
+		SELECT delete_job(job_id) FROM timescaledb_information.jobs
+		WHERE proc_name = 'alert2pg_drop_resolved_chunks'`,
+	})
+	if o.timescaleRetention > 0 {
+		policies = append(policies, timescalePolicy{
+			desc: "添加保留任务",
+			sql: `
+			SELECT add_job('alert2pg_drop_resolved_chunks', INTERVAL '1 hour',
+				config => jsonb_build_object('drop_after', $1::TEXT))`,
+			args: []any{interval(o.timescaleRetention)},
+		})
+	}
+
+	policies = append(policies, timescalePolicy{
+		desc: "删除压缩任务",
+		sql: `
+		SELECT delete_job(job_id) FROM timescaledb_information.jobs
+		WHERE proc_name = 'alert2pg_compress_resolved_chunks'`,
+	})
+	if o.timescaleCompressAfter > 0 {
+		policies = append(policies, timescalePolicy{
+			desc: "添加压缩任务",
+			sql: `
+			SELECT add_job('alert2pg_compress_resolved_chunks', INTERVAL '1 hour',
+				config => jsonb_build_object('compress_after', $1::TEXT))`,
+			args: []any{interval(o.timescaleCompressAfter)},
+		})
+	}
+	return policies
+}
+
+// applyTimescalePolicies 按配置更新超表的分块跨度, 压缩任务及保留任务, 每次启动时执行, 修改配置后重启生效.
+func (p *Postgres) applyTimescalePolicies(ctx context.Context) error {
+	if err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		for _, policy := range p.options.timescalePolicies() {
+			if _, err := tx.Exec(ctx, policy.sql, policy.args...); err != nil {
+				return fmt.Errorf("%s失败: %w", policy.desc, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("无法更新 TimescaleDB 策略: %w", err)
+	}
+
+	level.Info(p.logger).Log("消息", "TimescaleDB 策略更新完成", "分块跨度", p.options.timescaleChunkInterval,
+		"压缩时长", p.options.timescaleCompressAfter, "保留时长", p.options.timescaleRetention)
+	return nil
+}
+
+// interval 将时长转换为 PostgreSQL INTERVAL 文本.
+func interval(d time.Duration) string {
+	return fmt.Sprintf("%d microseconds", d.Microseconds())
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresOptions_ValidateTimescale(t *testing.T) {
+	valid := PostgresOptions{
+		timescale:              true,
+		layout:                 LayoutJSONB,
+		timescaleChunkInterval: 24 * time.Hour,
+		timescaleCompressAfter: 7 * 24 * time.Hour,
+		timescaleRetention:     30 * 24 * time.Hour,
+	}
+	tests := []struct {
+		name   string
+		modify func(o *PostgresOptions)
+		err    string
+	}{
+		{name: "有效", modify: func(o *PostgresOptions) {}},
+		{name: "不压缩且永久保留", modify: func(o *PostgresOptions) { o.timescaleCompressAfter, o.timescaleRetention = 0, 0 }},
+		{name: "未启用时不校验", modify: func(o *PostgresOptions) { o.timescale, o.layout, o.partitioned = false, LayoutEAV, true }},
+		{name: "分区模式", modify: func(o *PostgresOptions) { o.partitioned = true }, err: "不能同时启用"},
+		{name: "EAV 存储方式", modify: func(o *PostgresOptions) { o.layout = LayoutEAV }, err: "仅支持 jsonb 存储方式"},
+		{name: "分块跨度为 0", modify: func(o *PostgresOptions) { o.timescaleChunkInterval = 0 }, err: "分块跨度必须大于 0"},
+		{name: "压缩时长小于 0", modify: func(o *PostgresOptions) { o.timescaleCompressAfter = -time.Hour }, err: "不能小于 0"},
+		{name: "保留时长小于 0", modify: func(o *PostgresOptions) { o.timescaleRetention = -time.Hour }, err: "不能小于 0"},
+		{name: "保留时长等于刷新窗口", modify: func(o *PostgresOptions) { o.timescaleRetention = timescaleAggregateWindow }, err: "必须大于连续聚合刷新窗口"},
+		{name: "保留时长大于刷新窗口", modify: func(o *PostgresOptions) { o.timescaleRetention = timescaleAggregateWindow + time.Hour }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := valid
+			tt.modify(&o)
+			err := o.validateTimescale()
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestPostgresOptions_TimescalePolicies(t *testing.T) {
+	o := PostgresOptions{
+		timescale:              true,
+		layout:                 LayoutJSONB,
+		timescaleChunkInterval: 24 * time.Hour,
+		timescaleCompressAfter: 7 * 24 * time.Hour,
+		timescaleRetention:     30 * 24 * time.Hour,
+	}
+	policies := o.timescalePolicies()
+	descs := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		descs = append(descs, policy.desc)
+	}
+	require.Equal(t, []string{
+		"设置 alert 分块跨度", "删除 alert 保留策略",
+		"设置 alertsilence 分块跨度", "删除 alertsilence 保留策略",
+		"删除保留任务", "添加保留任务",
+		"删除压缩任务", "添加压缩任务",
+	}, descs)
+
+	require.Contains(t, policies[0].sql, "set_chunk_time_interval")
+	require.Equal(t, []any{"alert", "86400000000 microseconds"}, policies[0].args)
+	require.Contains(t, policies[1].sql, "remove_retention_policy")
+	require.Contains(t, policies[1].sql, "if_exists => TRUE")
+	require.Equal(t, []any{"alert"}, policies[1].args)
+	for _, policy := range policies {
+		require.NotContains(t, policy.sql, "add_retention_policy")
+	}
+	require.Contains(t, policies[4].sql, "delete_job")
+	require.Contains(t, policies[4].sql, "'alert2pg_drop_resolved_chunks'")
+	require.Empty(t, policies[4].args)
+	require.Contains(t, policies[5].sql, "add_job('alert2pg_drop_resolved_chunks'")
+	require.Contains(t, policies[5].sql, "'drop_after'")
+	require.Equal(t, []any{"2592000000000 microseconds"}, policies[5].args)
+	require.Contains(t, policies[6].sql, "delete_job")
+	require.Contains(t, policies[6].sql, "'alert2pg_compress_resolved_chunks'")
+	require.Empty(t, policies[6].args)
+	require.Contains(t, policies[7].sql, "add_job('alert2pg_compress_resolved_chunks'")
+	require.Equal(t, []any{"604800000000 microseconds"}, policies[7].args)
+
+	// 不压缩且永久保留时仅删除已有的保留策略及压缩任务.
+	o.timescaleCompressAfter, o.timescaleRetention = 0, 0
+	descs = descs[:0]
+	for _, policy := range o.timescalePolicies() {
+		descs = append(descs, policy.desc)
+	}
+	require.Equal(t, []string{
+		"设置 alert 分块跨度", "删除 alert 保留策略",
+		"设置 alertsilence 分块跨度", "删除 alertsilence 保留策略",
+		"删除保留任务", "删除压缩任务",
+	}, descs)
+}
+
+func TestTimescaleDropResolvedChunks(t *testing.T) {
+	// 保留任务的存储过程仅在 TimescaleDB 模式下创建, 两个超表的分块均在包含 Firing 报警时保留.
+	var procedure string
+	for _, m := range migrations {
+		for _, stmt := range m.timescale {
+			if strings.Contains(stmt, "PROCEDURE alert2pg_drop_resolved_chunks") {
+				require.Nil(t, m.statements)
+				require.Nil(t, m.partitioned)
+				procedure = stmt
+			}
+		}
+	}
+	require.NotEmpty(t, procedure)
+	require.Contains(t, procedure, "show_chunks('alertsilence', older_than => (config->>'drop_after')::INTERVAL)")
+	require.Contains(t, procedure, "show_chunks('alert', older_than => (config->>'drop_after')::INTERVAL)")
+	require.Equal(t, 2, strings.Count(procedure, "status = ''firing''"))
+	require.Equal(t, 2, strings.Count(procedure, "IF NOT firing THEN"))
+	require.NotContains(t, procedure, "drop_chunks")
+}
+
+func TestInterval(t *testing.T) {
+	require.Equal(t, "0 microseconds", interval(0))
+	require.Equal(t, "1500 microseconds", interval(1500*time.Microsecond))
+	require.Equal(t, "3600000000 microseconds", interval(time.Hour))
+}
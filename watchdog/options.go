@@ -0,0 +1,57 @@
+package watchdog
+
+import "time"
+
+var defaultOptions = Options{
+	checkInterval: 30 * time.Second,
+	timeout:       5 * time.Minute,
+	syncFailures:  10,
+	notifyTimeout: 10 * time.Second,
+}
+
+type Options struct {
+	checkInterval time.Duration // 检查心跳及同步状态的时间间隔
+	timeout       time.Duration // 超过该时长未收到心跳报警时视为心跳丢失
+	syncFailures  int           // Buffer 与 Alertmanager 连续同步失败达到该次数时告警, 为 0 时不检查
+
+	// 心跳丢失或同步失败时 POST 通知的地址, 为空时仅记录日志.
+	notifyURL     string
+	notifyTimeout time.Duration
+}
+
+type Option interface {
+	apply(*Options)
+}
+
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+func WithCheckInterval(interval time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.checkInterval = interval
+	})
+}
+
+func WithTimeout(timeout time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.timeout = timeout
+	})
+}
+
+// WithSyncFailures 设置 Buffer 与 Alertmanager 连续同步失败的告警阈值, 为 0 时不检查.
+func WithSyncFailures(n int) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.syncFailures = n
+	})
+}
+
+// WithNotify 设置心跳丢失或同步失败时 POST 通知的地址及超时时间.
+func WithNotify(url string, timeout time.Duration) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.notifyURL = url
+		o.notifyTimeout = timeout
+	})
+}
@@ -0,0 +1,250 @@
+// Package watchdog 监控报警链路: 按固定间隔期望收到 Alertmanager 推送的心跳报警(如 Watchdog),
+// 心跳丢失或 Buffer 持续无法与 Alertmanager 同步时记录日志并可选地发送 HTTP 通知.
+package watchdog
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 通知原因.
+const (
+	ReasonHeartbeatMissing = "heartbeat_missing"
+	ReasonSyncFailing      = "alertmanager_sync_failing"
+)
+
+// SyncStatus 返回与 Alertmanager 连续同步失败的次数, 由 buffer.Buffer 实现.
+type SyncStatus interface {
+	SyncFailures() int
+}
+
+// Notification 心跳丢失或同步失败时 POST 的 JSON 通知, 恢复时 Status 为 resolved.
+type Notification struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	LastSeen  time.Time `json:"lastSeen,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Watchdog struct {
+	matchers matcher.Matchers
+	sync     SyncStatus
+	client   *http.Client
+
+	// 最后一次收到心跳报警的时间, 未收到时以启动时间计算超时.
+	mu       sync.Mutex
+	started  time.Time
+	lastSeen time.Time
+
+	// 当前是否处于心跳丢失及同步失败状态, 仅在 check 中访问.
+	heartbeatMissing bool
+	syncFailing      bool
+
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	options Options
+	logger  log.Logger
+
+	lastSeenGauge         prometheus.Gauge
+	heartbeatMissingGauge prometheus.Gauge
+	syncFailingGauge      prometheus.Gauge
+	notificationsCounter  *prometheus.CounterVec
+}
+
+// New 创建 Watchdog, 标签满足 matchers 的 Firing 报警视为心跳; sync 为 nil 时不检查同步状态.
+func New(matchers matcher.Matchers, sync SyncStatus, logger log.Logger, opts ...Option) (*Watchdog, error) {
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("心跳报警的标签匹配条件不能为空")
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	options := defaultOptions
+	for _, opt := range opts {
+		opt.apply(&options)
+	}
+	if options.checkInterval <= 0 || options.timeout <= 0 || options.syncFailures < 0 {
+		return nil, fmt.Errorf("无效的 watchdog 参数: checkInterval=%s, timeout=%s, syncFailures=%d", options.checkInterval, options.timeout, options.syncFailures)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Watchdog{
+		matchers: matchers,
+		sync:     sync,
+		client:   &http.Client{Timeout: options.notifyTimeout},
+		started:  time.Now(),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		options:  options,
+		logger:   logger,
+		lastSeenGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "alert2pg",
+			Subsystem: "watchdog",
+			Name:      "last_seen_timestamp_seconds",
+			Help:      "Unix timestamp of the last received heartbeat alert",
+		}),
+		heartbeatMissingGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "alert2pg",
+			Subsystem: "watchdog",
+			Name:      "heartbeat_missing",
+			Help:      "Whether the heartbeat alert has not been received within the timeout",
+		}),
+		syncFailingGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "alert2pg",
+			Subsystem: "watchdog",
+			Name:      "alertmanager_sync_failing",
+			Help:      "Whether synchronization with Alertmanager keeps failing",
+		}),
+		notificationsCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alert2pg",
+			Subsystem: "watchdog",
+			Name:      "notifications_total",
+			Help:      "Total number of watchdog notifications sent",
+		}, []string{"result"}),
+	}, nil
+}
+
+// Observe 记录 webhook 接收的心跳报警.
+func (w *Watchdog) Observe(alerts alert.Alerts) {
+	for _, a := range alerts {
+		if a.Status == alert.Firing && w.matchers.Matches(a.Labels) {
+			now := time.Now()
+			w.mu.Lock()
+			w.lastSeen = now
+			w.mu.Unlock()
+			w.lastSeenGauge.Set(float64(now.UnixNano()) / 1e9)
+			return
+		}
+	}
+}
+
+// Run 定期检查心跳及同步状态.
+func (w *Watchdog) Run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.options.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check(time.Now())
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watchdog) Stop() {
+	w.cancel()
+	<-w.done
+}
+
+// check 检查心跳及同步状态, 状态变化时记录日志并发送通知.
+func (w *Watchdog) check(now time.Time) {
+	w.mu.Lock()
+	lastSeen := w.lastSeen
+	baseline := w.started
+	if !lastSeen.IsZero() {
+		baseline = lastSeen
+	}
+	w.mu.Unlock()
+
+	if missing := now.Sub(baseline) > w.options.timeout; missing != w.heartbeatMissing {
+		w.heartbeatMissing = missing
+		n := Notification{Status: "resolved", Reason: ReasonHeartbeatMissing, Message: "已恢复接收心跳报警", LastSeen: lastSeen, Timestamp: now}
+		if missing {
+			w.heartbeatMissingGauge.Set(1)
+			n.Status, n.Message = "firing", fmt.Sprintf("超过 %s 未收到心跳报警, 报警链路可能中断", w.options.timeout)
+			level.Warn(w.logger).Log("消息", n.Message, "最后接收时间", lastSeen, "匹配条件", w.matchers.String())
+		} else {
+			w.heartbeatMissingGauge.Set(0)
+			level.Info(w.logger).Log("消息", n.Message, "匹配条件", w.matchers.String())
+		}
+		w.notify(n)
+	}
+
+	if w.sync == nil || w.options.syncFailures == 0 {
+		return
+	}
+	failures := w.sync.SyncFailures()
+	if failing := failures >= w.options.syncFailures; failing != w.syncFailing {
+		w.syncFailing = failing
+		n := Notification{Status: "resolved", Reason: ReasonSyncFailing, Message: "已恢复与 Alertmanager 同步", LastSeen: lastSeen, Timestamp: now}
+		if failing {
+			w.syncFailingGauge.Set(1)
+			n.Status, n.Message = "firing", fmt.Sprintf("与 Alertmanager 连续同步失败 %d 次", failures)
+			level.Warn(w.logger).Log("消息", n.Message)
+		} else {
+			w.syncFailingGauge.Set(0)
+			level.Info(w.logger).Log("消息", n.Message)
+		}
+		w.notify(n)
+	}
+}
+
+// notify 将通知 POST 到配置的地址, 未配置地址时不发送.
+func (w *Watchdog) notify(n Notification) {
+	if w.options.notifyURL == "" {
+		return
+	}
+	if err := w.post(n); err != nil {
+		w.notificationsCounter.WithLabelValues("failure").Inc()
+		level.Error(w.logger).Log("消息", "无法发送 watchdog 通知", "地址", w.options.notifyURL, "原因", n.Reason, "错误详情", err)
+		return
+	}
+	w.notificationsCounter.WithLabelValues("success").Inc()
+}
+
+func (w *Watchdog) post(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("无法序列化通知: %w", err)
+	}
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.options.notifyURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("无法创建请求: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("无法发送请求: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (w *Watchdog) Describe(ch chan<- *prometheus.Desc) {
+	w.lastSeenGauge.Describe(ch)
+	w.heartbeatMissingGauge.Describe(ch)
+	w.syncFailingGauge.Describe(ch)
+	w.notificationsCounter.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (w *Watchdog) Collect(ch chan<- prometheus.Metric) {
+	w.lastSeenGauge.Collect(ch)
+	w.heartbeatMissingGauge.Collect(ch)
+	w.syncFailingGauge.Collect(ch)
+	w.notificationsCounter.Collect(ch)
+}
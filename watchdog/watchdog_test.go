@@ -0,0 +1,136 @@
+package watchdog
+
+import (
+	"alert2pg/pkg/alert"
+	"alert2pg/pkg/matcher"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSync struct {
+	failures int
+}
+
+func (f *fakeSync) SyncFailures() int {
+	return f.failures
+}
+
+// recorder 记录接收的通知.
+type recorder struct {
+	mu            sync.Mutex
+	notifications []Notification
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var n Notification
+	if err := json.NewDecoder(req.Body).Decode(&n); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.notifications = append(r.notifications, n)
+	r.mu.Unlock()
+}
+
+func (r *recorder) take() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rlt := r.notifications
+	r.notifications = nil
+	return rlt
+}
+
+func heartbeat(status string) alert.Alerts {
+	a := alert.DefaultAlert()
+	a.Status = status
+	a.Labels = map[string]string{"alertname": "Watchdog"}
+	return alert.Alerts{a}
+}
+
+func TestWatchdog_Heartbeat(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	w, err := New(matcher.MustParse(`alertname="Watchdog"`), nil, nil,
+		WithTimeout(time.Minute), WithNotify(server.URL, time.Second))
+	require.NoError(t, err)
+
+	// 启动后超时时间内未收到心跳不告警.
+	w.check(w.started.Add(30 * time.Second))
+	require.Empty(t, rec.take())
+
+	w.check(w.started.Add(2 * time.Minute))
+	notifications := rec.take()
+	require.Len(t, notifications, 1)
+	require.Equal(t, "firing", notifications[0].Status)
+	require.Equal(t, ReasonHeartbeatMissing, notifications[0].Reason)
+	require.Equal(t, 1.0, testutil.ToFloat64(w.heartbeatMissingGauge))
+
+	// 心跳丢失期间不重复通知.
+	w.check(w.started.Add(3 * time.Minute))
+	require.Empty(t, rec.take())
+
+	// Resolved 及其他报警不视为心跳.
+	w.Observe(heartbeat(alert.Resolved))
+	require.Zero(t, testutil.ToFloat64(w.lastSeenGauge))
+
+	w.Observe(heartbeat(alert.Firing))
+	require.NotZero(t, testutil.ToFloat64(w.lastSeenGauge))
+	w.check(time.Now())
+	notifications = rec.take()
+	require.Len(t, notifications, 1)
+	require.Equal(t, "resolved", notifications[0].Status)
+	require.False(t, notifications[0].LastSeen.IsZero())
+	require.Equal(t, 0.0, testutil.ToFloat64(w.heartbeatMissingGauge))
+	require.Equal(t, 2.0, testutil.ToFloat64(w.notificationsCounter.WithLabelValues("success")))
+}
+
+func TestWatchdog_SyncFailing(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	status := &fakeSync{}
+	w, err := New(matcher.MustParse(`alertname="Watchdog"`), status, nil,
+		WithTimeout(time.Hour), WithSyncFailures(3), WithNotify(server.URL, time.Second))
+	require.NoError(t, err)
+
+	status.failures = 2
+	w.check(time.Now())
+	require.Empty(t, rec.take())
+
+	status.failures = 3
+	w.check(time.Now())
+	notifications := rec.take()
+	require.Len(t, notifications, 1)
+	require.Equal(t, ReasonSyncFailing, notifications[0].Reason)
+	require.Equal(t, "firing", notifications[0].Status)
+	require.Equal(t, 1.0, testutil.ToFloat64(w.syncFailingGauge))
+
+	status.failures = 0
+	w.check(time.Now())
+	notifications = rec.take()
+	require.Len(t, notifications, 1)
+	require.Equal(t, "resolved", notifications[0].Status)
+}
+
+func TestWatchdog_NotifyFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w, err := New(matcher.MustParse(`alertname="Watchdog"`), nil, nil,
+		WithTimeout(time.Minute), WithNotify(server.URL, time.Second))
+	require.NoError(t, err)
+	w.check(w.started.Add(2 * time.Minute))
+	require.Equal(t, 1.0, testutil.ToFloat64(w.notificationsCounter.WithLabelValues("failure")))
+}
@@ -1,6 +1,12 @@
 package webhook
 
-import "time"
+import (
+	"alert2pg/filter"
+	"alert2pg/pkg/relabel"
+	"alert2pg/pkg/tenant"
+	"alert2pg/watchdog"
+	"time"
+)
 
 var defaultOptions = Options{
 	address:        ":9567",
@@ -12,6 +18,14 @@ type Options struct {
 	address        string
 	supportVersion string
 	gracePeriod    time.Duration
+	// 多租户解析器, 为 nil 时不区分租户.
+	tenants *tenant.Resolver
+	// 写入 Buffer 前改写报警标签及注释的规则.
+	relabel relabel.Rules
+	// 写入 Buffer 前过滤报警的规则, 为 nil 时不过滤.
+	filter *filter.Filter
+	// 心跳报警监控, 为 nil 时不监控.
+	watchdog *watchdog.Watchdog
 }
 
 type Option interface {
@@ -36,6 +50,34 @@ func WithGracePeriod(gracePeriod time.Duration) optionFunc {
 	})
 }
 
+// WithTenantResolver 启用多租户, 由 resolver 解析推送的报警所属租户.
+func WithTenantResolver(resolver *tenant.Resolver) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.tenants = resolver
+	})
+}
+
+// WithRelabel 设置写入 Buffer 前改写报警标签及注释的规则.
+func WithRelabel(rules relabel.Rules) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.relabel = rules
+	})
+}
+
+// WithFilter 设置写入 Buffer 前过滤报警的规则.
+func WithFilter(f *filter.Filter) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.filter = f
+	})
+}
+
+// WithWatchdog 设置心跳报警监控, 心跳报警在过滤前记录, 过滤规则丢弃心跳报警时仍可监控.
+func WithWatchdog(w *watchdog.Watchdog) optionFunc {
+	return optionFunc(func(o *Options) {
+		o.watchdog = w
+	})
+}
+
 func WithSupportVersion(version string) optionFunc {
 	return optionFunc(func(o *Options) {
 		o.supportVersion = version
@@ -4,10 +4,13 @@ package webhook
 import (
 	"alert2pg/buffer"
 	"alert2pg/pkg/alert"
+	"alert2pg/pkg/relabel"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"net/http"
@@ -20,14 +23,20 @@ import (
 )
 
 type Server struct {
-	r       *mux.Router
-	server  *http.Server
-	buffer  *buffer.Buffer
+	r      *mux.Router
+	server *http.Server
+	buffer *buffer.Buffer
+	logger log.Logger
+
+	// mu 保护可在运行时替换的改写规则.
+	mu      sync.RWMutex
 	options Options
-	logger  log.Logger
 
 	webhookRequestHistogram    *prometheus.HistogramVec
 	webhookAlertCountHistogram prometheus.Histogram
+	tenantAlertsCounter        *prometheus.CounterVec
+	tenantRejectedCounter      *prometheus.CounterVec
+	relabelDroppedCounter      prometheus.Counter
 }
 
 func New(buffer *buffer.Buffer, logger log.Logger, opts ...optionFunc) (*Server, error) {
@@ -70,6 +79,32 @@ func New(buffer *buffer.Buffer, logger log.Logger, opts ...optionFunc) (*Server,
 				Buckets:   prometheus.ExponentialBuckets(1, 2, 8), // 1, 2, 4, 8, 16, ..., 128
 			},
 		),
+		tenantAlertsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "alert2pg",
+				Subsystem: "webhook",
+				Name:      "tenant_received_alerts_total",
+				Help:      "Total number of alerts received per tenant",
+			},
+			[]string{"tenant"},
+		),
+		tenantRejectedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "alert2pg",
+				Subsystem: "webhook",
+				Name:      "tenant_rejected_requests_total",
+				Help:      "Total number of webhook requests rejected per tenant and reason",
+			},
+			[]string{"tenant", "reason"},
+		),
+		relabelDroppedCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "alert2pg",
+				Subsystem: "webhook",
+				Name:      "relabel_dropped_alerts_total",
+				Help:      "Total number of alerts dropped by relabel rules",
+			},
+		),
 	}
 
 	for _, opt := range opts {
@@ -96,6 +131,18 @@ func (s *Server) Run() error {
 	return nil
 }
 
+// Handle 在 webhook server 上注册路径前缀为 prefix 的 HTTP 处理器, 如报警查询接口.
+func (s *Server) Handle(prefix string, h http.Handler) {
+	s.r.PathPrefix(prefix).Handler(h)
+}
+
+// SetRelabel 替换报警标签及注释的改写规则, 用于重新加载配置.
+func (s *Server) SetRelabel(rules relabel.Rules) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options.relabel = rules
+}
+
 // Stop 停止 webhook server 服务.
 func (s *Server) Stop() {
 	ctx, cancel := context.WithTimeout(context.Background(), s.options.gracePeriod)
@@ -135,8 +182,65 @@ func (s *Server) postWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 校验请求并解析所属租户, 未通过认证的请求不更新心跳报警, 不写入 Buffer.
+	var requestTenant string
+	if s.options.tenants != nil {
+		if requestTenant, err = s.options.tenants.Request(r); err != nil {
+			level.Warn(s.logger).Log("消息", "无法解析请求所属租户", "错误详情", err)
+			s.tenantRejectedCounter.WithLabelValues("", "unauthorized").Inc()
+			s.webhookRequestHistogram.WithLabelValues("401").Observe(time.Since(start).Seconds())
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// 改写报警标签及注释, 丢弃 keep, drop 规则过滤的报警.
+	s.mu.RLock()
+	rules := s.options.relabel
+	s.mu.RUnlock()
+	received := len(ag.Alerts)
+	ag.Alerts = rules.Process(ag.Alerts)
+	if dropped := received - len(ag.Alerts); dropped > 0 {
+		s.relabelDroppedCounter.Add(float64(dropped))
+		level.Debug(s.logger).Log("消息", "改写规则丢弃报警", "数量", dropped)
+	}
+
+	if s.options.watchdog != nil {
+		s.options.watchdog.Observe(ag.Alerts)
+	}
+
+	// 按请求所属租户及报警标签确定报警所属租户, 需在过滤规则精简报警标签前执行.
+	if s.options.tenants != nil {
+		if err := s.options.tenants.Assign(ag.Alerts, requestTenant); err != nil {
+			level.Warn(s.logger).Log("消息", "无法确定报警所属租户", "租户", requestTenant, "错误详情", err)
+			s.tenantRejectedCounter.WithLabelValues(requestTenant, "invalid").Inc()
+			s.webhookRequestHistogram.WithLabelValues("400").Observe(time.Since(start).Seconds())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 按过滤规则丢弃或精简报警, 被丢弃的报警不会写入 Buffer.
+	if s.options.filter != nil {
+		ag.Alerts = s.options.filter.Process(ag.Alerts)
+	}
+
 	// 放入 buffer
 	if err := s.buffer.Update(r.Context(), ag.Alerts); err != nil {
+		if errors.Is(err, buffer.ErrQuotaExceeded) {
+			level.Warn(s.logger).Log("消息", "租户报警数量超过配额", "租户", requestTenant, "错误详情", err)
+			s.tenantRejectedCounter.WithLabelValues(requestTenant, "quota").Inc()
+			s.webhookRequestHistogram.WithLabelValues("429").Observe(time.Since(start).Seconds())
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		// 数据库长时间不可用, 由 Alertmanager 稍后重试.
+		if errors.Is(err, buffer.ErrBufferFull) {
+			level.Warn(s.logger).Log("消息", "Buffer 中未存储的报警数量超过上限", "错误详情", err)
+			s.webhookRequestHistogram.WithLabelValues("503").Observe(time.Since(start).Seconds())
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		level.Error(s.logger).Log("消息", "更新 Buffer 失败", "错误详情", err)
 		s.webhookRequestHistogram.WithLabelValues("500").Observe(time.Since(start).Seconds())
 		http.Error(w, "更新 Buffer 失败: 内部处理超时", http.StatusInternalServerError)
@@ -144,4 +248,27 @@ func (s *Server) postWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.webhookAlertCountHistogram.Observe(float64(len(ag.Alerts)))
+	if s.options.tenants != nil {
+		for _, a := range ag.Alerts {
+			s.tenantAlertsCounter.WithLabelValues(a.Tenant).Inc()
+		}
+	}
+}
+
+// Describe 实现 prometheus.Collector 接口.
+func (s *Server) Describe(ch chan<- *prometheus.Desc) {
+	s.webhookRequestHistogram.Describe(ch)
+	s.webhookAlertCountHistogram.Describe(ch)
+	s.tenantAlertsCounter.Describe(ch)
+	s.tenantRejectedCounter.Describe(ch)
+	s.relabelDroppedCounter.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector 接口.
+func (s *Server) Collect(ch chan<- prometheus.Metric) {
+	s.webhookRequestHistogram.Collect(ch)
+	s.webhookAlertCountHistogram.Collect(ch)
+	s.tenantAlertsCounter.Collect(ch)
+	s.tenantRejectedCounter.Collect(ch)
+	s.relabelDroppedCounter.Collect(ch)
 }
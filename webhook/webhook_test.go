@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"alert2pg/buffer"
+	"alert2pg/filter"
+	"alert2pg/pkg/matcher"
+	"alert2pg/pkg/tenant"
+	"alert2pg/watchdog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+const heartbeatPayload = `{
+	"version": "4",
+	"status": "firing",
+	"alerts": [{
+		"status": "firing",
+		"labels": {"alertname": "Watchdog"},
+		"startsAt": "2025-07-01T08:00:00Z",
+		"endsAt": "0001-01-01T00:00:00Z",
+		"fingerprint": "00000000000000aa"
+	}]
+}`
+
+// lastSeen 返回 Watchdog 记录的最后一次接收心跳报警的时间戳.
+func lastSeen(t *testing.T, wd *watchdog.Watchdog) float64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(wd))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == "alert2pg_watchdog_last_seen_timestamp_seconds" {
+			return f.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatal("缺少 last_seen 指标")
+	return 0
+}
+
+func postWebhook(s *Server, token string) *httptest.ResponseRecorder {
+	return postPayload(s, token, heartbeatPayload)
+}
+
+func postPayload(s *Server, token, payload string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.r.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestServer_WatchdogUnauthorized 未通过认证的请求不更新心跳报警的最后接收时间, 也不写入 Buffer.
+func TestServer_WatchdogUnauthorized(t *testing.T) {
+	b := buffer.New(nil)
+	wd, err := watchdog.New(matcher.MustParse(`{alertname="Watchdog"}`), nil, nil)
+	require.NoError(t, err)
+	tenants, err := tenant.New(tenant.WithTokens(map[string]string{"secret": "team-a"}))
+	require.NoError(t, err)
+	s, err := New(b, nil, WithTenantResolver(tenants), WithWatchdog(wd))
+	require.NoError(t, err)
+
+	for _, token := range []string{"", "wrong"} {
+		rec := postWebhook(s, token)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		require.Zero(t, lastSeen(t, wd))
+		require.Empty(t, b.DeepCopy())
+	}
+
+	rec := postWebhook(s, "secret")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NotZero(t, lastSeen(t, wd))
+	require.Len(t, b.DeepCopy(), 1)
+}
+
+// TestServer_TenantSummaryOnly 精简报警标签时已按租户标签确定报警所属租户.
+func TestServer_TenantSummaryOnly(t *testing.T) {
+	b := buffer.New(nil)
+	tenants, err := tenant.New(tenant.WithLabel("team"), tenant.WithDefault("default"))
+	require.NoError(t, err)
+	f, err := filter.New([]filter.Rule{{
+		Name:     "summary",
+		Matchers: matcher.MustParse(`{alertname="HighLoad"}`),
+		Action:   filter.SummaryOnly,
+	}})
+	require.NoError(t, err)
+	s, err := New(b, nil, WithTenantResolver(tenants), WithFilter(f))
+	require.NoError(t, err)
+
+	rec := postPayload(s, "", `{
+	"version": "4",
+	"status": "firing",
+	"alerts": [{
+		"status": "firing",
+		"labels": {"alertname": "HighLoad", "severity": "warning", "team": "team-a", "instance": "node-1"},
+		"startsAt": "2025-07-01T08:00:00Z",
+		"endsAt": "0001-01-01T00:00:00Z",
+		"fingerprint": "00000000000000bb"
+	}]
+}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	alerts := b.DeepCopy()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "team-a", alerts[0].Tenant)
+	require.Equal(t, map[string]string{"alertname": "HighLoad", "severity": "warning"}, alerts[0].Labels)
+}